@@ -0,0 +1,205 @@
+package alert
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/systeminfo"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Threshold rule over one metric
+// Every series of the metric matching Labels is evaluated on its own
+// and fires once its value stays past the threshold for For
+type Rule struct {
+	Name   string
+	Metric string
+	Labels map[string]string
+	Above  *float64
+	Below  *float64
+	For    time.Duration
+}
+
+// Alert state of a single series
+type State int
+
+const (
+	OK State = iota
+	Pending
+	Firing
+)
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Firing:
+		return "firing"
+	default:
+		return "ok"
+	}
+}
+
+// Change of state of one series of a rule
+type Transition struct {
+	Rule   string
+	Series string // Metric name and labels, e.g. disk.used_percent{mountpoint="/"}
+	From   State
+	To     State
+	Value  float64
+	Time   time.Time
+}
+
+type seriesState struct {
+	state State
+	since time.Time // When the threshold was first crossed
+	value float64
+}
+
+// Evaluates rules against snapshots, remembering the state of every series
+type Engine struct {
+	rules  []Rule
+	states map[string]*seriesState // Keyed by rule name + series
+}
+
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{rules: rules, states: map[string]*seriesState{}}
+}
+
+// Built-in rules used when the config doesn't define any
+func DefaultRules() []Rule {
+	ninety := 90.0
+	return []Rule{
+		{Name: "cpu high", Metric: "cpu.percent", Above: &ninety, For: time.Minute},
+		{Name: "memory high", Metric: "memory.used_percent", Above: &ninety, For: time.Minute},
+		{Name: "disk almost full", Metric: "disk.used_percent", Above: &ninety},
+	}
+}
+
+// Converts the configured alerts into rules
+func RulesFromConfig(alerts []config.Alert) ([]Rule, error) {
+	if alerts == nil {
+		return DefaultRules(), nil
+	}
+
+	rules := make([]Rule, 0, len(alerts))
+	names := map[string]bool{}
+	for _, a := range alerts {
+		if a.Name == "" || a.Metric == "" {
+			return nil, fmt.Errorf("alerts: every alert needs a name and a metric")
+		}
+		if names[a.Name] {
+			return nil, fmt.Errorf("alerts: duplicated alert name %q", a.Name)
+		}
+		names[a.Name] = true
+
+		if a.Above == nil && a.Below == nil {
+			return nil, fmt.Errorf("alerts: %q needs an above or below threshold", a.Name)
+		}
+
+		r := Rule{Name: a.Name, Metric: a.Metric, Labels: a.Labels, Above: a.Above, Below: a.Below}
+		if a.For != "" {
+			d, err := time.ParseDuration(a.For)
+			if err != nil {
+				return nil, fmt.Errorf("alerts: %q has an invalid duration: %w", a.Name, err)
+			}
+			r.For = d
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Evaluates every rule against the metrics and returns the state changes
+// Series missing from metrics are considered back to normal
+func (e *Engine) Evaluate(now time.Time, metrics []systeminfo.Metric) []Transition {
+	var transitions []Transition
+	seen := map[string]bool{}
+
+	for _, r := range e.rules {
+		for _, m := range metrics {
+			if m.Name != r.Metric || !matchLabels(m.Labels, r.Labels) {
+				continue
+			}
+
+			series := SeriesName(m.Name, m.Labels)
+			key := r.Name + "\x00" + series
+			seen[key] = true
+
+			st, ok := e.states[key]
+			if !ok {
+				st = &seriesState{}
+				e.states[key] = st
+			}
+			st.value = m.Value
+
+			next := st.state
+			if r.breached(m.Value) {
+				if st.state == OK {
+					st.since = now
+					next = Pending
+				}
+				if now.Sub(st.since) >= r.For {
+					next = Firing
+				}
+			} else {
+				next = OK
+			}
+
+			if next != st.state {
+				transitions = append(transitions, Transition{Rule: r.Name, Series: series, From: st.state, To: next, Value: m.Value, Time: now})
+				st.state = next
+			}
+		}
+	}
+
+	for key, st := range e.states {
+		if seen[key] {
+			continue
+		}
+		if st.state != OK {
+			rule, series, _ := strings.Cut(key, "\x00")
+			transitions = append(transitions, Transition{Rule: rule, Series: series, From: st.state, To: OK, Value: st.value, Time: now})
+		}
+		delete(e.states, key)
+	}
+
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].Rule < transitions[j].Rule
+	})
+	return transitions
+}
+
+// Returns the number of firing series
+func (e *Engine) FiringCount() int {
+	n := 0
+	for _, st := range e.states {
+		if st.state == Firing {
+			n++
+		}
+	}
+	return n
+}
+
+func (r Rule) breached(v float64) bool {
+	if r.Above != nil && v > *r.Above {
+		return true
+	}
+	return r.Below != nil && v < *r.Below
+}
+
+// Reports whether labels contain every wanted label
+func matchLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Formats a metric name and its labels as name{k="v",...}
+func SeriesName(name string, labels map[string]string) string {
+	return systeminfo.SeriesKey(name, labels)
+}
@@ -0,0 +1,247 @@
+package analysis
+
+import (
+	"github/iegpeppino/syspulse/systeminfo"
+	"math"
+	"path"
+	"sort"
+	"time"
+)
+
+// Defaults of the anomaly detector
+const (
+	DefaultAnomalySigma    = 3.0
+	DefaultAnomalyHalfLife = 15 * time.Minute
+)
+
+// Series watched when the config doesn't list any
+var DefaultAnomalyMetrics = []string{"cpu.percent", "memory.used_percent", "swap.used_percent", "disk.used_percent"}
+
+// Limits of the baselines
+const (
+	minAnomalySamples = 60          // Samples a baseline needs before it's trusted
+	maxAnomalyGap     = time.Minute // Longer gaps weigh like this, so a pause doesn't wipe the baseline
+	anomalyMarksKept  = time.Hour   // How long anomalous readings are kept for the charts
+
+	// Floor of the deviation, so a series that barely moved doesn't
+	// turn its first wobble into a huge score
+	minRelativeStd = 0.02 // Share of the mean
+	minPercentStd  = 0.5  // Percentage points, for percent metrics
+)
+
+func init() {
+	systeminfo.RegisterMetric("anomaly.score", systeminfo.MetricInfo{Type: systeminfo.Gauge, Help: "Deviation of a series from its learned baseline, in standard deviations. The metric label names the series."})
+	systeminfo.RegisterMetric("anomaly.active", systeminfo.MetricInfo{Type: systeminfo.Gauge, Help: "Number of series currently deviating past the anomaly threshold."})
+}
+
+// Change of state of a series: it started or stopped deviating
+type AnomalyEvent struct {
+	Time     time.Time
+	Series   string // Metric name and labels
+	Name     string
+	Labels   map[string]string
+	Value    float64
+	Expected float64 // Baseline mean
+	Score    float64 // Deviation in standard deviations, negative below the baseline
+	Start    bool    // Started deviating, or back to normal
+}
+
+// Exponentially weighted mean and variance of a series
+type baseline struct {
+	mean, variance float64
+	n              int
+	last           time.Time
+}
+
+// Adds a value, weighing it by the time since the previous one
+func (b *baseline) update(t time.Time, v float64, halfLife time.Duration) {
+	b.n++
+	if b.n == 1 {
+		b.mean, b.variance, b.last = v, 0, t
+		return
+	}
+	dt := min(max(t.Sub(b.last), 0), maxAnomalyGap)
+	b.last = t
+	alpha := 1 - math.Exp(-math.Ln2*float64(dt)/float64(halfLife))
+	alpha = math.Max(alpha, 1/float64(b.n)) // Plain average while warming up
+
+	diff := v - b.mean
+	incr := alpha * diff
+	b.mean += incr
+	b.variance = (1 - alpha) * (b.variance + diff*incr)
+}
+
+// Learned state of a series
+type anomalySeries struct {
+	name     string
+	labels   map[string]string
+	percent  bool
+	global   baseline
+	hourly   [24]baseline // By hour of day, used once warm when seasonal
+	score    float64
+	scored   bool // Score is set, the baseline was warm
+	anomaly  bool
+	marks    []time.Time // Anomalous readings, oldest first
+	lastSeen time.Time
+}
+
+// Learns a baseline of every watched series and scores each reading
+// by how many standard deviations it lies from it
+type AnomalyDetector struct {
+	sigma    float64
+	halfLife time.Duration
+	seasonal bool
+	metrics  []string // Name patterns of the watched series
+	series   map[string]*anomalySeries
+}
+
+// Detector settings
+type AnomalyOptions struct {
+	Sigma    float64       // Deviation past which a reading is anomalous
+	HalfLife time.Duration // How fast baselines forget old readings
+	Seasonal bool          // Keep a baseline per hour of day
+	Metrics  []string      // Name patterns of the watched series, * matches anything
+}
+
+func NewAnomalyDetector(opts AnomalyOptions) *AnomalyDetector {
+	if opts.Sigma <= 0 {
+		opts.Sigma = DefaultAnomalySigma
+	}
+	if opts.HalfLife <= 0 {
+		opts.HalfLife = DefaultAnomalyHalfLife
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = DefaultAnomalyMetrics
+	}
+	return &AnomalyDetector{
+		sigma:    opts.Sigma,
+		halfLife: opts.HalfLife,
+		seasonal: opts.Seasonal,
+		metrics:  opts.Metrics,
+		series:   map[string]*anomalySeries{},
+	}
+}
+
+func (d *AnomalyDetector) watched(name string) bool {
+	for _, p := range d.metrics {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Scores the readings of a sample against their baselines, then learns
+// from them. Returns the series that started or stopped deviating
+func (d *AnomalyDetector) Observe(t time.Time, metrics []systeminfo.Metric) []AnomalyEvent {
+	var events []AnomalyEvent
+	for _, m := range metrics {
+		if !d.watched(m.Name) || math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+			continue
+		}
+		key := systeminfo.SeriesKey(m.Name, m.Labels)
+		s := d.series[key]
+		if s == nil {
+			s = &anomalySeries{name: m.Name, labels: m.Labels, percent: systeminfo.DescribeMetric(m.Name).Unit == "percent"}
+			d.series[key] = s
+		}
+		s.lastSeen = t
+
+		hour := &s.hourly[t.Hour()]
+		b := &s.global
+		if d.seasonal && hour.n >= minAnomalySamples {
+			b = hour
+		}
+
+		s.scored = b.n >= minAnomalySamples
+		if s.scored {
+			s.score = (m.Value - b.mean) / s.std(b)
+			anomalous := math.Abs(s.score) >= d.sigma
+			if anomalous {
+				s.marks = append(s.marks, t)
+			}
+			if anomalous != s.anomaly {
+				s.anomaly = anomalous
+				events = append(events, AnomalyEvent{
+					Time: t, Series: key, Name: m.Name, Labels: m.Labels,
+					Value: m.Value, Expected: b.mean, Score: s.score, Start: anomalous,
+				})
+			}
+		}
+		cut := 0
+		for cut < len(s.marks) && t.Sub(s.marks[cut]) > anomalyMarksKept {
+			cut++
+		}
+		s.marks = s.marks[cut:]
+
+		s.global.update(t, m.Value, d.halfLife)
+		if d.seasonal {
+			hour.update(t, m.Value, d.halfLife)
+		}
+	}
+
+	// Series gone for long (e.g. an unmounted disk) are forgotten
+	for key, s := range d.series {
+		if t.Sub(s.lastSeen) > anomalyMarksKept {
+			delete(d.series, key)
+		}
+	}
+	return events
+}
+
+// Deviation of a baseline, floored so flat series stay sensible
+func (s *anomalySeries) std(b *baseline) float64 {
+	floor := math.Max(minRelativeStd*math.Abs(b.mean), 1e-9)
+	if s.percent {
+		floor = math.Max(floor, minPercentStd)
+	}
+	return math.Max(math.Sqrt(b.variance), floor)
+}
+
+// Forgets every baseline, e.g. when a replay seeks
+func (d *AnomalyDetector) Reset() {
+	d.series = map[string]*anomalySeries{}
+}
+
+// Latest score of every series with a warm baseline, labelled with the
+// series name, and the number of series deviating
+func (d *AnomalyDetector) Metrics() []systeminfo.Metric {
+	keys := make([]string, 0, len(d.series))
+	for k := range d.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var metrics []systeminfo.Metric
+	active := 0
+	for _, k := range keys {
+		s := d.series[k]
+		if !s.scored {
+			continue
+		}
+		labels := map[string]string{"metric": s.name}
+		for lk, lv := range s.labels {
+			labels[lk] = lv
+		}
+		metrics = append(metrics, systeminfo.Metric{Name: "anomaly.score", Labels: labels, Value: s.score})
+		if s.anomaly {
+			active++
+		}
+	}
+	return append(metrics, systeminfo.Metric{Name: "anomaly.active", Value: float64(active)})
+}
+
+// Times of the anomalous readings of a series between from and to
+func (d *AnomalyDetector) Marks(name string, labels map[string]string, from, to time.Time) []time.Time {
+	s := d.series[systeminfo.SeriesKey(name, labels)]
+	if s == nil {
+		return nil
+	}
+	var out []time.Time
+	for _, t := range s.marks {
+		if !t.Before(from) && !t.After(to) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"github/iegpeppino/syspulse/systeminfo"
+	"testing"
+	"time"
+)
+
+func TestBaselineUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		halfLife  time.Duration
+		points    []systeminfo.Point
+		mean, vrc float64
+	}{
+		// Warming up weighs every value the same: the plain mean and variance
+		{"warm up", 1000 * time.Hour, series(time.Second, 2, 4, 4, 4, 5, 5, 7, 9), 5, 4},
+		{"noisy", 1000 * time.Hour, series(time.Second, 10, 12, 8, 10), 10, 2},
+		{"flat", 1000 * time.Hour, series(time.Second, 5, 5, 5, 5, 5, 5), 5, 0},
+		{"single value", time.Minute, series(time.Second, 7), 7, 0},
+		// A value a half-life later weighs as much as everything before
+		{"half-life", time.Minute, series(time.Minute, 0, 10), 5, 25},
+		// Gaps weigh like maxAnomalyGap: two half-lives of 30s
+		{"long gap", 30 * time.Second, series(10*time.Minute, 0, 10), 7.5, 18.75},
+	}
+	for _, tt := range tests {
+		var b baseline
+		for _, p := range tt.points {
+			b.update(p.Time, p.Value, tt.halfLife)
+		}
+		if !near(b.mean, tt.mean) || !near(b.variance, tt.vrc) {
+			t.Errorf("%s: mean %v variance %v, want %v and %v", tt.name, b.mean, b.variance, tt.mean, tt.vrc)
+		}
+	}
+}
+
+// Feeds a detector n readings of cpu.percent a second apart from start,
+// alternating between the given values
+func warmUp(d *AnomalyDetector, start time.Time, n int, values ...float64) {
+	for i := 0; i < n; i++ {
+		d.Observe(start.Add(time.Duration(i)*time.Second), []systeminfo.Metric{{Name: "cpu.percent", Value: values[i%len(values)]}})
+	}
+}
+
+func TestAnomalyScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		warm    []float64 // Alternated for minAnomalySamples readings
+		reading float64
+		score   float64
+		start   bool
+	}{
+		{"within the noise", []float64{40, 60}, 65, 1.5, false},
+		{"spike", []float64{40, 60}, 100, 5, true},
+		{"drop", []float64{40, 60}, 10, -4, true},
+		// Flat series use a floor of max(2% of the mean, 0.5 points) as deviation
+		{"flat, small wobble", []float64{50}, 51, 1, false},
+		{"flat, jump", []float64{50}, 54, 4, true},
+		{"flat near zero", []float64{0.1}, 1.6, 3, true},
+	}
+	for _, tt := range tests {
+		d := NewAnomalyDetector(AnomalyOptions{Metrics: []string{"cpu.*"}})
+		warmUp(d, t0, minAnomalySamples, tt.warm...)
+		events := d.Observe(t0.Add(time.Hour), []systeminfo.Metric{{Name: "cpu.percent", Value: tt.reading}})
+
+		s := d.series[systeminfo.SeriesKey("cpu.percent", nil)]
+		if !s.scored || !near(s.score, tt.score) {
+			t.Errorf("%s: score %v (scored %v), want %v", tt.name, s.score, s.scored, tt.score)
+		}
+		if started := len(events) == 1 && events[0].Start; started != tt.start {
+			t.Errorf("%s: events %+v, want a start %v", tt.name, events, tt.start)
+		}
+	}
+}
+
+func TestAnomalyEvents(t *testing.T) {
+	d := NewAnomalyDetector(AnomalyOptions{Metrics: []string{"cpu.percent"}})
+
+	// No score until the baseline is warm
+	warmUp(d, t0, minAnomalySamples-1, 40, 60)
+	if events := d.Observe(t0.Add(time.Minute), []systeminfo.Metric{{Name: "cpu.percent", Value: 100}}); len(events) != 0 {
+		t.Fatalf("cold baseline raised %+v", events)
+	}
+	if m := d.Metrics(); len(m) != 1 || m[0].Name != "anomaly.active" {
+		t.Fatalf("cold baseline metrics = %+v, want only anomaly.active", m)
+	}
+
+	// Starting, staying and stopping raise one event each way
+	var got []bool
+	for i, v := range []float64{200, 200, 50, 50} {
+		for _, e := range d.Observe(t0.Add(time.Duration(61+i)*time.Second), []systeminfo.Metric{{Name: "cpu.percent", Value: v}}) {
+			got = append(got, e.Start)
+		}
+	}
+	if len(got) != 2 || !got[0] || got[1] {
+		t.Errorf("events started = %v, want a start then a stop", got)
+	}
+	if marks := d.Marks("cpu.percent", nil, t0, t0.Add(time.Hour)); len(marks) != 2 {
+		t.Errorf("%d anomalous readings marked, want 2", len(marks))
+	}
+
+	// Other series are left alone
+	if events := d.Observe(t0.Add(time.Hour), []systeminfo.Metric{{Name: "memory.used_percent", Value: 100}}); len(events) != 0 {
+		t.Errorf("unwatched series raised %+v", events)
+	}
+}
+
+func TestSeasonalBaseline(t *testing.T) {
+	night, noon := t0, t0.Add(12*time.Hour)
+	tests := []struct {
+		name     string
+		seasonal bool
+		anomaly  bool
+	}{
+		// Against the whole day (mean 50, deviation 40) a quiet noon is normal
+		{"global", false, false},
+		// Against noon alone (mean 90) it's far off
+		{"seasonal", true, true},
+	}
+	for _, tt := range tests {
+		d := NewAnomalyDetector(AnomalyOptions{Metrics: []string{"cpu.percent"}, Seasonal: tt.seasonal})
+		warmUp(d, night, minAnomalySamples, 9, 11)
+		warmUp(d, noon, minAnomalySamples, 89, 91)
+
+		d.Observe(noon.Add(24*time.Hour), []systeminfo.Metric{{Name: "cpu.percent", Value: 10}})
+		s := d.series[systeminfo.SeriesKey("cpu.percent", nil)]
+		if s.anomaly != tt.anomaly {
+			t.Errorf("%s: anomaly %v with score %v, want %v", tt.name, s.anomaly, s.score, tt.anomaly)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package analysis
+
+import (
+	"github/iegpeppino/syspulse/systeminfo"
+	"math"
+	"sort"
+	"time"
+)
+
+// Defaults of the disk forecaster
+const (
+	DefaultForecastWindow  = 6 * time.Hour
+	DefaultForecastHorizon = 24 * time.Hour
+)
+
+// Limits of the disk trend fit
+const (
+	forecastEvery   = 30 * time.Second // Least time between kept samples
+	minForecastSpan = 5 * time.Minute  // Usage history needed before estimating
+	minForecastPts  = 5
+	confidentSpan   = time.Hour // History past which confidence only depends on the fit
+
+	// Estimates further away than this are reported as not filling up
+	maxTimeToFull = 10 * 365 * 24 * time.Hour
+)
+
+func init() {
+	systeminfo.RegisterMetric("disk.time_to_full_seconds", systeminfo.MetricInfo{Type: systeminfo.Gauge, Unit: "seconds", Help: "Estimated time until the filesystem is full, only set while it's filling up."})
+	systeminfo.RegisterMetric("disk.growth_bytes_per_second", systeminfo.MetricInfo{Type: systeminfo.Gauge, Unit: "bytes_per_second", Help: "Usage growth of the filesystem over the forecast window."})
+	systeminfo.RegisterMetric("disk.forecast_confidence", systeminfo.MetricInfo{Type: systeminfo.Gauge, Help: "Confidence in the time to full estimate, from 0 to 1."})
+}
+
+// Usage trend of a filesystem
+type DiskForecast struct {
+	Mountpoint string
+	Fstype     string
+	Ready      bool          // Enough history to estimate
+	Growth     float64       // Bytes per second, negative when freeing space
+	TimeToFull time.Duration // 0 when it isn't filling up
+	Confidence float64       // 0 to 1, how linear and long the history is
+}
+
+// Reports whether the filesystem is expected to fill within horizon
+func (f DiskForecast) FullWithin(horizon time.Duration) bool {
+	return f.Ready && f.TimeToFull > 0 && f.TimeToFull <= horizon
+}
+
+// Word describing a confidence: low, medium or high
+func ConfidenceLabel(c float64) string {
+	switch {
+	case c >= 0.8:
+		return "high"
+	case c >= 0.5:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// Free space history of a filesystem
+type diskTrend struct {
+	mountpoint string
+	fstype     string
+	points     []systeminfo.Point // Free bytes, at most one per forecastEvery
+	free       float64            // Latest free bytes
+	seen       time.Time          // Time of the latest sample
+}
+
+// Keeps the free space of every filesystem over a window and fits a
+// growth trend on it to estimate when each one will be full
+type DiskForecaster struct {
+	window time.Duration
+	trends map[string]*diskTrend // By mountpoint and fstype
+}
+
+func NewDiskForecaster(window time.Duration) *DiskForecaster {
+	if window <= 0 {
+		window = DefaultForecastWindow
+	}
+	return &DiskForecaster{window: window, trends: map[string]*diskTrend{}}
+}
+
+// Window of usage history the trends are fitted on
+func (f *DiskForecaster) Window() time.Duration {
+	return f.window
+}
+
+// Adds the disks of a sample, pseudo filesystems without a size are skipped
+// Filesystems missing from the sample for a whole window are forgotten
+func (f *DiskForecaster) Observe(t time.Time, disks []systeminfo.DiskInfo) {
+	for _, d := range disks {
+		if d.Total == 0 {
+			continue
+		}
+		f.Add(d.Partition.Mountpoint, d.Partition.Fstype, t, float64(d.Free))
+	}
+	for k, tr := range f.trends {
+		if t.Sub(tr.seen) > f.window {
+			delete(f.trends, k)
+		}
+	}
+}
+
+// Adds a free space sample of a filesystem, e.g. from stored history
+// Samples must come in time order
+func (f *DiskForecaster) Add(mountpoint, fstype string, t time.Time, free float64) {
+	key := mountpoint + "\x00" + fstype
+	tr := f.trends[key]
+	if tr == nil {
+		tr = &diskTrend{mountpoint: mountpoint, fstype: fstype}
+		f.trends[key] = tr
+	}
+	if t.Before(tr.seen) {
+		return
+	}
+	tr.free, tr.seen = free, t
+
+	if n := len(tr.points); n == 0 || t.Sub(tr.points[n-1].Time) >= forecastEvery {
+		tr.points = append(tr.points, systeminfo.Point{Time: t, Value: free})
+	}
+	cut := 0
+	for cut < len(tr.points) && t.Sub(tr.points[cut].Time) > f.window {
+		cut++
+	}
+	tr.points = tr.points[cut:]
+}
+
+// Forgets every sample, e.g. when a replay seeks
+func (f *DiskForecaster) Reset() {
+	f.trends = map[string]*diskTrend{}
+}
+
+// Current estimate of every filesystem, sorted by mountpoint
+func (f *DiskForecaster) Forecasts() []DiskForecast {
+	out := make([]DiskForecast, 0, len(f.trends))
+	for _, tr := range f.trends {
+		out = append(out, tr.forecast())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Mountpoint != out[j].Mountpoint {
+			return out[i].Mountpoint < out[j].Mountpoint
+		}
+		return out[i].Fstype < out[j].Fstype
+	})
+	return out
+}
+
+// Estimate of a single filesystem
+func (f *DiskForecaster) Forecast(mountpoint, fstype string) (DiskForecast, bool) {
+	tr, ok := f.trends[mountpoint+"\x00"+fstype]
+	if !ok {
+		return DiskForecast{}, false
+	}
+	return tr.forecast(), true
+}
+
+func (tr *diskTrend) forecast() DiskForecast {
+	fc := DiskForecast{Mountpoint: tr.mountpoint, Fstype: tr.fstype}
+	if len(tr.points) < minForecastPts {
+		return fc
+	}
+	span := tr.points[len(tr.points)-1].Time.Sub(tr.points[0].Time)
+	if span < minForecastSpan {
+		return fc
+	}
+	l, ok := fitLine(tr.points)
+	if !ok {
+		return fc
+	}
+
+	fc.Ready = true
+	if l.Slope != 0 {
+		fc.Growth = -l.Slope // Free space shrinking is usage growing
+	}
+	// A short history can look linear by chance, so it weighs in
+	fc.Confidence = l.R2 * math.Min(1, float64(span)/float64(confidentSpan))
+	if fc.Growth > 0 {
+		secs := tr.free / fc.Growth
+		if secs < maxTimeToFull.Seconds() {
+			fc.TimeToFull = time.Duration(secs * float64(time.Second))
+		}
+	}
+	return fc
+}
+
+// Metrics of the estimates, for alerting and export
+// The time to full is only set for filesystems filling up
+func ForecastMetrics(forecasts []DiskForecast) []systeminfo.Metric {
+	var metrics []systeminfo.Metric
+	for _, fc := range forecasts {
+		if !fc.Ready {
+			continue
+		}
+		labels := map[string]string{"mountpoint": fc.Mountpoint, "fstype": fc.Fstype}
+		metrics = append(metrics,
+			systeminfo.Metric{Name: "disk.growth_bytes_per_second", Labels: labels, Value: fc.Growth},
+			systeminfo.Metric{Name: "disk.forecast_confidence", Labels: labels, Value: fc.Confidence},
+		)
+		if fc.TimeToFull > 0 {
+			metrics = append(metrics, systeminfo.Metric{Name: "disk.time_to_full_seconds", Labels: labels, Value: fc.TimeToFull.Seconds()})
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,184 @@
+package analysis
+
+import (
+	"github/iegpeppino/syspulse/systeminfo"
+	"sort"
+	"time"
+)
+
+// Default span of RSS history a process is judged on
+const DefaultLeakWindow = 30 * time.Minute
+
+// Limits of the leak detection
+const (
+	leakEvery     = 10 * time.Second // Least time between kept samples
+	minLeakSpan   = 10 * time.Minute // History needed before judging a process
+	minLeakPoints = 20
+	leakScore     = 2.33    // Mann-Kendall score of a rising trend at the 1% level
+	minLeakGrowth = 4 << 20 // Bytes the RSS must have grown over the history
+	minLeakRatio  = 0.05    // Share of its early RSS it must have grown by
+)
+
+// Process whose resident memory keeps growing
+type LeakSuspect struct {
+	PID     int32
+	Name    string
+	RSS     uint64
+	Growth  float64       // Bytes per second, robust to spikes
+	Score   float64       // Strength of the trend, past 2.33 it's significant
+	Watched time.Duration // History the verdict is based on
+
+	// Time until the growth eats all the memory available now,
+	// 0 when the available memory is unknown
+	TimeToLimit time.Duration
+}
+
+// Identity of a process, the start time tells apart reused PIDs
+type procKey struct {
+	pid     int32
+	started int64
+}
+
+// RSS history of a process
+type procTrend struct {
+	name    string
+	points  []systeminfo.Point
+	rss     uint64
+	suspect *LeakSuspect // Verdict of the last test, nil when not growing
+}
+
+// Tracks the RSS of every process over a window and flags the ones
+// with a sustained rising trend: a Mann-Kendall test tells a steady
+// climb from noise, and a Theil-Sen slope measures it
+type LeakDetector struct {
+	window    time.Duration
+	procs     map[procKey]*procTrend
+	available uint64
+}
+
+func NewLeakDetector(window time.Duration) *LeakDetector {
+	if window <= 0 {
+		window = DefaultLeakWindow
+	}
+	return &LeakDetector{window: window, procs: map[procKey]*procTrend{}}
+}
+
+// Window of RSS history processes are judged on
+func (d *LeakDetector) Window() time.Duration {
+	return d.window
+}
+
+// Number of processes tracked
+func (d *LeakDetector) Watching() int {
+	return len(d.procs)
+}
+
+// Adds the processes of a sample along with the memory available
+// Processes missing from it are taken as exited and forgotten
+func (d *LeakDetector) Observe(t time.Time, procs []systeminfo.ProcessSample, available uint64) {
+	d.available = available
+	seen := make(map[procKey]bool, len(procs))
+	for _, p := range procs {
+		key := procKey{p.PID, p.Started.Unix()}
+		seen[key] = true
+		tr := d.procs[key]
+		if tr == nil {
+			tr = &procTrend{}
+			d.procs[key] = tr
+		}
+		tr.name, tr.rss = p.Name, p.RSS
+
+		if n := len(tr.points); n > 0 && t.Sub(tr.points[n-1].Time) < leakEvery {
+			continue
+		}
+		tr.points = append(tr.points, systeminfo.Point{Time: t, Value: float64(p.RSS)})
+		cut := 0
+		for cut < len(tr.points) && t.Sub(tr.points[cut].Time) > d.window {
+			cut++
+		}
+		tr.points = tr.points[cut:]
+		tr.suspect = tr.test(p.PID)
+	}
+	for key := range d.procs {
+		if !seen[key] {
+			delete(d.procs, key)
+		}
+	}
+}
+
+// Forgets every process, e.g. when a replay seeks
+func (d *LeakDetector) Reset() {
+	d.procs = map[procKey]*procTrend{}
+}
+
+// Tests the history of a process for a leak
+func (tr *procTrend) test(pid int32) *LeakSuspect {
+	n := len(tr.points)
+	if n < minLeakPoints {
+		return nil
+	}
+	span := tr.points[n-1].Time.Sub(tr.points[0].Time)
+	if span < minLeakSpan {
+		return nil
+	}
+	// Cheap check first, most processes are flat: the last quarter
+	// of the history must sit well above the first one
+	before, after := meanValue(tr.points[:n/4]), meanValue(tr.points[n-n/4:])
+	if grown := after - before; grown < minLeakGrowth || grown < before*minLeakRatio {
+		return nil
+	}
+	score := mannKendall(tr.points)
+	if score < leakScore {
+		return nil
+	}
+	growth := theilSen(tr.points)
+	if growth <= 0 {
+		return nil
+	}
+	return &LeakSuspect{PID: pid, Name: tr.name, Growth: growth, Score: score, Watched: span}
+}
+
+// Current suspects, fastest growing first
+func (d *LeakDetector) Suspects() []LeakSuspect {
+	var out []LeakSuspect
+	for _, tr := range d.procs {
+		if tr.suspect != nil {
+			out = append(out, d.complete(tr))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Growth != out[j].Growth {
+			return out[i].Growth > out[j].Growth
+		}
+		return out[i].PID < out[j].PID
+	})
+	return out
+}
+
+// Verdict on a process, false when it isn't a suspect
+func (d *LeakDetector) Suspect(pid int32) (LeakSuspect, bool) {
+	for key, tr := range d.procs {
+		if key.pid == pid && tr.suspect != nil {
+			return d.complete(tr), true
+		}
+	}
+	return LeakSuspect{}, false
+}
+
+// Fills the latest RSS and projection of a suspect
+func (d *LeakDetector) complete(tr *procTrend) LeakSuspect {
+	s := *tr.suspect
+	s.Name, s.RSS = tr.name, tr.rss
+	if d.available > 0 {
+		s.TimeToLimit = time.Duration(float64(d.available) / s.Growth * float64(time.Second))
+	}
+	return s
+}
+
+func meanValue(points []systeminfo.Point) float64 {
+	sum := 0.0
+	for _, p := range points {
+		sum += p.Value
+	}
+	return sum / float64(len(points))
+}
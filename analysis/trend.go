@@ -0,0 +1,121 @@
+package analysis
+
+import (
+	"github/iegpeppino/syspulse/systeminfo"
+	"math"
+	"sort"
+)
+
+// Least squares line through points, value = Intercept + Slope*seconds
+// since the first point
+type line struct {
+	Slope     float64 // Change per second
+	Intercept float64
+	R2        float64 // Share of the variance the line explains, 0 to 1
+}
+
+// Fits a line through the points, which must span some time
+// A flat series has a zero slope and an R2 of 1
+func fitLine(points []systeminfo.Point) (line, bool) {
+	n := float64(len(points))
+	if len(points) < 2 || !points[len(points)-1].Time.After(points[0].Time) {
+		return line{}, false
+	}
+	start := points[0].Time
+
+	var sx, sy float64
+	for _, p := range points {
+		sx += p.Time.Sub(start).Seconds()
+		sy += p.Value
+	}
+	mx, my := sx/n, sy/n
+
+	var sxx, sxy, syy float64
+	for _, p := range points {
+		dx, dy := p.Time.Sub(start).Seconds()-mx, p.Value-my
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return line{}, false
+	}
+
+	l := line{Slope: sxy / sxx, R2: 1}
+	l.Intercept = my - l.Slope*mx
+	if syy > 0 {
+		l.R2 = sxy * sxy / (sxx * syy)
+	}
+	return l, true
+}
+
+// Mann-Kendall test for a monotonic trend, robust to noise and outliers
+// since it only compares the order of values
+// Returns the normal score of the trend, positive when rising; past
+// about 2.33 a rising trend is significant at the 1% level
+func mannKendall(points []systeminfo.Point) float64 {
+	n := len(points)
+	if n < 3 {
+		return 0
+	}
+	s := 0
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			switch d := points[j].Value - points[i].Value; {
+			case d > 0:
+				s++
+			case d < 0:
+				s--
+			}
+		}
+	}
+
+	// Variance, corrected for tied values
+	ties := map[float64]int{}
+	for _, p := range points {
+		ties[p.Value]++
+	}
+	nf := float64(n)
+	variance := nf * (nf - 1) * (2*nf + 5)
+	for _, t := range ties {
+		if t > 1 {
+			tf := float64(t)
+			variance -= tf * (tf - 1) * (2*tf + 5)
+		}
+	}
+	variance /= 18
+	if variance <= 0 {
+		return 0
+	}
+
+	switch {
+	case s > 0:
+		return float64(s-1) / math.Sqrt(variance)
+	case s < 0:
+		return float64(s+1) / math.Sqrt(variance)
+	}
+	return 0
+}
+
+// Theil-Sen slope: the median of the slopes between every pair of
+// points, per second, which a few outliers can't drag
+func theilSen(points []systeminfo.Point) float64 {
+	var slopes []float64
+	for i := 0; i < len(points)-1; i++ {
+		for j := i + 1; j < len(points); j++ {
+			dt := points[j].Time.Sub(points[i].Time).Seconds()
+			if dt > 0 {
+				slopes = append(slopes, (points[j].Value-points[i].Value)/dt)
+			}
+		}
+	}
+	if len(slopes) == 0 {
+		return 0
+	}
+	sort.Float64s(slopes)
+	mid := len(slopes) / 2
+	if len(slopes)%2 == 0 {
+		return (slopes[mid-1] + slopes[mid]) / 2
+	}
+	return slopes[mid]
+}
@@ -0,0 +1,171 @@
+package analysis
+
+import (
+	"github/iegpeppino/syspulse/systeminfo"
+	"math"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Points step apart from t0
+func series(step time.Duration, values ...float64) []systeminfo.Point {
+	points := make([]systeminfo.Point, len(values))
+	for i, v := range values {
+		points[i] = systeminfo.Point{Time: t0.Add(time.Duration(i) * step), Value: v}
+	}
+	return points
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestFitLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []systeminfo.Point
+		want   line
+		ok     bool
+	}{
+		{"exact", series(10*time.Second, 10, 12, 14, 16), line{Slope: 0.2, Intercept: 10, R2: 1}, true},
+		{"falling", series(time.Minute, 600, 480, 360), line{Slope: -2, Intercept: 600, R2: 1}, true},
+		{"flat", series(10*time.Second, 5, 5, 5), line{Slope: 0, Intercept: 5, R2: 1}, true},
+		{"noisy", series(10*time.Second, 0, 2, 1, 3), line{Slope: 0.08, Intercept: 0.3, R2: 0.64}, true},
+		{"no trend", series(10*time.Second, 0, 10, 0), line{Slope: 0, Intercept: 10.0 / 3, R2: 0}, true},
+		{"single point", series(time.Second, 1), line{}, false},
+		{"no time span", series(0, 1, 2, 3), line{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := fitLine(tt.points)
+		if ok != tt.ok {
+			t.Errorf("%s: fitLine() ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if !near(got.Slope, tt.want.Slope) || !near(got.Intercept, tt.want.Intercept) || !near(got.R2, tt.want.R2) {
+			t.Errorf("%s: fitLine() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiskForecast(t *testing.T) {
+	tests := []struct {
+		name  string
+		step  time.Duration
+		free  []float64
+		ready bool
+		ttf   time.Duration
+	}{
+		// 1000 bytes used per minute, 90000 left
+		{"filling up", time.Minute, []float64{100000, 99000, 98000, 97000, 96000, 95000, 94000, 93000, 92000, 91000, 90000}, true, 90 * time.Minute},
+		{"freeing space", time.Minute, []float64{90000, 91000, 92000, 93000, 94000, 95000}, true, 0},
+		{"steady", time.Minute, []float64{5000, 5000, 5000, 5000, 5000, 5000}, true, 0},
+		{"too short", time.Minute, []float64{5000, 4000, 3000, 2000}, false, 0},
+		// Samples closer than forecastEvery are skipped
+		{"too dense", 10 * time.Second, []float64{6, 5, 4, 3, 2, 1, 0, 0, 0, 0}, false, 0},
+	}
+	for _, tt := range tests {
+		f := NewDiskForecaster(time.Hour)
+		for i, free := range tt.free {
+			f.Add("/", "ext4", t0.Add(time.Duration(i)*tt.step), free)
+		}
+		fc, ok := f.Forecast("/", "ext4")
+		if !ok {
+			t.Fatalf("%s: no forecast for /", tt.name)
+		}
+		if fc.Ready != tt.ready || (fc.TimeToFull-tt.ttf).Abs() > time.Second {
+			t.Errorf("%s: forecast = %+v, want ready %v and full in %v", tt.name, fc, tt.ready, tt.ttf)
+		}
+	}
+
+	// A short history can't be fully trusted even when perfectly linear
+	f := NewDiskForecaster(time.Hour)
+	for i := 0; i <= 10; i++ {
+		f.Add("/", "ext4", t0.Add(time.Duration(i)*time.Minute), float64(100000-1000*i))
+	}
+	if fc, _ := f.Forecast("/", "ext4"); !near(fc.Confidence, 10.0/60) {
+		t.Errorf("confidence over 10 minutes = %v, want %v", fc.Confidence, 10.0/60)
+	}
+}
+
+func TestMannKendall(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []systeminfo.Point
+		want   float64
+	}{
+		// S = 10, variance = 5*4*15/18
+		{"rising", series(time.Second, 1, 2, 3, 4, 5), 9 / math.Sqrt(300.0/18)},
+		{"falling", series(time.Second, 5, 4, 3, 2, 1), -9 / math.Sqrt(300.0/18)},
+		// S = 8, two pairs of ties take 2*(2*1*9) off the variance
+		{"ties", series(time.Second, 1, 1, 2, 2, 3), 7 / math.Sqrt(264.0/18)},
+		{"flat", series(time.Second, 4, 4, 4, 4, 4), 0},
+		{"up and down", series(time.Second, 1, 2, 3, 2, 1), 0},
+		// Only the order counts, the spike weighs like any other rise
+		{"noisy rise", series(time.Second, 1, 3, 2, 4, 100, 5), 10 / math.Sqrt(6*5*17.0/18)},
+		{"too short", series(time.Second, 1, 2), 0},
+	}
+	for _, tt := range tests {
+		if got := mannKendall(tt.points); !near(got, tt.want) {
+			t.Errorf("%s: mannKendall() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTheilSen(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []systeminfo.Point
+		want   float64
+	}{
+		{"line", series(10*time.Second, 0, 2, 4, 6), 0.2},
+		{"outlier", series(time.Second, 0, 1, 2, 100, 4), 1},
+		{"even number of slopes", series(time.Second, 0, 1, 3, 6), 2},
+		{"flat", series(time.Second, 3, 3, 3), 0},
+		{"no time span", series(0, 1, 2, 3), 0},
+		{"single point", series(time.Second, 1), 0},
+	}
+	for _, tt := range tests {
+		if got := theilSen(tt.points); !near(got, tt.want) {
+			t.Errorf("%s: theilSen() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLeakDetector(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		name    string
+		samples int // 10 seconds apart
+		rss     func(i int) uint64
+		suspect bool
+	}{
+		{"steady growth", 91, func(i int) uint64 { return 100*mb + uint64(i)*mb }, true},
+		{"noisy growth", 91, func(i int) uint64 { return 100*mb + uint64(i)*mb + uint64(i%3)*5*mb }, true},
+		{"flat", 91, func(i int) uint64 { return 100 * mb }, false},
+		{"noisy but flat", 91, func(i int) uint64 { return 100*mb + uint64(i%4)*10*mb }, false},
+		{"growth too small", 91, func(i int) uint64 { return 100*mb + uint64(i)*mb/100 }, false},
+		{"history too short", 30, func(i int) uint64 { return 100*mb + uint64(i)*mb }, false},
+	}
+	for _, tt := range tests {
+		d := NewLeakDetector(time.Hour)
+		for i := 0; i < tt.samples; i++ {
+			d.Observe(t0.Add(time.Duration(i)*10*time.Second), []systeminfo.ProcessSample{{PID: 42, Name: "app", RSS: tt.rss(i)}}, 1<<30)
+		}
+		s, ok := d.Suspect(42)
+		if ok != tt.suspect {
+			t.Errorf("%s: suspect = %v (%+v), want %v", tt.name, ok, s, tt.suspect)
+		}
+	}
+
+	// The growth is measured per second and projected on the available memory
+	d := NewLeakDetector(time.Hour)
+	for i := 0; i < 91; i++ {
+		d.Observe(t0.Add(time.Duration(i)*10*time.Second), []systeminfo.ProcessSample{{PID: 42, Name: "app", RSS: 100*mb + uint64(i)*mb}}, 1<<30)
+	}
+	s, _ := d.Suspect(42)
+	if !near(s.Growth, mb/10.0) || (s.TimeToLimit-10240*time.Second).Abs() > time.Second {
+		t.Errorf("suspect = %+v, want %v bytes/s and %v to the limit", s, mb/10.0, 10240*time.Second)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/analysis"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/systeminfo"
+	"github/iegpeppino/syspulse/tsdb"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Builds the anomaly detector set in the config, nil when no metric is watched
+func newAnomalyDetector(cfg config.Anomalies) (*analysis.AnomalyDetector, error) {
+	if cfg.Metrics != nil && len(cfg.Metrics) == 0 {
+		return nil, nil
+	}
+	if cfg.Sigma < 0 {
+		return nil, fmt.Errorf("anomalies: invalid sigma %g", cfg.Sigma)
+	}
+	var halfLife time.Duration
+	if cfg.HalfLife != "" {
+		var err error
+		if halfLife, err = tsdb.ParseDuration(cfg.HalfLife); err != nil || halfLife == 0 {
+			return nil, fmt.Errorf("anomalies: invalid half life %q", cfg.HalfLife)
+		}
+	}
+	return analysis.NewAnomalyDetector(analysis.AnomalyOptions{
+		Sigma:    cfg.Sigma,
+		HalfLife: halfLife,
+		Seasonal: cfg.Seasonal,
+		Metrics:  cfg.Metrics,
+	}), nil
+}
+
+// Scores the metrics of a sample against their baselines and returns
+// them with the scores added. Anomalies starting or ending are logged
+// unless quiet (replays)
+func anomalyMetrics(d *analysis.AnomalyDetector, t time.Time, metrics []systeminfo.Metric, quiet bool) []systeminfo.Metric {
+	if d == nil {
+		return metrics
+	}
+	for _, e := range d.Observe(t, metrics) {
+		if !quiet {
+			logAnomaly(e)
+		}
+	}
+	return append(metrics, d.Metrics()...)
+}
+
+func logAnomaly(e analysis.AnomalyEvent) {
+	attrs := []any{
+		slog.String("source", "anomaly"),
+		slog.String("series", e.Series),
+		slog.Float64("value", e.Value),
+		slog.Float64("expected", e.Expected),
+		slog.String("score", fmt.Sprintf("%+.1fσ", e.Score)),
+	}
+	if e.Start {
+		logger.Logger.Warn("Anomaly detected", attrs...)
+	} else {
+		logger.Logger.Info("Anomaly ended", attrs...)
+	}
+}
+
+// Which of n buckets spanning the chart window hold anomalous readings
+// of a series, nil when there are none
+func (m model) anomalyBuckets(name string, labels map[string]string, n int) []bool {
+	if m.anomalies == nil || n <= 0 {
+		return nil
+	}
+	from := m.sampleTime.Add(-m.chartWindow())
+	marks := m.anomalies.Marks(name, labels, from, m.sampleTime)
+	if len(marks) == 0 {
+		return nil
+	}
+	span := m.sampleTime.Sub(from)
+	buckets := make([]bool, n)
+	for _, t := range marks {
+		i := int(float64(t.Sub(from)) / float64(span) * float64(n))
+		buckets[min(max(i, 0), n-1)] = true
+	}
+	return buckets
+}
+
+// Row of markers under a chart pointing at its anomalous readings
+func anomalyMarkers(buckets []bool, width int) string {
+	var b strings.Builder
+	for i := 0; i < width; i++ {
+		if i < len(buckets) && buckets[i] {
+			b.WriteRune('▴')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return lipgloss.NewStyle().Foreground(currentTheme.critical).Render(b.String())
+}
+
+// Sparkline with its anomalous buckets highlighted
+func markedSparkline(values []float64, buckets []bool, lo, hi float64) string {
+	line := lipgloss.NewStyle().Foreground(currentTheme.accent)
+	if buckets == nil {
+		return line.Render(sparkline(values, lo, hi))
+	}
+	mark := lipgloss.NewStyle().Foreground(currentTheme.critical)
+	var b strings.Builder
+	runes := []rune(sparkline(values, lo, hi))
+	for i := 0; i < len(runes); {
+		// Render runs of the same style together
+		j := i
+		for j < len(runes) && buckets[j] == buckets[i] {
+			j++
+		}
+		style := line
+		if buckets[i] {
+			style = mark
+		}
+		b.WriteString(style.Render(string(runes[i:j])))
+		i = j
+	}
+	return b.String()
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Time spans the charts can show, cycled with the window key
+var chartWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour}
+
+// Points kept per series, an hour of samples at the TUI rate
+const historyCapacity = 3600
+
+// Narrowest chart panel worth drawing
+const minChartWidth = 24
+
+// Sparkline levels, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// Window shown by the charts
+func (m model) chartWindow() time.Duration {
+	return chartWindows[m.windowIdx]
+}
+
+// Switches the charts to the next window
+func (m *model) cycleWindow() {
+	m.windowIdx = (m.windowIdx + 1) % len(chartWindows)
+}
+
+// Points of a series inside the chart window, which ends at the sample shown
+func (m model) series(name string, labels map[string]string) []systeminfo.Point {
+	if m.history == nil {
+		return nil
+	}
+	return m.history.Range(name, labels, m.sampleTime.Add(-m.chartWindow()), m.sampleTime)
+}
+
+// Averages points into n buckets evenly spanning from..to,
+// empty buckets are NaN
+func bucketize(points []systeminfo.Point, from, to time.Time, n int) []float64 {
+	sums := make([]float64, n)
+	counts := make([]int, n)
+	span := to.Sub(from)
+	for _, p := range points {
+		i := n - 1
+		if span > 0 {
+			i = int(float64(p.Time.Sub(from)) / float64(span) * float64(n))
+		}
+		i = min(max(i, 0), n-1)
+		sums[i] += p.Value
+		counts[i]++
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = math.NaN()
+		if counts[i] > 0 {
+			values[i] = sums[i] / float64(counts[i])
+		}
+	}
+	return values
+}
+
+// Position of v between lo and hi as a level from 0 to levels-1
+func level(v, lo, hi float64, levels int) int {
+	if hi <= lo {
+		return levels / 2
+	}
+	l := int(math.Round((v - lo) / (hi - lo) * float64(levels-1)))
+	return min(max(l, 0), levels-1)
+}
+
+// One character per value, scaled between lo and hi
+// Gaps in the data are left blank
+func sparkline(values []float64, lo, hi float64) string {
+	var b strings.Builder
+	for _, v := range values {
+		if math.IsNaN(v) {
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteRune(sparkBlocks[level(v, lo, hi, len(sparkBlocks))])
+	}
+	return b.String()
+}
+
+// Braille dot bits of a cell, by dot row (top first) and column
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// Line chart drawn with braille dots, each cell holds 2x4 dots so
+// values should hold twice as many entries as the chart is wide
+// The average is overlaid as a dotted line
+func brailleChart(values []float64, rows int, lo, hi, avg float64) []string {
+	width := (len(values) + 1) / 2
+	dots := rows * 4
+	grid := make([][]rune, rows)
+	for i := range grid {
+		grid[i] = make([]rune, width)
+	}
+
+	set := func(x, y int) {
+		row := dots - 1 - y // y counts from the bottom
+		grid[row/4][x/2] |= brailleDots[row%4][x%2]
+	}
+
+	prev := -1
+	for x, v := range values {
+		if x%6 == 0 && !math.IsNaN(avg) {
+			set(x, level(avg, lo, hi, dots))
+		}
+		if math.IsNaN(v) {
+			prev = -1
+			continue
+		}
+		y := level(v, lo, hi, dots)
+		// Join consecutive values so steep changes stay a line
+		from, to := y, y
+		if prev >= 0 {
+			from, to = min(prev, y), max(prev, y)
+		}
+		for yy := from; yy <= to; yy++ {
+			set(x, yy)
+		}
+		prev = y
+	}
+
+	lines := make([]string, rows)
+	for i, row := range grid {
+		for x := range row {
+			row[x] += 0x2800
+		}
+		lines[i] = string(row)
+	}
+	return lines
+}
+
+// Chart of a percent series with its min/avg/max over the window
+func (m model) renderChart(title, name string, labels map[string]string, width, rows int) string {
+	points := m.series(name, labels)
+	window := m.chartWindow()
+	stats := systeminfo.Summarize(points)
+
+	avg := math.NaN()
+	if stats.Count > 0 {
+		avg = stats.Avg
+	}
+	values := bucketize(points, m.sampleTime.Add(-window), m.sampleTime, width*2)
+	lines := brailleChart(values, rows, 0, 100, avg)
+
+	line := lipgloss.NewStyle().Foreground(currentTheme.accent)
+	muted := lipgloss.NewStyle().Foreground(currentTheme.muted)
+	for i := range lines {
+		axis := "    "
+		switch i {
+		case 0:
+			axis = "100%"
+		case rows - 1:
+			axis = "  0%"
+		}
+		lines[i] = muted.Render(axis+"┤") + line.Render(lines[i])
+	}
+
+	// Anomalous readings are pointed at under the chart
+	if m.anomalies != nil {
+		lines = append(lines, "     "+anomalyMarkers(m.anomalyBuckets(name, labels, width), width))
+	}
+
+	header := lipgloss.NewStyle().Bold(true).Foreground(currentTheme.text).Render(title) +
+		muted.Render(fmt.Sprintf("  last %s", formatWindow(window)))
+	return lipgloss.JoinVertical(lipgloss.Left,
+		header,
+		strings.Join(lines, "\n"),
+		muted.Render("     "+formatStats(stats, "%.1f%%")),
+	)
+}
+
+// Labelled sparkline of a series, scaled to its own range so small
+// changes stay visible, followed by its min/avg/max
+// Anomalous readings are highlighted
+func (m model) sparkRow(label, name string, labels map[string]string, width int, format string) string {
+	points := m.series(name, labels)
+	stats := systeminfo.Summarize(points)
+	values := bucketize(points, m.sampleTime.Add(-m.chartWindow()), m.sampleTime, width)
+
+	return fmt.Sprintf("%-8s %s  %s",
+		label,
+		markedSparkline(values, m.anomalyBuckets(name, labels, width), stats.Min, stats.Max),
+		lipgloss.NewStyle().Foreground(currentTheme.muted).Render(formatStats(stats, format)),
+	)
+}
+
+// "min x avg y max z", or a placeholder before the first sample
+func formatStats(s systeminfo.Stats, format string) string {
+	if s.Count == 0 {
+		return "no data yet"
+	}
+	return fmt.Sprintf("min "+format+"  avg "+format+"  max "+format, s.Min, s.Avg, s.Max)
+}
+
+// Short label of a window: 1m, 15m, 1h
+func formatWindow(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+// Width of the chart panel drawn beside a tab's table,
+// 0 when the terminal is too narrow for it
+func (m model) chartWidth(left string) int {
+	w := min(m.width-lipgloss.Width(left)-14, 60)
+	if w < minChartWidth {
+		return 0
+	}
+	return w
+}
+
+// Charts of the CPU tab: total usage and the share of every mode
+// between samples
+func (m model) cpuCharts(width int) string {
+	rows := []string{m.renderChart("CPU TOTAL", "cpu.percent", nil, width, 6), ""}
+	rows = append(rows, lipgloss.NewStyle().Bold(true).Foreground(currentTheme.text).Render("MODES"))
+	for _, mode := range []string{"user", "system", "idle", "nice", "iowait", "irq", "softirq", "steal", "guest"} {
+		rows = append(rows, m.sparkRow(mode, "cpu.mode_percent", map[string]string{"mode": mode}, max(width-40, 8), "%.1f"))
+	}
+	return chartPanel.Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+}
+
+// Charts of the MEMORY tab: memory used and swap
+func (m model) memCharts(width int) string {
+	return chartPanel.Render(lipgloss.JoinVertical(lipgloss.Left,
+		m.renderChart("MEMORY USED", "memory.used_percent", nil, width, 6),
+		"",
+		m.renderChart("SWAP USED", "swap.used_percent", nil, width, 4),
+	))
+}
+
+// Usage trend of every filesystem of the DISK tab
+func (m model) diskCharts(width int) string {
+	rows := []string{
+		lipgloss.NewStyle().Bold(true).Foreground(currentTheme.text).Render("DISK USAGE") +
+			lipgloss.NewStyle().Foreground(currentTheme.muted).Render("  last "+formatWindow(m.chartWindow())),
+	}
+	for _, d := range m.disk {
+		if d.Total == 0 {
+			continue // Pseudo filesystems have no usage to chart
+		}
+		label := []rune(d.Partition.Mountpoint)
+		if len(label) > 8 {
+			label = append([]rune("…"), label[len(label)-7:]...)
+		}
+		labels := map[string]string{"mountpoint": d.Partition.Mountpoint, "fstype": d.Partition.Fstype}
+		rows = append(rows, m.sparkRow(string(label), "disk.used_percent", labels, max(width-43, 8), "%.1f%%"))
+	}
+	return chartPanel.Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+}
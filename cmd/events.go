@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/systeminfo"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Columns of the EVENTS table
+var eventColumns = []table.Column{
+	{Title: "Time", Width: 10},
+	{Title: "Event", Width: 6},
+	{Title: "PID", Width: 8},
+	{Title: "PPID", Width: 8},
+	{Title: "Name", Width: 20},
+	{Title: "Lifetime", Width: 12},
+	{Title: "Peak CPU", Width: 9},
+	{Title: "Peak RSS", Width: 11},
+	{Title: "Command", Width: 50},
+}
+
+// Processes starting and exiting, shared by the TUI and serve
+type lifecycle struct {
+	tracker *systeminfo.ProcessTracker
+	looping map[string]bool // Names already logged as restarting in a loop
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{tracker: systeminfo.NewProcessTracker(), looping: map[string]bool{}}
+}
+
+// Diffs the processes of a sample with the previous one, logs the
+// names caught in a restart loop and returns the metrics with the
+// start and exit rates added
+// Samples without the full process list (replays) are skipped
+func (l *lifecycle) observe(s systeminfo.Snapshot, metrics []systeminfo.Metric) []systeminfo.Metric {
+	if l == nil || !s.Has(systeminfo.SectionProcesses) || len(s.AllProcesses) == 0 {
+		return metrics
+	}
+	l.tracker.Diff(s.Time, s.AllProcesses)
+
+	looping := map[string]bool{}
+	for _, loop := range l.tracker.RestartLoops(s.Time) {
+		looping[loop.Name] = true
+		if !l.looping[loop.Name] {
+			logger.Logger.Warn("Restart loop detected",
+				slog.String("source", "lifecycle"),
+				slog.String("name", loop.Name),
+				slog.Int("restarts", loop.Restarts),
+				slog.String("within", formatWindow(systeminfo.RestartWindow)))
+		}
+	}
+	l.looping = looping
+
+	return append(metrics, l.tracker.Metrics(s.Time)...)
+}
+
+// Fills the EVENTS table, newest first
+// Events after the sample shown are left out while traveling
+func (m *model) updateEventsTable() {
+	if m.lifecycle == nil {
+		return
+	}
+	events := m.lifecycle.tracker.Events()
+	rows := make([]table.Row, 0, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		if e.Time.After(m.sampleTime) {
+			continue
+		}
+		lifetime := "N/A"
+		if !e.Started.IsZero() {
+			lifetime = formatLifetime(e.Lifetime)
+		}
+		rows = append(rows, table.Row{
+			e.Time.Format("15:04:05"),
+			e.Kind,
+			fmt.Sprint(e.PID),
+			fmt.Sprint(e.PPID),
+			e.Name,
+			lifetime,
+			fmt.Sprintf("%.1f%%", e.PeakCPU),
+			getByteMagnitude(e.PeakRSS),
+			e.Cmdline,
+		})
+	}
+	m.eventsTable.SetRows(rows)
+}
+
+// Lifetime of a process, to the second: <1s, 42s, 3m12s, 5h03m
+func formatLifetime(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return "<1s"
+	case d < time.Hour:
+		return d.Truncate(time.Second).String()
+	default:
+		return formatETA(d)
+	}
+}
+
+// Renders the EVENTS tab content
+func (m model) renderEventsTab() string {
+	title := titleStyle.Render("PROCESS EVENTS")
+	muted := lipgloss.NewStyle().Foreground(currentTheme.muted).MarginLeft(5)
+	if m.replay != nil {
+		return lipgloss.JoinVertical(lipgloss.Left, title,
+			muted.Render("Recordings don't keep every process, events are only tracked live"))
+	}
+	if m.lifecycle == nil {
+		return title
+	}
+
+	starts, exits := m.lifecycle.tracker.Counts(m.sampleTime, time.Minute)
+	summary := fmt.Sprintf("last minute: %d started · %d exited", starts, exits)
+
+	parts := []string{title, muted.Render(summary)}
+	if loops := m.lifecycle.tracker.RestartLoops(m.sampleTime); len(loops) > 0 {
+		var lines []string
+		for _, l := range loops {
+			lines = append(lines, fmt.Sprintf("⟳ %s restarted %d %s in the last %s", l.Name, l.Restarts,
+				plural(l.Restarts, "time", "times"), formatWindow(systeminfo.RestartWindow)))
+		}
+		parts = append(parts, lipgloss.NewStyle().Foreground(currentTheme.critical).MarginLeft(5).Render(strings.Join(lines, "\n")))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, append(parts, baseStyle.Render(m.eventsTable.View()))...)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/export"
+	"github/iegpeppino/syspulse/logger"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Creates the push exporters enabled in the config (Influx, Graphite, OTLP, StatsD)
+// Returns a nil runner when there's none
+func buildExporters(cfg config.Exporters) (*export.Runner, error) {
+	host, _ := os.Hostname()
+	var exporters []export.Exporter
+
+	if c := cfg.Influx; c != nil {
+		batch, err := batchSettings(c.Batch, "influx")
+		if err != nil {
+			return nil, err
+		}
+		tags := map[string]string{"host": host}
+		for k, v := range c.Tags {
+			tags[k] = v
+		}
+		e, err := export.NewInflux(export.InfluxOptions{
+			Output:        c.Output,
+			Token:         c.Token,
+			Prefix:        c.Prefix,
+			Tags:          tags,
+			BatchSize:     c.BatchSize,
+			FlushInterval: batch.interval,
+			BufferPath:    batch.path,
+			BufferMaxSize: batch.maxSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, e)
+	}
+
+	if c := cfg.Graphite; c != nil {
+		batch, err := batchSettings(c.Batch, "graphite")
+		if err != nil {
+			closeExporters(exporters)
+			return nil, err
+		}
+		prefix := c.Prefix
+		if prefix == "" {
+			prefix = "syspulse." + graphiteHost(host)
+		}
+		e, err := export.NewGraphite(export.GraphiteOptions{
+			Address:       c.Address,
+			Protocol:      c.Protocol,
+			Prefix:        prefix,
+			Tags:          c.Tags,
+			Tagged:        c.Tagged,
+			BatchSize:     c.BatchSize,
+			FlushInterval: batch.interval,
+			BufferPath:    batch.path,
+			BufferMaxSize: batch.maxSize,
+		})
+		if err != nil {
+			closeExporters(exporters)
+			return nil, err
+		}
+		exporters = append(exporters, e)
+	}
+
+	if c := cfg.OTLP; c != nil {
+		var timeout time.Duration
+		if c.Timeout != "" {
+			d, err := time.ParseDuration(c.Timeout)
+			if err != nil || d <= 0 {
+				closeExporters(exporters)
+				return nil, fmt.Errorf("otlp: invalid timeout %q", c.Timeout)
+			}
+			timeout = d
+		}
+		e, err := export.NewOTLP(export.OTLPOptions{
+			Endpoint: c.Endpoint,
+			Encoding: c.Encoding,
+			Headers:  c.Headers,
+			Resource: c.Resource,
+			Timeout:  timeout,
+		})
+		if err != nil {
+			closeExporters(exporters)
+			return nil, err
+		}
+		exporters = append(exporters, e)
+	}
+
+	if c := cfg.StatsD; c != nil {
+		prefix := c.Prefix
+		if prefix == "" {
+			prefix = "syspulse"
+		}
+		tags := map[string]string{"host": host}
+		for k, v := range c.Tags {
+			tags[k] = v
+		}
+		e, err := export.NewStatsD(export.StatsDOptions{
+			Address:    c.Address,
+			Flavor:     c.Flavor,
+			Prefix:     prefix,
+			Tags:       tags,
+			SampleRate: c.SampleRate,
+			PacketSize: c.PacketSize,
+		})
+		if err != nil {
+			closeExporters(exporters)
+			return nil, err
+		}
+		exporters = append(exporters, e)
+	}
+
+	if len(exporters) == 0 {
+		return nil, nil
+	}
+	return export.NewRunner(exporters, func(name string, err error) {
+		logger.CollectorError(name, "Export failed", err)
+	}), nil
+}
+
+// Size of the on-disk buffer when the config doesn't set one
+const defaultBufferMB = 50
+
+// Parsed batching settings of an exporter
+type batch struct {
+	interval time.Duration
+	path     string
+	maxSize  int64
+}
+
+func batchSettings(c config.Batch, name string) (batch, error) {
+	var b batch
+	if c.FlushInterval != "" {
+		d, err := time.ParseDuration(c.FlushInterval)
+		if err != nil || d < 0 {
+			return b, fmt.Errorf("%s: invalid flush interval %q", name, c.FlushInterval)
+		}
+		b.interval = d
+	}
+
+	switch {
+	case c.BufferMaxMB < 0:
+		return b, nil // Buffering disabled
+	case c.BufferMaxMB == 0:
+		b.maxSize = defaultBufferMB * 1024 * 1024
+	default:
+		b.maxSize = int64(c.BufferMaxMB) * 1024 * 1024
+	}
+	b.path = c.BufferPath
+	if b.path == "" {
+		dir, err := config.StateDir()
+		if err != nil {
+			return b, fmt.Errorf("%s: %w", name, err)
+		}
+		b.path = filepath.Join(dir, "buffer", name+".buf")
+	}
+	return b, nil
+}
+
+// Dots would split the hostname into several path segments
+func graphiteHost(host string) string {
+	if host == "" {
+		return "unknown"
+	}
+	out := []byte(host)
+	for i, c := range out {
+		if c == '.' {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
+
+func closeExporters(exporters []export.Exporter) {
+	for _, e := range exporters {
+		e.Close()
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/analysis"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/systeminfo"
+	"github/iegpeppino/syspulse/tsdb"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Builds the disk forecaster set in the config, along with the horizon
+// within which filling filesystems are highlighted
+func newDiskForecaster(cfg config.Forecast) (*analysis.DiskForecaster, time.Duration, error) {
+	window, horizon := analysis.DefaultForecastWindow, analysis.DefaultForecastHorizon
+	var err error
+	if cfg.Window != "" {
+		if window, err = tsdb.ParseDuration(cfg.Window); err != nil || window == 0 {
+			return nil, 0, fmt.Errorf("forecast: invalid window %q", cfg.Window)
+		}
+	}
+	if cfg.Horizon != "" {
+		if horizon, err = tsdb.ParseDuration(cfg.Horizon); err != nil || horizon == 0 {
+			return nil, 0, fmt.Errorf("forecast: invalid horizon %q", cfg.Horizon)
+		}
+	}
+	return analysis.NewDiskForecaster(window), horizon, nil
+}
+
+// Fills the forecaster with the free space kept in the on-disk store,
+// so estimates are ready right away instead of after a few minutes
+func seedForecast(f *analysis.DiskForecaster, w *tsdbWriter, now time.Time) {
+	series, err := w.db.Read("1m", now.Add(-f.Window()), now, func(name string, _ map[string]string) bool {
+		return name == "disk.free_bytes"
+	})
+	if err != nil {
+		logger.CollectorError("tsdb", "Reading disk history failed", err)
+		return
+	}
+	for _, s := range series {
+		for _, smp := range s.Samples {
+			f.Add(s.Labels["mountpoint"], s.Labels["fstype"], smp.Time, smp.Avg())
+		}
+	}
+}
+
+// Feeds a sample to the forecaster and returns the metrics with the
+// estimates added
+func forecastMetrics(f *analysis.DiskForecaster, s systeminfo.Snapshot, metrics []systeminfo.Metric) []systeminfo.Metric {
+	if f == nil {
+		return metrics
+	}
+	f.Observe(s.Time, s.Disks)
+	return append(metrics, analysis.ForecastMetrics(f.Forecasts())...)
+}
+
+// Short remaining time: 45m, 5h12m, 3d4h
+func formatETA(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd%dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", d/time.Hour, d%time.Hour/time.Minute)
+	default:
+		return fmt.Sprintf("%dm", max(d/time.Minute, 1))
+	}
+}
+
+// Forecast of a filesystem as shown in the DISK table
+func (m model) forecastCell(d systeminfo.DiskInfo) string {
+	if m.forecaster == nil || d.Total == 0 {
+		return "-"
+	}
+	fc, ok := m.forecaster.Forecast(d.Partition.Mountpoint, d.Partition.Fstype)
+	switch {
+	case !ok || !fc.Ready:
+		return "collecting"
+	case fc.TimeToFull == 0:
+		return "not filling"
+	}
+	cell := fmt.Sprintf("%s (%s)", formatETA(fc.TimeToFull), analysis.ConfidenceLabel(fc.Confidence))
+	if fc.FullWithin(m.forecastHorizon) {
+		cell = "⚠ " + cell
+	}
+	return cell
+}
+
+// Warning lines for the filesystems expected to fill within the horizon
+func (m model) forecastWarnings() string {
+	if m.forecaster == nil {
+		return ""
+	}
+	var lines []string
+	for _, fc := range m.forecaster.Forecasts() {
+		if !fc.FullWithin(m.forecastHorizon) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("⚠ %s expected full in %s, growing %s/h (%s confidence)",
+			fc.Mountpoint, formatETA(fc.TimeToFull), getByteMagnitude(uint64(fc.Growth*3600)), analysis.ConfidenceLabel(fc.Confidence)))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return lipgloss.NewStyle().Bold(true).Foreground(currentTheme.critical).MarginLeft(4).Render(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/systeminfo"
+	"log/slog"
+	"slices"
+	"sort"
+
+	"github.com/charmbracelet/bubbles/table"
+)
+
+// Ways the PROCESSES tab can group processes, cycled with the group key
+// "" lists every process, "rules" needs group rules in the config
+var groupModes = []string{"", "name", "user", "rules"}
+
+// Orders of the PROCESSES tab, cycled with the sort key
+// Only groups can be sorted by I/O and process count
+var sortModes = []string{systeminfo.SortCPU, systeminfo.SortMemory, "io", "count"}
+
+// Group name of processes no rule matches
+const otherGroup = "other"
+
+// Columns of the PROCESSES table while grouping
+var groupColumns = []table.Column{
+	{Title: "Group", Width: 32},
+	{Title: "Procs", Width: 7},
+	{Title: "CPU", Width: 10},
+	{Title: "Memory", Width: 11},
+	{Title: "Read/s", Width: 13},
+	{Title: "Write/s", Width: 13},
+}
+
+// Row of the grouped table: a group, or a member when process is set
+type groupRow struct {
+	group   string
+	process *systeminfo.ProcessSample
+}
+
+func (m model) groupMode() string {
+	return groupModes[m.groupIdx]
+}
+
+func (m model) sortMode() string {
+	return sortModes[m.sortIdx]
+}
+
+// Groups by the next mode, or lists every process again
+func (m *model) cycleGroup() {
+	for {
+		m.groupIdx = (m.groupIdx + 1) % len(groupModes)
+		if m.groupMode() != "rules" || len(m.groupRules) > 0 {
+			break
+		}
+	}
+	if m.groupMode() == "" && m.sortIdx > 1 {
+		m.sortIdx = 0 // Single processes have no I/O or count order
+		m.sortProcesses()
+	}
+	logger.Logger.Info("Process grouping changed", slog.String("source", "user"), slog.String("group", m.groupLabel()))
+	m.setColumns()
+	m.updateTables()
+}
+
+// Sorts the PROCESSES tab by the next order
+func (m *model) cycleSort() {
+	m.sortIdx = (m.sortIdx + 1) % len(sortModes)
+	if m.groupMode() == "" && m.sortIdx > 1 {
+		m.sortIdx = 0
+	}
+	m.sortProcesses()
+	logger.Logger.Info("Process order changed", slog.String("source", "user"), slog.String("sort", m.sortMode()))
+	m.updateTables()
+}
+
+// Re-sorts the listed processes by CPU or memory, the pinned ones stay on top
+// The top processes are picked by the same order from the next sample on
+func (m *model) sortProcesses() {
+	s := m.sortMode()
+	if s != systeminfo.SortCPU && s != systeminfo.SortMemory {
+		return // Groups only
+	}
+	m.collectOpts.SortBy = s
+	m.processes = slices.Clone(m.processes) // Shared with the snapshots kept for time travel
+	top := m.processes[m.pinned:]
+	sort.SliceStable(top, func(i, j int) bool {
+		if s == systeminfo.SortMemory {
+			return top[i].Memory > top[j].Memory
+		}
+		return top[i].CPU > top[j].CPU
+	})
+}
+
+func (m model) groupLabel() string {
+	if m.groupMode() == "" {
+		return "none"
+	}
+	return m.groupMode()
+}
+
+// Group a process belongs to in the current mode
+func (m model) groupOf(p systeminfo.ProcessSample) string {
+	switch m.groupMode() {
+	case "user":
+		if p.User == "" {
+			return "unknown"
+		}
+		return p.User
+	case "rules":
+		for _, r := range m.groupRules {
+			if r.Matches(p.PID, p.Name, p.Cmdline, p.User) {
+				return r.Name
+			}
+		}
+		return otherGroup
+	default:
+		return p.Name
+	}
+}
+
+// Latest CPU and I/O rates of a process from its history, or the ones at
+// the time shown while traveling
+// Untracked processes fall back to their lifetime CPU average, without I/O
+func (m model) current(p systeminfo.ProcessSample) systeminfo.ProcessPoint {
+	if m.traveling {
+		if prev, ok := m.travelPrev.byPID[p.PID]; ok && prev.Started.Equal(p.Started) {
+			return systeminfo.Rated(m.travelPrev.time, prev, m.sampleTime, p)
+		}
+	} else if m.procHistory != nil {
+		if pt, ok := m.procHistory.Latest(p.PID, p.Started); ok {
+			return pt
+		}
+	}
+	return systeminfo.ProcessPoint{CPU: p.CPU, RSS: p.RSS}
+}
+
+// Value a group or process is sorted by, highest first
+func sortValue(mode string, cpu float64, rss uint64, read, write float64, count int) float64 {
+	switch mode {
+	case systeminfo.SortMemory:
+		return float64(rss)
+	case "io":
+		return read + write
+	case "count":
+		return float64(count)
+	default:
+		return cpu
+	}
+}
+
+// Fills the PROCESSES table with the groups, expanded ones followed by their members
+func (m *model) updateGroupRows() {
+	groups := systeminfo.GroupProcesses(m.samples, m.groupOf, m.current)
+	mode := m.sortMode()
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		return sortValue(mode, a.CPU, a.RSS, a.ReadRate, a.WriteRate, len(a.Members)) >
+			sortValue(mode, b.CPU, b.RSS, b.ReadRate, b.WriteRate, len(b.Members))
+	})
+
+	rows := []table.Row{}
+	m.groupRows = nil
+	for _, g := range groups {
+		mark := "▸ "
+		if m.expanded[g.Name] {
+			mark = "▾ "
+		}
+		rows = append(rows, table.Row{
+			mark + g.Name,
+			fmt.Sprint(len(g.Members)),
+			fmt.Sprintf("%.2f%%", g.CPU),
+			getByteMagnitude(g.RSS),
+			formatRate(g.ReadRate),
+			formatRate(g.WriteRate),
+		})
+		m.groupRows = append(m.groupRows, groupRow{group: g.Name})
+		if !m.expanded[g.Name] {
+			continue
+		}
+
+		members := g.Members
+		value := func(p systeminfo.ProcessSample) float64 {
+			pt := m.current(p)
+			return sortValue(mode, pt.CPU, p.RSS, pt.ReadRate, pt.WriteRate, 1)
+		}
+		sort.SliceStable(members, func(i, j int) bool {
+			return value(members[i]) > value(members[j])
+		})
+		for i := range members {
+			p := members[i]
+			pt := m.current(p)
+			rows = append(rows, table.Row{
+				fmt.Sprintf("    %d %s", p.PID, p.Name),
+				"",
+				fmt.Sprintf("%.2f%%", pt.CPU),
+				getByteMagnitude(p.RSS),
+				formatRate(pt.ReadRate),
+				formatRate(pt.WriteRate),
+			})
+			m.groupRows = append(m.groupRows, groupRow{group: g.Name, process: &members[i]})
+		}
+	}
+	m.procTable.SetRows(rows)
+}
+
+// Expands or collapses the selected group
+// Returns false when a process is selected instead
+func (m *model) toggleGroup() bool {
+	i := m.procTable.Cursor()
+	if i < 0 || i >= len(m.groupRows) || m.groupRows[i].process != nil {
+		return false
+	}
+	g := m.groupRows[i].group
+	m.expanded[g] = !m.expanded[g]
+	m.updateTables()
+	return true
+}
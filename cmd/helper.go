@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"github/iegpeppino/syspulse/alert"
+	"github/iegpeppino/syspulse/systeminfo"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/help"
@@ -11,58 +13,95 @@ import (
 
 // Helper functions and structs
 
-// Model Initializer
-func modelInit() model {
-	cpuColumns := []table.Column{
+// Columns of the tables, the statistics ones are added after them
+var (
+	cpuColumns = []table.Column{
 		{Title: "Load", Width: 30},
 		{Title: "Value (%)", Width: 30},
 		{Title: "Delta", Width: 20},
 	}
-
-	cpuTable := initTable(cpuColumns)
-
-	memCols := []table.Column{
+	memColumns = []table.Column{
 		{Title: "Type", Width: 40},
 		{Title: "Value", Width: 40},
 	}
-
-	memTable := initTable(memCols)
-
-	procCols := []table.Column{
+	procColumns = []table.Column{
 		{Title: "PID", Width: 5},
 		{Title: "Name", Width: 25},
 		{Title: "Status", Width: 15},
 		{Title: "Runtime", Width: 20},
 		{Title: "Memory", Width: 10},
 		{Title: "CPU", Width: 10},
+		{Title: "RSS trend", Width: 14},
 	}
-
-	procTable := initTable(procCols)
-
-	diskCols := []table.Column{
+	diskColumns = []table.Column{
 		{Title: "Partition", Width: 25},
 		{Title: "FsType", Width: 20},
 		{Title: "Total", Width: 15},
 		{Title: "Used", Width: 15},
 		{Title: "Free", Width: 15},
+		{Title: "Full in", Width: 18},
 	}
+)
+
+// Model Initializer
+func modelInit(keys keyMap, themes []theme, themeIdx int, rules []alert.Rule) model {
+	cpuTable := initTable(cpuColumns)
 
-	diskTable := initTable(diskCols)
+	memTable := initTable(memColumns)
+
+	procTable := initTable(procColumns)
+
+	diskTable := initTable(diskColumns)
+
+	logCols := []table.Column{
+		{Title: "Time", Width: 10},
+		{Title: "Level", Width: 7},
+		{Title: "Source", Width: 12},
+		{Title: "Message", Width: 40},
+		{Title: "Details", Width: 60},
+	}
+
+	logTable := initTable(logCols)
+
+	eventsTable := initTable(eventColumns)
 
 	m := model{
-		tabs:      []string{"CPU", "MEMORY", "PROCESSES", "DISK"},
-		ActiveTab: 0,
-		keys:      keys,
-		help:      help.New(),
-		cpuTable:  cpuTable,
-		memTable:  memTable,
-		procTable: procTable,
-		diskTable: diskTable,
+		tabs:        []string{"CPU", "MEMORY", "PROCESSES", "DISK", "EVENTS", "LOG"},
+		ActiveTab:   0,
+		keys:        keys,
+		help:        help.New(),
+		themes:      themes,
+		themeIdx:    themeIdx,
+		cpuTable:    cpuTable,
+		memTable:    memTable,
+		procTable:   procTable,
+		diskTable:   diskTable,
+		collectOpts: systeminfo.CollectOptions{TopProcesses: shownProcesses},
+		history:     systeminfo.NewHistory(historyCapacity, chartWindows[len(chartWindows)-1]),
+		pastWindow:  defaultTravelWindow,
+		alerts:      alert.NewEngine(rules),
+		procHistory: systeminfo.NewProcessHistory(),
+		expanded:    map[string]bool{},
+		lifecycle:   newLifecycle(),
+		eventsTable: eventsTable,
+		logTable:    logTable,
 	}
+	m.setTheme(themeIdx)
 
 	return m
 }
 
+// Applies the theme at index i and restyles the tables
+// since they keep a copy of their styles on creation
+func (m *model) setTheme(i int) {
+	m.themeIdx = i
+	applyTheme(m.themes[i])
+
+	for _, t := range []*table.Model{&m.cpuTable, &m.memTable, &m.procTable, &m.diskTable, &m.eventsTable, &m.logTable} {
+		t.SetStyles(TableStyle())
+	}
+}
+
 // Create table with default parameters
 func initTable(cols []table.Column) table.Model {
 	t := table.New(
@@ -98,7 +137,7 @@ func loadGauge(loadPercent float64, width int) string {
 	// Render left separator
 	bar.WriteString(
 		lipgloss.NewStyle().
-			Foreground(amber).
+			Foreground(currentTheme.accent).
 			Render(" | "))
 	// Render load progress
 	for i := 0; i < full; i++ {
@@ -111,13 +150,13 @@ func loadGauge(loadPercent float64, width int) string {
 	for i := 0; i < empty; i++ {
 		bar.WriteString(
 			lipgloss.NewStyle().
-				Foreground(lipgloss.Color(gray)).
+				Foreground(currentTheme.muted).
 				Render("░ "))
 	}
 	// Render right separator
 	bar.WriteString(
 		lipgloss.NewStyle().
-			Foreground(amber).
+			Foreground(currentTheme.accent).
 			Render(" | "))
 	return bar.String()
 }
@@ -127,15 +166,19 @@ func loadGauge(loadPercent float64, width int) string {
 func (m model) renderTab(activeTab int) string {
 	switch {
 	// CPU stats
-	case activeTab == 0:
-		return pageContentStyle.Render(lipgloss.JoinVertical(
+	case activeTab == cpuTab:
+		content := lipgloss.JoinVertical(
 			lipgloss.Left,
 			gauge.Render(fmt.Sprintf(
 				"CPU: %.2f%%\n%s\n",
 				m.cpuTotalPercent,
 				loadGauge(m.cpuTotalPercent, 45))),
 			baseStyle.Render(m.cpuTable.View()),
-		))
+		)
+		if w := m.chartWidth(content); w > 0 {
+			content = lipgloss.JoinHorizontal(lipgloss.Top, content, m.cpuCharts(w))
+		}
+		return pageContentStyle.Render(content)
 		// return lipgloss.JoinVertical(
 		// 	lipgloss.Left,
 		// 	gauge.Render(fmt.Sprintf(
@@ -145,15 +188,19 @@ func (m model) renderTab(activeTab int) string {
 		// 	baseStyle.Render(m.cpuTable.View()),
 		// )
 	// Ram stats
-	case activeTab == 1:
-		return pageContentStyle.Render(lipgloss.JoinVertical(
+	case activeTab == memTab:
+		content := lipgloss.JoinVertical(
 			lipgloss.Left,
 			gauge.Render(fmt.Sprintf(
 				"RAM: %.2f%%\n%s\n",
 				m.memory.UsedPercent,
 				loadGauge(m.memory.UsedPercent, 45))),
 			baseStyle.Render(m.memTable.View()),
-		))
+		)
+		if w := m.chartWidth(content); w > 0 {
+			content = lipgloss.JoinHorizontal(lipgloss.Top, content, m.memCharts(w))
+		}
+		return pageContentStyle.Render(content)
 		// return lipgloss.JoinVertical(
 		// 	lipgloss.Left,
 		// 	gauge.Render(fmt.Sprintf(
@@ -163,29 +210,54 @@ func (m model) renderTab(activeTab int) string {
 		// 	baseStyle.Render(m.memTable.View()),
 		// )
 	// Running processes
-	case activeTab == 2:
-		return pageContentStyle.Render(lipgloss.JoinVertical(
-			lipgloss.Left,
-			titleStyle.Render("TOP RUNNING PROCESSES"),
+	case activeTab == procTab:
+		if m.inspected != nil {
+			return pageContentStyle.Render(m.renderProcessDetail())
+		}
+		title := "TOP RUNNING PROCESSES"
+		if m.groupMode() != "" {
+			title = "PROCESS GROUPS"
+		}
+		order := fmt.Sprintf("sorted by %s · grouped by %s", m.sortMode(), m.groupLabel())
+		parts := []string{
+			titleStyle.Render(title),
+			lipgloss.NewStyle().Foreground(currentTheme.muted).MarginLeft(5).Render(order),
 			baseStyle.Render(m.procTable.View()),
-		))
+		}
+		if missing := m.renderMissing(); missing != "" {
+			parts = append(parts, missing)
+		}
+		return pageContentStyle.Render(lipgloss.JoinVertical(lipgloss.Left, append(parts, m.renderSuspects())...))
 		// return lipgloss.JoinVertical(
 		// 	lipgloss.Left,
 		// 	titleStyle.Render("TOP RUNNING PROCESSES"),
 		// 	baseStyle.Render(m.procTable.View()),
 		// )
 	// Disk availability
-	case activeTab == 3:
-		return pageContentStyle.Render(lipgloss.JoinVertical(
+	case activeTab == diskTab:
+		content := lipgloss.JoinVertical(
 			lipgloss.Left,
 			titleStyle.Render("AVAILABLE DISK PARTITIONS"),
 			baseStyle.Render(m.diskTable.View()),
-		))
+		)
+		if warnings := m.forecastWarnings(); warnings != "" {
+			content = lipgloss.JoinVertical(lipgloss.Left, content, warnings)
+		}
+		if w := m.chartWidth(content); w > 0 {
+			content = lipgloss.JoinHorizontal(lipgloss.Top, content, m.diskCharts(w))
+		}
+		return pageContentStyle.Render(content)
 		// return lipgloss.JoinVertical(
 		// 	lipgloss.Left,
 		// 	titleStyle.Render("AVAILABLE DISK PARTITIONS"),
 		// 	baseStyle.Render(m.diskTable.View()),
 		// )
+	// Processes started and exited
+	case activeTab == eventsTab:
+		return pageContentStyle.Render(m.renderEventsTab())
+	// Recent errors, alerts and user actions
+	case activeTab == logTab:
+		return pageContentStyle.Render(m.renderLogTab())
 	default:
 		return fmt.Sprint(m.tabs)
 	}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// Setup for key bindings
+type keyMap struct {
+	Left          key.Binding
+	Right         key.Binding
+	Help          key.Binding
+	Theme         key.Binding
+	LogLevel      key.Binding
+	LogSource     key.Binding
+	Play          key.Binding
+	StepBack      key.Binding
+	StepFwd       key.Binding
+	Slower        key.Binding
+	Faster        key.Binding
+	Jump          key.Binding
+	Record        key.Binding
+	Window        key.Binding
+	Stats         key.Binding
+	Select        key.Binding
+	Group         key.Binding
+	Sort          key.Binding
+	Back          key.Binding
+	Forward       key.Binding
+	BackMinute    key.Binding
+	ForwardMinute key.Binding
+	Live          key.Binding
+	Quit          key.Binding
+}
+
+// Rebindable action: its config name, default keys, help text
+// and the keyMap field holding its binding
+// New actions only need to be added here to become configurable
+type keyAction struct {
+	name    string
+	keys    []string
+	help    string
+	binding func(k *keyMap) *key.Binding
+}
+
+var keyActions = []keyAction{
+	{"left", []string{"left", "a"}, "switch tab to left", func(k *keyMap) *key.Binding { return &k.Left }},
+	{"right", []string{"right", "d"}, "switch tab to right", func(k *keyMap) *key.Binding { return &k.Right }},
+	{"help", []string{"h"}, "toggle help", func(k *keyMap) *key.Binding { return &k.Help }},
+	{"theme", []string{"t"}, "cycle theme", func(k *keyMap) *key.Binding { return &k.Theme }},
+	{"log_level", []string{"L"}, "filter log by level", func(k *keyMap) *key.Binding { return &k.LogLevel }},
+	{"log_source", []string{"S"}, "filter log by source", func(k *keyMap) *key.Binding { return &k.LogSource }},
+	{"play_pause", []string{" "}, "replay: play/pause", func(k *keyMap) *key.Binding { return &k.Play }},
+	{"step_back", []string{","}, "replay: step back", func(k *keyMap) *key.Binding { return &k.StepBack }},
+	{"step_forward", []string{"."}, "replay: step forward", func(k *keyMap) *key.Binding { return &k.StepFwd }},
+	{"slower", []string{"-"}, "replay: slower", func(k *keyMap) *key.Binding { return &k.Slower }},
+	{"faster", []string{"+", "="}, "replay: faster", func(k *keyMap) *key.Binding { return &k.Faster }},
+	{"jump", []string{"g"}, "replay: jump to time", func(k *keyMap) *key.Binding { return &k.Jump }},
+	{"record", []string{"R"}, "start/stop recording", func(k *keyMap) *key.Binding { return &k.Record }},
+	{"window", []string{"w"}, "cycle chart window", func(k *keyMap) *key.Binding { return &k.Window }},
+	{"stats", []string{"s"}, "cycle stats columns", func(k *keyMap) *key.Binding { return &k.Stats }},
+	{"select", []string{"enter"}, "process history / expand group", func(k *keyMap) *key.Binding { return &k.Select }},
+	{"group", []string{"p"}, "group processes", func(k *keyMap) *key.Binding { return &k.Group }},
+	{"sort", []string{"o"}, "sort processes", func(k *keyMap) *key.Binding { return &k.Sort }},
+	{"back", []string{"["}, "go back in time", func(k *keyMap) *key.Binding { return &k.Back }},
+	{"forward", []string{"]"}, "go forward in time", func(k *keyMap) *key.Binding { return &k.Forward }},
+	{"back_minute", []string{"{"}, "go back a minute", func(k *keyMap) *key.Binding { return &k.BackMinute }},
+	{"forward_minute", []string{"}"}, "go forward a minute", func(k *keyMap) *key.Binding { return &k.ForwardMinute }},
+	{"live", []string{"l"}, "return to live", func(k *keyMap) *key.Binding { return &k.Live }},
+	{"quit", []string{"q", "esc", "ctrl+c"}, "quit", func(k *keyMap) *key.Binding { return &k.Quit }},
+}
+
+// Number of bindings per column of the full help message
+const helpColumnSize = 5
+
+// Setting help message formats
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Help, k.Quit}
+}
+
+// Full help lists every action, split in columns
+func (k keyMap) FullHelp() [][]key.Binding {
+	var columns [][]key.Binding
+	for i, a := range keyActions {
+		if i%helpColumnSize == 0 {
+			columns = append(columns, []key.Binding{})
+		}
+		columns[len(columns)-1] = append(columns[len(columns)-1], *a.binding(&k))
+	}
+	return columns
+}
+
+// Builds the key map from the defaults and the user overrides
+// (action name -> keys), failing on unknown actions and on
+// keys bound to more than one action
+func newKeyMap(overrides map[string][]string) (keyMap, error) {
+	known := make(map[string]bool, len(keyActions))
+	for _, a := range keyActions {
+		known[a.name] = true
+	}
+	for name, ks := range overrides {
+		if !known[name] {
+			return keyMap{}, fmt.Errorf("keys: unknown action %q", name)
+		}
+		if len(ks) == 0 {
+			return keyMap{}, fmt.Errorf("keys: action %q has no keys", name)
+		}
+	}
+
+	var k keyMap
+	owner := map[string]string{} // key -> action using it
+	var conflicts []string
+
+	for _, a := range keyActions {
+		ks := a.keys
+		if custom, ok := overrides[a.name]; ok {
+			ks = custom
+		}
+
+		for _, kk := range ks {
+			if prev, ok := owner[kk]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("%q is bound to both %q and %q", kk, prev, a.name))
+				continue
+			}
+			owner[kk] = a.name
+		}
+
+		*a.binding(&k) = key.NewBinding(
+			key.WithKeys(ks...),
+			key.WithHelp(helpKeys(ks), a.help),
+		)
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return keyMap{}, fmt.Errorf("keys: conflicting bindings: %s", strings.Join(conflicts, "; "))
+	}
+
+	return k, nil
+}
+
+// Enables the replay controls, hidden from the help while live
+// Recording and time travel are only available live
+func (k *keyMap) setReplay(replaying bool) {
+	for _, b := range []*key.Binding{&k.Play, &k.StepBack, &k.StepFwd, &k.Slower, &k.Faster, &k.Jump} {
+		b.SetEnabled(replaying)
+	}
+	for _, b := range []*key.Binding{&k.Record, &k.Back, &k.Forward, &k.BackMinute, &k.ForwardMinute, &k.Live} {
+		b.SetEnabled(!replaying)
+	}
+}
+
+// Returns the label shown by the help message for a set of keys
+func helpKeys(ks []string) string {
+	symbols := map[string]string{
+		"left":  "←",
+		"right": "→",
+		"up":    "↑",
+		"down":  "↓",
+		" ":     "space",
+	}
+
+	labels := make([]string, len(ks))
+	for i, k := range ks {
+		if s, ok := symbols[k]; ok {
+			k = s
+		}
+		labels[i] = k
+	}
+	return strings.Join(labels, "/")
+}
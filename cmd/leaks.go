@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/analysis"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/systeminfo"
+	"github/iegpeppino/syspulse/tsdb"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Most suspects listed in the PROCESSES tab
+const shownSuspects = 5
+
+// Builds the leak detector set in the config
+func newLeakDetector(cfg config.Leaks) (*analysis.LeakDetector, error) {
+	window := analysis.DefaultLeakWindow
+	if cfg.Window != "" {
+		var err error
+		if window, err = tsdb.ParseDuration(cfg.Window); err != nil || window == 0 {
+			return nil, fmt.Errorf("leaks: invalid window %q", cfg.Window)
+		}
+	}
+	return analysis.NewLeakDetector(window), nil
+}
+
+// Feeds the processes of a sample to the leak detector
+// Recordings don't keep every process, only the listed ones are tracked then
+func observeLeaks(d *analysis.LeakDetector, s systeminfo.Snapshot) {
+	if d == nil || !s.Has(systeminfo.SectionProcesses) {
+		return
+	}
+	procs := s.AllProcesses
+	if len(procs) == 0 {
+		for _, p := range s.Processes {
+			procs = append(procs, p.Sample())
+		}
+	}
+	d.Observe(s.Time, procs, s.Memory.Available)
+}
+
+// Growth of a suspect per hour: +12.50 MB/h
+func formatGrowth(bytesPerSecond float64) string {
+	return "+" + getByteMagnitude(uint64(bytesPerSecond*3600)) + "/h"
+}
+
+// Leak flag of a process as shown in the PROCESSES table
+func (m model) leakCell(pid int32) string {
+	if m.leaks == nil {
+		return ""
+	}
+	if s, ok := m.leaks.Suspect(pid); ok {
+		return "⚠ " + formatGrowth(s.Growth)
+	}
+	return ""
+}
+
+// List of the processes suspected of leaking, fastest growing first
+func (m model) renderSuspects() string {
+	if m.leaks == nil {
+		return ""
+	}
+	title := titleStyle.Render("LEAK SUSPECTS")
+	muted := lipgloss.NewStyle().Foreground(currentTheme.muted)
+
+	suspects := m.leaks.Suspects()
+	if len(suspects) == 0 {
+		note := fmt.Sprintf("No process with a sustained RSS growth (watching %d over %s)",
+			m.leaks.Watching(), formatWindow(m.leaks.Window()))
+		return lipgloss.JoinVertical(lipgloss.Left, title, muted.MarginLeft(4).Render(note))
+	}
+
+	rows := []string{muted.Render(fmt.Sprintf("%-8s %-22s %-11s %-14s %-16s %s", "PID", "Name", "RSS", "Growth", "Fills avail. in", "Watched"))}
+	for i, s := range suspects {
+		if i == shownSuspects {
+			rows = append(rows, muted.Render(fmt.Sprintf("… and %d more", len(suspects)-shownSuspects)))
+			break
+		}
+		limit := "-"
+		if s.TimeToLimit > 0 {
+			limit = formatETA(s.TimeToLimit)
+		}
+		name := []rune(s.Name)
+		if len(name) > 22 {
+			name = append(name[:21], '…')
+		}
+		rows = append(rows, lipgloss.NewStyle().Foreground(currentTheme.critical).Render(fmt.Sprintf("%-8d %-22s %-11s %-14s %-16s %s",
+			s.PID, string(name), getByteMagnitude(s.RSS), formatGrowth(s.Growth), limit, s.Watched.Round(time.Minute))))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, title, lipgloss.NewStyle().MarginLeft(4).Render(strings.Join(rows, "\n")))
+}
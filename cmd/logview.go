@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/alert"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/systeminfo"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Minimum levels the LOG tab can be filtered by
+var logLevels = []slog.Level{slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// Evaluates the alert rules and logs every firing and resolved alert
+func (m *model) evaluateAlerts(now time.Time, metrics []systeminfo.Metric) {
+	for _, t := range m.alerts.Evaluate(now, metrics) {
+		attrs := []any{
+			slog.String("source", "alert"),
+			slog.String("alert", t.Rule),
+			slog.String("series", t.Series),
+			slog.Float64("value", t.Value),
+		}
+		switch {
+		case t.To == alert.Firing:
+			logger.Logger.Warn("Alert firing", attrs...)
+		case t.From == alert.Firing:
+			logger.Logger.Info("Alert resolved", attrs...)
+		}
+	}
+	m.firing = m.alerts.FiringCount()
+}
+
+// Fills the LOG table with the filtered events, newest first
+func (m *model) updateLogTable() {
+	events := logger.Events.Events()
+
+	rows := []table.Row{}
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		if e.Level < logLevels[m.logLevel] || (m.logSource != "" && e.Source != m.logSource) {
+			continue
+		}
+		rows = append(rows, table.Row{
+			e.Time.Format("15:04:05"),
+			e.Level.String(),
+			e.Source,
+			e.Message,
+			e.Details,
+		})
+	}
+	m.logTable.SetRows(rows)
+
+	// Events are seen as soon as they are listed
+	if m.ActiveTab == logTab {
+		m.seenSeq = logger.Events.LastSeq()
+	}
+}
+
+// Shows the next minimum level in the LOG tab
+func (m *model) cycleLogLevel() {
+	m.logLevel = (m.logLevel + 1) % len(logLevels)
+	logger.Logger.Info("Log level filter changed", slog.String("source", "user"), slog.String("level", logLevels[m.logLevel].String()))
+	m.updateLogTable()
+}
+
+// Shows the next event source in the LOG tab, cycling back to all of them
+func (m *model) cycleLogSource() {
+	sources := map[string]bool{}
+	for _, e := range logger.Events.Events() {
+		sources[e.Source] = true
+	}
+	names := []string{""}
+	for s := range sources {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+
+	next := 0
+	for i, s := range names {
+		if s == m.logSource {
+			next = (i + 1) % len(names)
+			break
+		}
+	}
+	m.logSource = names[next]
+
+	logger.Logger.Info("Log source filter changed", slog.String("source", "user"), slog.String("filter", m.logFilterName()))
+	m.updateLogTable()
+}
+
+func (m model) logFilterName() string {
+	if m.logSource == "" {
+		return "all"
+	}
+	return m.logSource
+}
+
+// Moves to another tab, focusing the scrollable tables when needed
+func (m *model) switchTab(i int) {
+	if i == m.ActiveTab {
+		return
+	}
+	m.ActiveTab = i
+	logger.Logger.Info("Tab switched", slog.String("source", "user"), slog.String("tab", m.tabs[i]))
+
+	if i == logTab {
+		m.logTable.Focus()
+	} else {
+		m.logTable.Blur()
+	}
+	if i == procTab {
+		m.procTable.Focus()
+	} else {
+		m.procTable.Blur()
+	}
+	if i == eventsTab {
+		m.eventsTable.Focus()
+	} else {
+		m.eventsTable.Blur()
+	}
+	m.updateLogTable()
+}
+
+// Renders the LOG tab content
+func (m model) renderLogTab() string {
+	filters := fmt.Sprintf("level ≥ %s · source: %s", logLevels[m.logLevel], m.logFilterName())
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		titleStyle.Render("RECENT EVENTS"),
+		lipgloss.NewStyle().Foreground(currentTheme.muted).MarginLeft(5).Render(filters),
+		baseStyle.Render(m.logTable.View()),
+	)
+}
+
+// Renders badges for unseen errors and firing alerts
+func (m model) statusBar() string {
+	badge := lipgloss.NewStyle().
+		Bold(true).
+		Padding(0, 1).
+		MarginLeft(2)
+
+	var badges []string
+	if n := logger.Events.CountSince(m.seenSeq, slog.LevelError); n > 0 && m.ActiveTab != logTab {
+		badges = append(badges, badge.Foreground(currentTheme.critical).Render(fmt.Sprintf("● %d unseen %s", n, plural(n, "error", "errors"))))
+	}
+	if m.recorder != nil {
+		badges = append(badges, badge.Foreground(currentTheme.critical).Render(fmt.Sprintf("● REC %d %s", m.recorder.Samples(), plural(m.recorder.Samples(), "sample", "samples"))))
+	}
+	if m.firing > 0 {
+		badges = append(badges, badge.Foreground(currentTheme.high).Render(fmt.Sprintf("▲ %d %s firing", m.firing, plural(m.firing, "alert", "alerts"))))
+	}
+	return strings.Join(badges, " ")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -1,24 +1,180 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"github/iegpeppino/syspulse/alert"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/export"
 	"github/iegpeppino/syspulse/logger"
+	"log/slog"
 	"os"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// Subcommands running instead of the TUI
+// Each one parses its own flags and returns the exit code
+var commands = map[string]func(args []string) int{
+	"snapshot": runSnapshot,
+	"stream":   runStream,
+	"serve":    runServe,
+	"record":   runRecord,
+	"replay":   runReplay,
+	"query":    runQuery,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
+	configPath := flag.String("config", "", "path to the config file (default "+config.DefaultPath()+")")
+	listen := flag.String("serve", "", "also serve metrics on this address (e.g. :9101)")
+	flag.Parse()
+
+	// Load user configuration
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		os.Exit(1)
+	}
+
+	// Themes, key bindings and alert rules
+	m, err := newTUIModel(cfg)
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		os.Exit(1)
+	}
+
 	// Initialize system stats error logger
-	logger.SysDataLogger()
+	// a failure isn't fatal, logs only reach the LOG tab instead
+	if err := logger.SysDataLogger(cfg.Log, true); err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening log file:", err)
+	}
+	defer logger.Close()
+
+	// Serve /metrics alongside the TUI when asked to
+	if *listen != "" {
+		cfg.Serve.Listen = *listen
+	}
+	if cfg.Serve.Listen != "" {
+		m.store = export.NewStore()
+		srv, err := startMetricsServer(cfg.Serve, m.store)
+		if err != nil {
+			fmt.Println("Error:", err)
+			logger.Close()
+			os.Exit(1)
+		}
+		defer srv.Close()
+		m.collectOpts.TopProcesses = collectTop(cfg.Serve.ProcessTop, shownProcesses)
+	}
 
-	// Initialize bubbletea model
-	m := modelInit()
+	// Push exporters (Influx, Graphite, OTLP, StatsD)
+	// stdout belongs to the TUI so Influx can't write there
+	if c := cfg.Exporters.Influx; c != nil && (c.Output == "" || c.Output == "-") {
+		fmt.Println("Error: the influx exporter can't write to stdout while the TUI runs, use \"syspulse serve\" or set an output")
+		logger.Close()
+		os.Exit(1)
+	}
+	exporters, err := buildExporters(cfg.Exporters)
+	if err != nil {
+		fmt.Println("Error:", err)
+		logger.Close()
+		os.Exit(1)
+	}
+	if exporters != nil {
+		defer exporters.Close()
+		m.exporters = exporters
+		m.exportTop = cfg.Serve.ProcessTop
+		m.collectOpts.TopProcesses = collectTop(cfg.Serve.ProcessTop, shownProcesses)
+	}
+
+	// On-disk history, skipped when another syspulse (e.g. serve) owns the store
+	history, err := openTSDB(cfg.TSDB, cfg.Serve.ProcessTop)
+	if err != nil {
+		logger.Logger.Warn("Not storing history on disk", slog.String("source", "tsdb"), slog.String("error", err.Error()))
+	}
+	if history != nil {
+		defer history.close()
+		m.tsdb = history
+		seedForecast(m.forecaster, history, time.Now())
+	}
 
 	// Run TUI in clean alternate terminal
 	p := tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	final, err := p.Run()
+	if fm, ok := final.(model); ok {
+		fm.stopRecording()
+	}
+	if err != nil {
 		fmt.Println("Error running program", err)
+		logger.Close()
 		os.Exit(1)
 	}
 }
+
+// Builds the TUI model from the config: themes honouring
+// terminal color support, user key bindings and alert rules
+func newTUIModel(cfg *config.Config) (model, error) {
+	themes, themeIdx, err := loadThemes(cfg, detectColorSupport())
+	if err != nil {
+		return model{}, err
+	}
+
+	keys, err := newKeyMap(cfg.Keys)
+	if err != nil {
+		return model{}, err
+	}
+
+	rules, err := alert.RulesFromConfig(cfg.Alerts)
+	if err != nil {
+		return model{}, err
+	}
+
+	window, err := time.ParseDuration(cfg.History.Window)
+	if err != nil || window < 0 {
+		return model{}, fmt.Errorf("history: invalid window %q", cfg.History.Window)
+	}
+
+	forecaster, horizon, err := newDiskForecaster(cfg.Forecast)
+	if err != nil {
+		return model{}, err
+	}
+
+	leaks, err := newLeakDetector(cfg.Leaks)
+	if err != nil {
+		return model{}, err
+	}
+
+	anomalies, err := newAnomalyDetector(cfg.Anomalies)
+	if err != nil {
+		return model{}, err
+	}
+
+	watches, err := newWatches(cfg.Watch)
+	if err != nil {
+		return model{}, err
+	}
+
+	groupRules, err := newMatchers("groups", cfg.Groups)
+	if err != nil {
+		return model{}, err
+	}
+
+	keys.setReplay(false)
+	m := modelInit(keys, themes, themeIdx, rules)
+	m.recordCfg = cfg.Record
+	m.pastWindow = window
+	m.forecaster = forecaster
+	m.forecastHorizon = horizon
+	m.leaks = leaks
+	m.anomalies = anomalies
+	m.watches = watches
+	m.collectOpts.Pinned = watches
+	m.groupRules = groupRules
+	return m, nil
+}
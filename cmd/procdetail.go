@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/systeminfo"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Process whose history is shown in the PROCESSES tab
+type procRef struct {
+	pid     int32
+	started time.Time
+}
+
+// Width of the value labels left of the detail charts
+const detailAxisWidth = 11
+
+// Feeds the processes of a sample to the per-process history
+// Recordings only keep the listed processes, those are tracked then
+func observeProcessHistory(h *systeminfo.ProcessHistory, s systeminfo.Snapshot) {
+	if h == nil || !s.Has(systeminfo.SectionProcesses) {
+		return
+	}
+	procs := s.AllProcesses
+	if len(procs) == 0 {
+		for _, p := range s.Processes {
+			procs = append(procs, p.Sample())
+		}
+	}
+	h.Observe(s.Time, procs)
+}
+
+// Opens the history of the selected process, or closes the one shown
+// While grouping the selected group is expanded or collapsed instead
+func (m *model) toggleDetail() {
+	if m.ActiveTab != procTab {
+		return
+	}
+	if m.inspected != nil {
+		m.inspected = nil
+		return
+	}
+	i := m.procTable.Cursor()
+	var pid int32
+	var started time.Time
+	var name string
+	switch {
+	case m.groupMode() != "":
+		// Groups expand, their members open like single processes
+		if m.toggleGroup() || i < 0 || i >= len(m.groupRows) {
+			return
+		}
+		p := m.groupRows[i].process
+		pid, started, name = p.PID, p.Started, p.Name
+	case i >= 0 && i < len(m.processes):
+		p := m.processes[i]
+		pid, started, name = p.PID, p.Started, p.Name
+	default:
+		return
+	}
+	m.inspected = &procRef{pid: pid, started: started}
+	logger.Logger.Info("Process details opened", slog.String("source", "user"), slog.Int("pid", int(pid)), slog.String("name", name))
+}
+
+// Renders the history of the inspected process: when it started,
+// its peaks and charts of every value since it was first seen
+func (m model) renderProcessDetail() string {
+	muted := lipgloss.NewStyle().Foreground(currentTheme.muted)
+	back := muted.MarginLeft(5).Render(fmt.Sprintf("%s: back to the process list", m.keys.Select.Help().Key))
+
+	tr, ok := m.procHistory.Trace(m.inspected.pid, m.inspected.started)
+	if !ok {
+		return lipgloss.JoinVertical(lipgloss.Left,
+			titleStyle.Render(fmt.Sprintf("PROCESS %d", m.inspected.pid)),
+			muted.MarginLeft(5).Render("No history kept for this process, it exited a while ago"),
+			back)
+	}
+
+	// Readings up to the sample shown, which is older while traveling
+	var points []systeminfo.ProcessPoint
+	for _, p := range tr.Points {
+		if !p.Time.After(m.sampleTime) {
+			points = append(points, p)
+		}
+	}
+	width := min(max(m.width-30, minChartWidth), 100)
+
+	info := []string{fmt.Sprintf("parent %d", tr.PPID)}
+	if !tr.Started.IsZero() {
+		info = append(info, fmt.Sprintf("started %s (%s ago)", tr.Started.Format("2006-01-02 15:04:05"), formatLifetime(m.sampleTime.Sub(tr.Started))))
+	}
+	info = append(info, "observed for "+formatLifetime(m.sampleTime.Sub(tr.FirstSeen)))
+	if !tr.Exited.IsZero() && !tr.Exited.After(m.sampleTime) {
+		info = append(info, "exited "+tr.Exited.Format("15:04:05"))
+	}
+	peaks := fmt.Sprintf("peak CPU %.1f%% · peak RSS %s · peak threads %d · peak read %s · peak write %s",
+		tr.Peak.CPU, getByteMagnitude(tr.Peak.RSS), tr.Peak.Threads, formatRate(tr.Peak.ReadRate), formatRate(tr.Peak.WriteRate))
+
+	cmdline := []rune(tr.Cmdline)
+	if len(cmdline) > width+detailAxisWidth {
+		cmdline = append(cmdline[:width+detailAxisWidth-1], '…')
+	}
+
+	series := func(value func(systeminfo.ProcessPoint) float64) []systeminfo.Point {
+		out := make([]systeminfo.Point, len(points))
+		for i, p := range points {
+			out[i] = systeminfo.Point{Time: p.Time, Value: value(p)}
+		}
+		return out
+	}
+	from := tr.FirstSeen
+	percent := func(v float64) string { return fmt.Sprintf("%.1f%%", v) }
+	bytes := func(v float64) string { return getByteMagnitude(uint64(v)) }
+
+	body := lipgloss.JoinVertical(lipgloss.Left,
+		muted.Render(string(cmdline)),
+		muted.Render(strings.Join(info, " · ")),
+		muted.Render(peaks),
+		"",
+		m.traceChart("CPU", series(func(p systeminfo.ProcessPoint) float64 { return p.CPU }), from, width, 5, percent),
+		"",
+		m.traceChart("RSS", series(func(p systeminfo.ProcessPoint) float64 { return float64(p.RSS) }), from, width, 5, bytes),
+		"",
+		m.traceSpark("Threads", series(func(p systeminfo.ProcessPoint) float64 { return float64(p.Threads) }), from, width, func(v float64) string { return fmt.Sprintf("%.0f", v) }),
+		m.traceSpark("Read", series(func(p systeminfo.ProcessPoint) float64 { return p.ReadRate }), from, width, formatRate),
+		m.traceSpark("Write", series(func(p systeminfo.ProcessPoint) float64 { return p.WriteRate }), from, width, formatRate),
+	)
+	return lipgloss.JoinVertical(lipgloss.Left,
+		titleStyle.Render(fmt.Sprintf("PROCESS %d · %s", tr.PID, tr.Name)),
+		lipgloss.NewStyle().MarginLeft(5).Render(body),
+		"",
+		back,
+	)
+}
+
+// Braille chart of a process value from its first reading to the
+// sample shown, scaled from 0 to its highest value
+func (m model) traceChart(title string, points []systeminfo.Point, from time.Time, width, rows int, format func(float64) string) string {
+	values := bucketize(points, from, m.sampleTime, width*2)
+	hi := 0.0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			hi = max(hi, v)
+		}
+	}
+	if hi == 0 {
+		hi = 1
+	}
+	lines := brailleChart(values, rows, 0, hi, math.NaN())
+
+	line := lipgloss.NewStyle().Foreground(currentTheme.accent)
+	muted := lipgloss.NewStyle().Foreground(currentTheme.muted)
+	for i := range lines {
+		axis := ""
+		switch i {
+		case 0:
+			axis = format(hi)
+		case rows - 1:
+			axis = format(0)
+		}
+		lines[i] = muted.Render(fmt.Sprintf("%*s┤", detailAxisWidth-1, axis)) + line.Render(lines[i])
+	}
+
+	header := lipgloss.NewStyle().Bold(true).Foreground(currentTheme.text).Render(title) +
+		muted.Render("  since "+from.Format("15:04:05")+lastValue(points, format))
+	return lipgloss.JoinVertical(lipgloss.Left, header, strings.Join(lines, "\n"))
+}
+
+// Labelled sparkline of a process value, scaled from 0 to its highest value
+func (m model) traceSpark(label string, points []systeminfo.Point, from time.Time, width int, format func(float64) string) string {
+	values := bucketize(points, from, m.sampleTime, width)
+	hi := 0.0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			hi = max(hi, v)
+		}
+	}
+	return fmt.Sprintf("%-*s %s%s",
+		detailAxisWidth-1,
+		label,
+		lipgloss.NewStyle().Foreground(currentTheme.accent).Render(sparkline(values, 0, hi)),
+		lipgloss.NewStyle().Foreground(currentTheme.muted).Render(lastValue(points, format)),
+	)
+}
+
+// Latest value of a series: "  now 12.5%"
+func lastValue(points []systeminfo.Point, format func(float64) string) string {
+	if len(points) == 0 {
+		return "  no data yet"
+	}
+	return "  now " + format(points[len(points)-1].Value)
+}
+
+// Byte rate: 1.20 MB/s
+func formatRate(bytesPerSecond float64) string {
+	return getByteMagnitude(uint64(bytesPerSecond)) + "/s"
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/recording"
+	"github/iegpeppino/syspulse/systeminfo"
+	"github/iegpeppino/syspulse/tsdb"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats of the query command
+var queryFormats = []string{"table", "csv", "json"}
+
+// Layouts accepted for absolute query times, in local time
+// unless they carry a zone
+var queryTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// syspulse query: aggregates stored history over a time range
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: syspulse query [flags] selector [session.spr...]")
+		fmt.Fprintln(fs.Output(), "\nAggregates the history kept on disk (see \"tsdb\" in the config), or the")
+		fmt.Fprintln(fs.Output(), "given recordings, over a time range. A selector is a metric name, where *")
+		fmt.Fprintln(fs.Output(), "matches anything, with optional label matchers (=, !=, =~, !~):")
+		fmt.Fprintln(fs.Output(), "\n  syspulse query -range 7d -agg max 'disk.used_percent{mountpoint=\"/\"}'")
+		fmt.Fprintln(fs.Output(), "  syspulse query -agg p95 -by name 'process.cpu_percent{name=~\"post.*\"}'")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 ok, 1 no data or unreadable history, 2 invalid flags.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "path to the config file (default "+config.DefaultPath()+")")
+	span := fs.String("range", "1h", "time range ending at -to (e.g. 30m, 36h, 7d, 2w)")
+	fromFlag := fs.String("from", "", "start of the range, overrides -range (RFC 3339, \"2006-01-02 15:04\" or relative like -7d)")
+	toFlag := fs.String("to", "now", "end of the range")
+	agg := fs.String("agg", "avg", "aggregation: "+strings.Join(tsdb.Aggregations, ", "))
+	by := fs.String("by", "", "comma separated labels to group by (e.g. mountpoint, name), * keeps every series apart")
+	stepFlag := fs.String("step", "", "split the range in steps this long (e.g. 1h, 1d), one value per step")
+	tier := fs.String("tier", "auto", "resolution read: auto, raw, 1m, 10m or 1h (ignored for recordings)")
+	format := fs.String("format", "table", "output format: "+strings.Join(queryFormats, ", "))
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	sel, err := tsdb.ParseSelector(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	if !slices.Contains(tsdb.Aggregations, *agg) {
+		fmt.Fprintf(os.Stderr, "Error: unknown aggregation %q (expected one of %s)\n", *agg, strings.Join(tsdb.Aggregations, ", "))
+		return exitUsage
+	}
+	if !slices.Contains(queryFormats, *format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected one of %s)\n", *format, strings.Join(queryFormats, ", "))
+		return exitUsage
+	}
+	if *tier != "auto" && tsdb.TierIndex(*tier) < 0 {
+		fmt.Fprintf(os.Stderr, "Error: unknown tier %q (expected auto, raw, 1m, 10m or 1h)\n", *tier)
+		return exitUsage
+	}
+
+	q := tsdb.Query{Selector: sel, Agg: *agg, By: splitList(*by)}
+	now := time.Now()
+	if q.To, err = parseQueryTime(*toFlag, now); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -to:", err)
+		return exitUsage
+	}
+	if *fromFlag != "" {
+		q.From, err = parseQueryTime(*fromFlag, now)
+	} else {
+		var d time.Duration
+		d, err = tsdb.ParseDuration(*span)
+		q.From = q.To.Add(-d)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: range:", err)
+		return exitUsage
+	}
+	if !q.From.Before(q.To) {
+		fmt.Fprintln(os.Stderr, "Error: the range must start before it ends")
+		return exitUsage
+	}
+	if *stepFlag != "" {
+		if q.Step, err = tsdb.ParseDuration(*stepFlag); err != nil || q.Step == 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid step %q\n", *stepFlag)
+			return exitUsage
+		}
+	}
+
+	var results []tsdb.QueryResult
+	var source string
+	if files := fs.Args()[1:]; len(files) > 0 {
+		results, err = queryRecordings(files, q)
+		source = "recordings"
+	} else {
+		var cfg *config.Config
+		cfg, err = config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading config:", err)
+			return exitUsage
+		}
+		results, source, err = queryTSDB(cfg.TSDB, q, *tier)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(os.Stderr, "No data for %s between %s and %s\n",
+			fs.Arg(0), q.From.Format(time.DateTime), q.To.Format(time.DateTime))
+		return exitFailed
+	}
+
+	if err := writeQuery(os.Stdout, q, source, results, *format); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// Runs a query against the on-disk store, read only so it works
+// while the TUI or serve keep appending to it
+func queryTSDB(cfg *config.TSDB, q tsdb.Query, tier string) ([]tsdb.QueryResult, string, error) {
+	dir, err := tsdbDir(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	db, err := tsdb.OpenReadOnly(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", fmt.Errorf("no history stored in %s, enable \"tsdb\" in the config to keep it", dir)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+
+	if tier == "auto" {
+		tier = ""
+	}
+	results, tier, err := db.Query(q, tier)
+	return results, "tsdb " + tier, err
+}
+
+// Runs a query over the samples of recordings
+func queryRecordings(files []string, q tsdb.Query) ([]tsdb.QueryResult, error) {
+	found := map[string]*tsdb.Series{}
+	for _, f := range files {
+		_, samples, err := recording.ReadAll(f)
+		if err != nil && !errors.Is(err, recording.ErrTruncated) {
+			return nil, err
+		}
+		for _, s := range samples {
+			if s.Time.Before(q.From) || !s.Time.Before(q.To) {
+				continue
+			}
+			for _, m := range s.Metrics() {
+				if !q.Selector.Match(m.Name, m.Labels) {
+					continue
+				}
+				key := systeminfo.SeriesKey(m.Name, m.Labels)
+				series := found[key]
+				if series == nil {
+					series = &tsdb.Series{Name: m.Name, Labels: m.Labels}
+					found[key] = series
+				}
+				series.Samples = append(series.Samples, tsdb.Sample{Time: s.Time, Min: m.Value, Max: m.Value, Sum: m.Value, Count: 1})
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for k := range found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	series := make([]tsdb.Series, len(keys))
+	for i, k := range keys {
+		series[i] = *found[k]
+		samples := series[i].Samples
+		sort.SliceStable(samples, func(a, b int) bool { return samples[a].Time.Before(samples[b].Time) })
+	}
+	return tsdb.Evaluate(series, q)
+}
+
+// Parses "now", a time relative to now ("-7d", "90m") or an absolute one
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if d, err := tsdb.ParseDuration(strings.TrimPrefix(s, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range queryTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// Non empty items of a comma separated list
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// Label columns of the results: the grouping labels in the order
+// given, or every label found when grouping by *
+func queryColumns(q tsdb.Query, results []tsdb.QueryResult) []string {
+	if !slices.Contains(q.By, "*") {
+		return q.By
+	}
+	seen := map[string]bool{}
+	var cols []string
+	for _, r := range results {
+		for k := range r.Labels {
+			if !seen[k] && k != "metric" {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return append([]string{"metric"}, cols...)
+}
+
+// JSON layout of a query
+type queryDocument struct {
+	Selector    string           `json:"selector"`
+	Aggregation string           `json:"aggregation"`
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Step        string           `json:"step,omitempty"`
+	Source      string           `json:"source"`
+	Results     []queryDocResult `json:"results"`
+}
+
+type queryDocResult struct {
+	Labels  map[string]string `json:"labels"`
+	Value   *float64          `json:"value,omitempty"`   // Without a step
+	Samples int               `json:"samples,omitempty"` // Without a step
+	Points  []queryDocPoint   `json:"points,omitempty"`  // With a step
+}
+
+type queryDocPoint struct {
+	Time    time.Time `json:"time"`
+	Value   float64   `json:"value"`
+	Samples int       `json:"samples"`
+}
+
+// Writes the results in the given format, with one row per group,
+// or per group and step when the range is split
+func writeQuery(w io.Writer, q tsdb.Query, source string, results []tsdb.QueryResult, format string) error {
+	if format == "json" {
+		doc := queryDocument{
+			Selector:    querySelector(q.Selector),
+			Aggregation: q.Agg,
+			From:        q.From,
+			To:          q.To,
+			Source:      source,
+		}
+		if q.Step > 0 {
+			doc.Step = q.Step.String()
+		}
+		for _, r := range results {
+			dr := queryDocResult{Labels: r.Labels}
+			if q.Step > 0 {
+				for _, p := range r.Points {
+					dr.Points = append(dr.Points, queryDocPoint(p))
+				}
+			} else {
+				dr.Value, dr.Samples = &r.Points[0].Value, r.Points[0].Samples
+			}
+			doc.Results = append(doc.Results, dr)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+
+	cols := queryColumns(q, results)
+	header := []string{}
+	if q.Step > 0 {
+		header = append(header, "time")
+	}
+	header = append(header, cols...)
+	header = append(header, q.Agg, "samples")
+
+	var rows [][]string
+	for _, r := range results {
+		for _, p := range r.Points {
+			var row []string
+			if q.Step > 0 {
+				if format == "csv" {
+					row = append(row, p.Time.Format(time.RFC3339))
+				} else {
+					row = append(row, p.Time.Format(time.DateTime))
+				}
+			}
+			for _, c := range cols {
+				row = append(row, r.Labels[c])
+			}
+			prec := 2
+			if format == "csv" {
+				prec = -1
+			}
+			row = append(row, strconv.FormatFloat(p.Value, 'f', prec, 64), strconv.Itoa(p.Samples))
+			rows = append(rows, row)
+		}
+	}
+
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i := range header {
+		header[i] = strings.ToUpper(header[i])
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// Selector written back in its canonical form
+func querySelector(s tsdb.Selector) string {
+	if len(s.Matchers) == 0 {
+		return s.Name
+	}
+	parts := make([]string, len(s.Matchers))
+	for i, lm := range s.Matchers {
+		parts[i] = lm.Label + lm.Op + strconv.Quote(lm.Value)
+	}
+	return s.Name + "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/recording"
+	"github/iegpeppino/syspulse/systeminfo"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// syspulse record: writes every sample to a session file until interrupted
+func runRecord(args []string) int {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: syspulse record [flags]")
+		fmt.Fprintln(fs.Output(), "\nCollects every interval and appends each sample to a compressed session")
+		fmt.Fprintln(fs.Output(), "file (.spr) until interrupted. Play it back with \"syspulse replay\".")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "path to the config file (default "+config.DefaultPath()+")")
+	output := fs.String("o", "", "session file (default syspulse-<time>.spr)")
+	interval := fs.Duration("interval", time.Second, "collection interval (collecting CPU usage takes 1s)")
+	sectionList := fs.String("sections", "all", "comma separated sections: cpu, mem, processes, disks")
+	top := fs.Int("top", 10, "number of processes recorded, by CPU usage")
+	maxSize := fs.Int("max-size", 0, "roll over to a new file past this many MB, 0 for no limit (default from config)")
+	maxDuration := fs.Duration("max-duration", 0, "roll over to a new file after this long, 0 for no limit (default from config)")
+	keep := fs.Int("keep", 0, "files kept, older ones are deleted, 0 keeps all (default from config)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		return exitUsage
+	}
+
+	// Flags given take precedence over the config file
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-size":
+			cfg.Record.MaxSizeMB = *maxSize
+		case "max-duration":
+			cfg.Record.MaxDuration = maxDuration.String()
+		case "keep":
+			cfg.Record.Keep = *keep
+		}
+	})
+
+	sections, err := parseSections(*sectionList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	if *interval <= 0 || *top < 1 {
+		fmt.Fprintln(os.Stderr, "Error: -interval must be positive and -top at least 1")
+		return exitUsage
+	}
+
+	path := *output
+	if path == "" {
+		path = sessionName(time.Now())
+	}
+	opts, err := recordOptions(cfg.Record, path, *interval)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(os.Stderr, "Error: %s already exists\n", path)
+		return exitUsage
+	}
+
+	rec, err := recording.NewRecorder(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+
+	if err := logger.SysDataLogger(cfg.Log, false); err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening log file:", err)
+	}
+	defer logger.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Recording to %s, press Ctrl+C to stop\n", path)
+
+	var recordErr error
+	collectLoop(ctx, *interval, sectionOptions(sections, *top), func(s systeminfo.Snapshot) {
+		if recordErr != nil {
+			return
+		}
+		logCollectorErrors(s)
+		if recordErr = rec.Record(s); recordErr != nil {
+			stop()
+		}
+	})
+
+	if err := rec.Close(); err != nil && recordErr == nil {
+		recordErr = err
+	}
+	if recordErr != nil {
+		fmt.Fprintln(os.Stderr, "Error:", recordErr)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "Recorded %d %s\n", rec.Samples(), plural(rec.Samples(), "sample", "samples"))
+	return exitOK
+}
+
+// Default name of a session file
+func sessionName(t time.Time) string {
+	return "syspulse-" + t.Format("20060102-150405") + recording.Ext
+}
+
+// Builds recorder options from the config
+func recordOptions(cfg config.Record, path string, interval time.Duration) (recording.Options, error) {
+	opts := recording.Options{
+		Path:     path,
+		Interval: interval,
+		MaxSize:  int64(cfg.MaxSizeMB) * 1024 * 1024,
+		Keep:     cfg.Keep,
+	}
+	if cfg.MaxDuration != "" {
+		d, err := time.ParseDuration(cfg.MaxDuration)
+		if err != nil || d < 0 {
+			return opts, fmt.Errorf("invalid record max duration %q", cfg.MaxDuration)
+		}
+		opts.MaxDuration = d
+	}
+	return opts, nil
+}
+
+// Directory of the recordings started from the TUI
+func recordDir(cfg config.Record) (string, error) {
+	if cfg.Dir != "" {
+		return cfg.Dir, nil
+	}
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recordings"), nil
+}
+
+// Starts or stops recording the TUI samples
+func (m *model) toggleRecording() {
+	if m.recorder != nil {
+		m.stopRecording()
+		return
+	}
+
+	dir, err := recordDir(m.recordCfg)
+	if err != nil {
+		logger.Logger.Error("Unable to start recording", slog.String("source", "record"), slog.String("error", err.Error()))
+		return
+	}
+	path := filepath.Join(dir, sessionName(time.Now()))
+	// The TUI samples as fast as the collectors go, there's no set interval
+	opts, err := recordOptions(m.recordCfg, path, 0)
+	if err == nil {
+		m.recorder, err = recording.NewRecorder(opts)
+	}
+	if err != nil {
+		logger.Logger.Error("Unable to start recording", slog.String("source", "record"), slog.String("error", err.Error()))
+		return
+	}
+	logger.Logger.Info("Recording started", slog.String("source", "record"), slog.String("path", path))
+}
+
+// Closes the recording, if any
+func (m *model) stopRecording() {
+	if m.recorder == nil {
+		return
+	}
+	samples := m.recorder.Samples()
+	if err := m.recorder.Close(); err != nil {
+		logger.Logger.Error("Unable to close recording", slog.String("source", "record"), slog.String("error", err.Error()))
+	}
+	logger.Logger.Info("Recording stopped", slog.String("source", "record"), slog.Int("samples", samples))
+	m.recorder = nil
+}
+
+// Appends a sample to the recording, stopping it on failure
+func (m *model) recordSnapshot(s systeminfo.Snapshot) {
+	if err := m.recorder.Record(s); err != nil {
+		logger.Logger.Error("Recording failed", slog.String("source", "record"), slog.String("error", err.Error()))
+		m.stopRecording()
+	}
+}
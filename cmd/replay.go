@@ -0,0 +1,413 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github/iegpeppino/syspulse/alert"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/recording"
+	"github/iegpeppino/syspulse/systeminfo"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Playback speeds cycled with the slower/faster keys
+var replaySpeeds = []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32, 64}
+
+// Longest wait between two replayed samples, so gaps in a recording
+// (e.g. between two sessions) don't stall playback
+const maxReplayGap = 2 * time.Second
+
+// Alert transition found in a recording
+type replayEvent struct {
+	time   time.Time
+	firing bool // Started firing, or resolved
+}
+
+// Recording being played back instead of live collection
+type replayState struct {
+	header  recording.Header
+	samples []systeminfo.Snapshot // Sorted by time
+	firing  []int                 // Firing alerts at each sample
+	events  []replayEvent
+	pos     int
+	playing bool
+	speed   int // Index in replaySpeeds
+	gen     int // Bumped on every seek so stale ticks are dropped
+
+	jumping bool   // Reading a time to jump to
+	input   string // Time typed so far
+	jumpErr string
+}
+
+// Asks for the next sample of a replay
+type replayTickMsg struct{ gen int }
+
+// syspulse replay: plays a recording back in the TUI
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: syspulse replay [flags] session.spr [more.spr...]")
+		fmt.Fprintln(fs.Output(), "\nPlays recorded sessions back in the TUI. Several files (e.g. the parts")
+		fmt.Fprintln(fs.Output(), "of a rolled over session) are merged in time order.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "path to the config file (default "+config.DefaultPath()+")")
+	speed := fs.Float64("speed", 1, "initial playback speed (0.25 to 64)")
+	paused := fs.Bool("paused", false, "start paused on the first sample")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		return exitUsage
+	}
+	m, err := newTUIModel(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		return exitUsage
+	}
+	rules, _ := alert.RulesFromConfig(cfg.Alerts) // Already validated by newTUIModel
+
+	if err := logger.SysDataLogger(cfg.Log, true); err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening log file:", err)
+	}
+	defer logger.Close()
+
+	r, err := loadReplay(fs.Args(), rules)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+	r.playing = !*paused
+	r.speed = closestSpeed(*speed)
+
+	m.replay = r
+	m.keys.setReplay(true)
+
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	if _, err := p.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error running program", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// Reads the recordings and replays the alert rules over them
+// A truncated file is played up to its last complete sample
+func loadReplay(files []string, rules []alert.Rule) (*replayState, error) {
+	r := &replayState{}
+	for i, f := range files {
+		h, samples, err := recording.ReadAll(f)
+		if errors.Is(err, recording.ErrTruncated) {
+			logger.Logger.Warn("Recording is truncated, playing it up to its last complete sample",
+				slog.String("source", "replay"), slog.String("path", f), slog.Int("samples", len(samples)))
+		} else if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			r.header = h
+		}
+		r.samples = append(r.samples, samples...)
+	}
+	if len(r.samples) == 0 {
+		return nil, fmt.Errorf("no samples found in %s", strings.Join(files, ", "))
+	}
+	sort.SliceStable(r.samples, func(i, j int) bool { return r.samples[i].Time.Before(r.samples[j].Time) })
+
+	engine := alert.NewEngine(rules)
+	r.firing = make([]int, len(r.samples))
+	for i, s := range r.samples {
+		for _, t := range engine.Evaluate(s.Time, s.Metrics()) {
+			switch {
+			case t.To == alert.Firing:
+				r.events = append(r.events, replayEvent{time: s.Time, firing: true})
+			case t.From == alert.Firing:
+				r.events = append(r.events, replayEvent{time: s.Time})
+			}
+		}
+		r.firing[i] = engine.FiringCount()
+	}
+	return r, nil
+}
+
+// Index of the speed closest to the given multiplier
+func closestSpeed(speed float64) int {
+	best := 0
+	for i, s := range replaySpeeds {
+		if abs(s-speed) < abs(replaySpeeds[best]-speed) {
+			best = i
+		}
+	}
+	return best
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Hands a recorded sample to the model as if it had just been collected
+func replaySample(s systeminfo.Snapshot) tea.Cmd {
+	return func() tea.Msg {
+		return snapshotMsg(s)
+	}
+}
+
+// Schedules the next sample, waiting as long as the recording did
+// divided by the playback speed
+func (r *replayState) schedule() tea.Cmd {
+	if !r.playing {
+		return nil
+	}
+	if r.pos >= len(r.samples)-1 {
+		r.playing = false // End of the recording
+		return nil
+	}
+
+	gap := r.samples[r.pos+1].Time.Sub(r.samples[r.pos].Time)
+	gap = min(max(gap, 0), maxReplayGap)
+	gen := r.gen
+	return tea.Tick(time.Duration(float64(gap)/replaySpeeds[r.speed]), func(time.Time) tea.Msg {
+		return replayTickMsg{gen: gen}
+	})
+}
+
+// Moves to the next sample when the tick is still current
+func (m *model) replayTick(msg replayTickMsg) tea.Cmd {
+	r := m.replay
+	if msg.gen != r.gen || !r.playing || r.pos >= len(r.samples)-1 {
+		return nil
+	}
+	r.pos++
+	return replaySample(r.samples[r.pos])
+}
+
+// Jumps to a sample, dropping any pending tick
+func (m *model) seek(pos int) tea.Cmd {
+	r := m.replay
+	prev := r.pos
+	r.pos = min(max(pos, 0), len(r.samples)-1)
+	r.gen++
+
+	// Deltas compare against the sample before the new position
+	m.cpuStats = r.samples[max(r.pos-1, 0)].CPUTimes
+	if r.pos != prev+1 {
+		m.rewindHistory()
+	}
+	return replaySample(r.samples[r.pos])
+}
+
+// Refills the chart history with the samples leading to the
+// replay position, the sample itself is added when applied
+func (m *model) rewindHistory() {
+	r := m.replay
+	m.history.Reset()
+	since := r.samples[r.pos].Time.Add(-chartWindows[len(chartWindows)-1])
+	for _, s := range r.samples[:r.pos] {
+		if !s.Time.Before(since) {
+			m.history.Add(s.Time, watchMetrics(m.watches, s, s.Metrics()))
+		}
+	}
+
+	if m.forecaster != nil {
+		m.forecaster.Reset()
+		since = r.samples[r.pos].Time.Add(-m.forecaster.Window())
+		for _, s := range r.samples[:r.pos] {
+			if !s.Time.Before(since) {
+				m.forecaster.Observe(s.Time, s.Disks)
+			}
+		}
+	}
+
+	if m.leaks != nil {
+		m.leaks.Reset()
+		since = r.samples[r.pos].Time.Add(-m.leaks.Window())
+		for _, s := range r.samples[:r.pos] {
+			if !s.Time.Before(since) {
+				observeLeaks(m.leaks, s)
+			}
+		}
+	}
+
+	// Process histories start from the beginning of the recording
+	if m.procHistory != nil {
+		m.procHistory.Reset()
+		for _, s := range r.samples[:r.pos] {
+			observeProcessHistory(m.procHistory, s)
+		}
+	}
+
+	// Baselines are relearned from the samples charted
+	if m.anomalies != nil {
+		m.anomalies.Reset()
+		since = r.samples[r.pos].Time.Add(-chartWindows[len(chartWindows)-1])
+		for _, s := range r.samples[:r.pos] {
+			if !s.Time.Before(since) {
+				m.anomalies.Observe(s.Time, s.Metrics())
+			}
+		}
+	}
+}
+
+// Handles the replay controls, returns false for other keys
+func (m *model) replayKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	r := m.replay
+	switch {
+	case key.Matches(msg, m.keys.Play):
+		r.playing = !r.playing
+		r.gen++
+		if r.playing && r.pos >= len(r.samples)-1 {
+			return m.seek(0), true // Play again from the start
+		}
+		return r.schedule(), true
+	case key.Matches(msg, m.keys.StepBack):
+		r.playing = false
+		return m.seek(r.pos - 1), true
+	case key.Matches(msg, m.keys.StepFwd):
+		r.playing = false
+		return m.seek(r.pos + 1), true
+	case key.Matches(msg, m.keys.Slower), key.Matches(msg, m.keys.Faster):
+		if key.Matches(msg, m.keys.Slower) {
+			r.speed = max(r.speed-1, 0)
+		} else {
+			r.speed = min(r.speed+1, len(replaySpeeds)-1)
+		}
+		r.gen++
+		return r.schedule(), true
+	case key.Matches(msg, m.keys.Jump):
+		r.jumping = true
+		r.input = ""
+		r.jumpErr = ""
+		return nil, true
+	}
+	return nil, false
+}
+
+// Edits the jump prompt, enter jumps and esc cancels
+func (m *model) updateJump(msg tea.KeyMsg) tea.Cmd {
+	r := m.replay
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		r.jumping = false
+	case tea.KeyEnter:
+		r.jumping = false
+		t, err := parseJumpTime(r.input, r.samples[r.pos].Time)
+		if err != nil {
+			r.jumpErr = err.Error()
+			return nil
+		}
+		i := sort.Search(len(r.samples), func(i int) bool { return !r.samples[i].Time.Before(t) })
+		return m.seek(i)
+	case tea.KeyBackspace:
+		if len(r.input) > 0 {
+			r.input = r.input[:len(r.input)-1]
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		r.input += string(msg.Runes)
+	}
+	return nil
+}
+
+// Parses a jump target: a clock time (15:04[:05]) on the current day,
+// a full date and time, or an offset from the current sample (+5m, -30s)
+func parseJumpTime(s string, current time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid offset %q", s)
+		}
+		return current.Add(d), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, current.Location()); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, current.Location()); err == nil {
+			y, mo, d := current.Date()
+			return time.Date(y, mo, d, t.Hour(), t.Minute(), t.Second(), 0, current.Location()), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use 15:04:05, 2006-01-02 15:04:05 or +5m)", s)
+}
+
+// Timeline of the recording with the current position
+// and the alert events, plus the playback state
+func (m model) renderTimeline() string {
+	r := m.replay
+	width := max(m.width-6, 20)
+	first, last := r.samples[0].Time, r.samples[len(r.samples)-1].Time
+	span := last.Sub(first)
+
+	column := func(t time.Time) int {
+		if span <= 0 {
+			return 0
+		}
+		return min(int(float64(t.Sub(first))/float64(span)*float64(width-1)), width-1)
+	}
+
+	played := lipgloss.NewStyle().Foreground(currentTheme.accent)
+	rest := lipgloss.NewStyle().Foreground(currentTheme.muted)
+	cells := make([]string, width)
+	pos := column(r.samples[r.pos].Time)
+	for i := range cells {
+		if i <= pos {
+			cells[i] = played.Render("━")
+		} else {
+			cells[i] = rest.Render("─")
+		}
+	}
+	for _, e := range r.events {
+		if e.firing {
+			cells[column(e.time)] = lipgloss.NewStyle().Foreground(currentTheme.high).Render("▲")
+		} else if c := column(e.time); !strings.Contains(cells[c], "▲") {
+			cells[c] = lipgloss.NewStyle().Foreground(currentTheme.good).Render("▼")
+		}
+	}
+	cells[pos] = played.Bold(true).Render("●")
+
+	state := "▶"
+	switch {
+	case r.jumping:
+		state = "⏸"
+	case !r.playing && r.pos == len(r.samples)-1:
+		state = "■"
+	case !r.playing:
+		state = "⏸"
+	}
+
+	current := r.samples[r.pos].Time
+	info := fmt.Sprintf("%s %gx  %s  (%d/%d)  %s → %s  %s",
+		state, replaySpeeds[r.speed], current.Format("2006-01-02 15:04:05"),
+		r.pos+1, len(r.samples), first.Format("15:04:05"), last.Format("15:04:05"), r.header.Host)
+	switch {
+	case r.jumping:
+		info = "Jump to (15:04:05, 2006-01-02 15:04:05 or ±duration): " + r.input + "█"
+	case r.jumpErr != "":
+		info += "  " + lipgloss.NewStyle().Foreground(currentTheme.critical).Render(r.jumpErr)
+	}
+
+	return baseStyle.AlignHorizontal(lipgloss.Left).Padding(0, 1, 0, 2).Render(strings.Join(cells, "") + "\n" + info)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/export"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/systeminfo"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Address used when neither the config nor -listen set one
+const defaultListen = ":9101"
+
+// syspulse serve: collects in the background and exposes /metrics
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: syspulse serve [flags]")
+		fmt.Fprintln(fs.Output(), "\nCollects metrics periodically and serves them on /metrics in the")
+		fmt.Fprintln(fs.Output(), "Prometheus text format (or OpenMetrics, when the scraper asks for it),\npushing them to the exporters set in the config too and storing them\non disk when the \"tsdb\" section is set.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "path to the config file (default "+config.DefaultPath()+")")
+	listen := fs.String("listen", "", "address of the metrics endpoint (default from config or "+defaultListen+")")
+	interval := fs.Duration("interval", 0, "collection interval (default from config)")
+	processTop := fs.Int("process-top", -2, "processes exported with per-process series, -1 for all, 0 for none (default from config)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		return exitUsage
+	}
+
+	// Flags take precedence over the config file
+	if *listen != "" {
+		cfg.Serve.Listen = *listen
+	}
+	if cfg.Serve.Listen == "" {
+		cfg.Serve.Listen = defaultListen
+	}
+	if *processTop != -2 {
+		cfg.Serve.ProcessTop = *processTop
+	}
+	every, err := serveInterval(cfg.Serve, *interval)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+
+	if err := logger.SysDataLogger(cfg.Log, false); err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening log file:", err)
+	}
+	defer logger.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Disk full estimates and anomaly scores are served and stored along the metrics
+	forecaster, _, err := newDiskForecaster(cfg.Forecast)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	anomalies, err := newAnomalyDetector(cfg.Anomalies)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	watches, err := newWatches(cfg.Watch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+
+	history, err := openTSDB(cfg.TSDB, cfg.Serve.ProcessTop)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+	if history != nil {
+		defer history.close()
+		seedForecast(forecaster, history, time.Now())
+	}
+
+	store := export.NewStore()
+	srv, err := startMetricsServer(cfg.Serve, store)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "Serving metrics on http://%s/metrics\n", srv.Addr)
+
+	exporters, err := buildExporters(cfg.Exporters)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		srv.Close()
+		return exitUsage
+	}
+
+	// Watched processes are listed, and exported, ahead of the top ones
+	opts := systeminfo.CollectOptions{TopProcesses: collectTop(cfg.Serve.ProcessTop, 0), Pinned: watches}
+	processes := newLifecycle()
+	collectLoop(ctx, every, opts, func(s systeminfo.Snapshot) {
+		logCollectorErrors(s)
+		metrics := forecastMetrics(forecaster, s, s.Metrics())
+		metrics = anomalyMetrics(anomalies, s.Time, metrics, false)
+		metrics = processes.observe(s, metrics)
+		metrics = watchMetrics(watches, s, metrics)
+		store.Set(s.Time, metrics, s.Pinned)
+		if exporters != nil {
+			exporters.Submit(s.Time, export.LimitProcesses(metrics, cfg.Serve.ProcessTop, s.Pinned))
+		}
+		if history != nil {
+			history.append(s.Time, metrics, s.Pinned)
+		}
+	})
+
+	if exporters != nil {
+		if err := exporters.Close(); err != nil {
+			logger.Logger.Error("Flushing exporters failed", slog.String("source", "export"), slog.String("error", err.Error()))
+		}
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdown)
+	return exitOK
+}
+
+// Resolves the headless collection interval from the flag or the config
+func serveInterval(cfg config.Serve, flagValue time.Duration) (time.Duration, error) {
+	if flagValue > 0 {
+		return flagValue, nil
+	}
+	if cfg.Interval == "" {
+		return 5 * time.Second, nil
+	}
+	d, err := time.ParseDuration(cfg.Interval)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid serve interval %q", cfg.Interval)
+	}
+	return d, nil
+}
+
+// Number of processes to collect so both the exporters
+// and the TUI (showing the first "shown" ones) get what they need
+func collectTop(processTop, shown int) int {
+	if processTop < 0 {
+		return 0 // Every process
+	}
+	return max(processTop, shown)
+}
+
+// Starts the HTTP server exposing the store on /metrics
+func startMetricsServer(cfg config.Serve, store *export.Store) (*http.Server, error) {
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", cfg.Listen, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", export.PrometheusHandler(store, cfg.ProcessTop))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "syspulse metrics exporter, see /metrics")
+	})
+
+	srv := &http.Server{
+		Addr:              ln.Addr().String(),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Logger.Error("Metrics server stopped", slog.String("source", "serve"), slog.String("error", err.Error()))
+		}
+	}()
+	return srv, nil
+}
+
+// Collects every interval until ctx is done, handing each snapshot to fn
+func collectLoop(ctx context.Context, interval time.Duration, opts systeminfo.CollectOptions, fn func(systeminfo.Snapshot)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(systeminfo.Collect(opts))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Logs the errors of a snapshot through the deduplicating collector logger
+func logCollectorErrors(s systeminfo.Snapshot) {
+	for source, err := range s.Errors {
+		logger.CollectorError(source, collectorMessages[source], err)
+	}
+	if len(s.Errors) == 0 {
+		logger.CollectorError("", "", nil) // Still flush pending summaries
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github/iegpeppino/syspulse/report"
+	"github/iegpeppino/syspulse/systeminfo"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Exit codes of the headless commands
+const (
+	exitOK      = 0
+	exitFailed  = 1 // Nothing could be collected
+	exitUsage   = 2 // Invalid flags (same code the flag package uses)
+	exitPartial = 3 // Some collectors failed
+)
+
+// Accepted spellings of each section name
+var sectionAliases = map[string]string{
+	"cpu":       systeminfo.SectionCPU,
+	"mem":       systeminfo.SectionMemory,
+	"memory":    systeminfo.SectionMemory,
+	"proc":      systeminfo.SectionProcesses,
+	"procs":     systeminfo.SectionProcesses,
+	"processes": systeminfo.SectionProcesses,
+	"disk":      systeminfo.SectionDisks,
+	"disks":     systeminfo.SectionDisks,
+}
+
+// Parses a comma separated list of sections
+// Returns them in display order, "all" selects every section
+func parseSections(list string) ([]string, error) {
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			return systeminfo.Sections, nil
+		}
+		section, ok := sectionAliases[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown section %q (expected cpu, mem, processes, disks or all)", name)
+		}
+		wanted[section] = true
+	}
+	if len(wanted) == 0 {
+		return nil, fmt.Errorf("no sections selected")
+	}
+
+	var sections []string
+	for _, s := range systeminfo.Sections {
+		if wanted[s] {
+			sections = append(sections, s)
+		}
+	}
+	return sections, nil
+}
+
+// Collection options for the given sections
+func sectionOptions(sections []string, top int) systeminfo.CollectOptions {
+	opts := systeminfo.CollectOptions{TopProcesses: top, Sections: map[string]bool{}}
+	for _, s := range sections {
+		opts.Sections[s] = true
+	}
+	return opts
+}
+
+// syspulse snapshot: collects once and prints a report
+func runSnapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: syspulse snapshot [flags]")
+		fmt.Fprintln(fs.Output(), "\nCollects every metric once and prints it.")
+		fmt.Fprintln(fs.Output(), "Exit codes: 0 ok, 1 nothing collected, 2 invalid flags, 3 partial collection.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "json", "output format: "+strings.Join(report.Formats, ", "))
+	sectionList := fs.String("sections", "all", "comma separated sections: cpu, mem, processes, disks")
+	top := fs.Int("top", 10, "number of processes listed, by CPU usage")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	sections, err := parseSections(*sectionList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	if !slices.Contains(report.Formats, *format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected one of %s)\n", *format, strings.Join(report.Formats, ", "))
+		return exitUsage
+	}
+	if *top < 1 {
+		fmt.Fprintln(os.Stderr, "Error: -top must be at least 1")
+		return exitUsage
+	}
+
+	snap := systeminfo.Collect(sectionOptions(sections, *top))
+	doc := report.FromSnapshot(snap, sections)
+
+	if err := report.Write(os.Stdout, doc, *format); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+
+	return statusExitCode(doc.Status.Result)
+}
+
+// Maps a collection status to the command exit code
+func statusExitCode(status report.Status) int {
+	switch status {
+	case report.StatusFailed:
+		return exitFailed
+	case report.StatusPartial:
+		return exitPartial
+	default:
+		return exitOK
+	}
+}
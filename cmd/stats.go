@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+)
+
+// Windows the statistics columns can cover, cycled with the stats key
+// The columns are hidden again after the last one
+var statsWindows = chartWindows
+
+// Narrowest statistics column
+const statsColumnWidth = 10
+
+// Window covered by the statistics columns, 0 when they're hidden
+func (m model) statsWindow() time.Duration {
+	if m.statsIdx == 0 {
+		return 0
+	}
+	return statsWindows[m.statsIdx-1]
+}
+
+// Shows the statistics columns over the next window, or hides them
+func (m *model) cycleStats() {
+	m.statsIdx = (m.statsIdx + 1) % (len(statsWindows) + 1)
+	m.setColumns()
+	m.updateTables()
+}
+
+// Avg, max, p95 and p99 columns, the first one titled with the window
+func statsColumns(prefix string, window time.Duration) []table.Column {
+	titles := []string{prefix + "Avg " + formatWindow(window), prefix + "Max", prefix + "P95", prefix + "P99"}
+	cols := make([]table.Column, len(titles))
+	for i, t := range titles {
+		cols[i] = table.Column{Title: t, Width: max(statsColumnWidth, len(t)+1)}
+	}
+	return cols
+}
+
+// Sets the columns of the tables, adding the statistics ones when shown
+func (m *model) setColumns() {
+	w := m.statsWindow()
+	set := func(t *table.Model, base []table.Column, prefixes ...string) {
+		cols := slices.Clone(base)
+		if w > 0 {
+			for _, p := range prefixes {
+				cols = append(cols, statsColumns(p, w)...)
+			}
+		}
+		t.SetRows(nil) // Rows can't have more cells than there are columns
+		t.SetColumns(cols)
+	}
+	set(&m.cpuTable, cpuColumns, "")
+	set(&m.memTable, memColumns, "")
+	if m.groupMode() != "" {
+		set(&m.procTable, groupColumns) // Groups have no history to summarize
+	} else {
+		set(&m.procTable, procColumns, "CPU ", "RSS ")
+	}
+	set(&m.diskTable, diskColumns, "Use ")
+}
+
+// Cells of the statistics columns of a series over the window ending
+// at the sample shown, none when the columns are hidden
+func (m model) statsCells(name string, labels map[string]string, format func(float64) string) []string {
+	w := m.statsWindow()
+	if w == 0 {
+		return nil
+	}
+	var points []systeminfo.Point
+	if m.history != nil {
+		points = m.history.Range(name, labels, m.sampleTime.Add(-w), m.sampleTime)
+	}
+	s := systeminfo.Summarize(points)
+	if s.Count == 0 {
+		return []string{"-", "-", "-", "-"}
+	}
+	return []string{format(s.Avg), format(s.Max), format(s.P95), format(s.P99)}
+}
+
+func percentCell(v float64) string {
+	return fmt.Sprintf("%.2f%%", v)
+}
+
+func bytesCell(v float64) string {
+	return getByteMagnitude(uint64(max(v, 0)))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github/iegpeppino/syspulse/report"
+	"github/iegpeppino/syspulse/systeminfo"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// syspulse stream: prints one JSON document per interval (NDJSON)
+func runStream(args []string) int {
+	fs := flag.NewFlagSet("stream", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: syspulse stream [flags]")
+		fmt.Fprintln(fs.Output(), "\nPrints one JSON document per line every interval, using the snapshot schema.")
+		fmt.Fprintln(fs.Output(), "Stops after -count documents, on SIGINT/SIGTERM or when the reader goes away.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	interval := fs.Duration("interval", time.Second, "time between documents (collecting CPU usage takes 1s)")
+	count := fs.Int("count", 0, "number of documents to print, 0 streams until interrupted")
+	familyList := fs.String("families", "all", "comma separated metric families: cpu, mem, processes, disks")
+	top := fs.Int("top", 10, "number of processes included, by CPU usage")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	families, err := parseSections(*familyList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	if *interval <= 0 || *count < 0 || *top < 1 {
+		fmt.Fprintln(os.Stderr, "Error: -interval must be positive, -count can't be negative and -top must be at least 1")
+		return exitUsage
+	}
+
+	// Stop on interrupt, and turn a closed pipe into a write error
+	// instead of the default SIGPIPE crash
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	signal.Ignore(syscall.SIGPIPE)
+
+	enc := json.NewEncoder(os.Stdout)
+	opts := sectionOptions(families, *top)
+
+	next := time.Now()
+	for n := 0; *count == 0 || n < *count; n++ {
+		if n > 0 {
+			select {
+			case <-ctx.Done():
+				return exitOK
+			case <-time.After(time.Until(next)):
+			}
+		}
+		next = next.Add(*interval)
+
+		doc := report.FromSnapshot(systeminfo.Collect(opts), families)
+		if ctx.Err() != nil {
+			return exitOK
+		}
+		if err := enc.Encode(doc); err != nil {
+			if errors.Is(err, syscall.EPIPE) {
+				return exitOK // Reader is gone (e.g. "| head")
+			}
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitFailed
+		}
+
+		// Don't pile up late documents when collecting is slower than the interval
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+	}
+
+	return exitOK
+}
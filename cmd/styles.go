@@ -10,7 +10,7 @@ func TableStyle() table.Styles {
 	s.Header = s.Header.
 		Margin(2, 0, 0, 0).
 		BorderStyle(lipgloss.NormalBorder()).
-		BorderForeground(lipgloss.Color("#FFBF00")).
+		BorderForeground(currentTheme.accent).
 		BorderBottom(true).
 		AlignVertical(lipgloss.Center).
 		Bold(false)
@@ -19,32 +19,15 @@ func TableStyle() table.Styles {
 		Padding(1, 0, 0, 1)
 
 	s.Selected = s.Selected.
-		Foreground(lipgloss.Color("229")).
+		Foreground(currentTheme.selected).
 		Bold(false)
 	return s
 }
 
-// Defining used colors
-var (
-	normal = lipgloss.Color("#EEEEEE")
-	subtle = lipgloss.AdaptiveColor{Light: "#D9DCCF", Dark: "#383838"}
-	green  = lipgloss.Color("#139213ff")
-	yellow = lipgloss.Color("#f1f155ff")
-	orange = lipgloss.Color("#FFA500")
-	red    = lipgloss.Color("#d62222ff")
-	gray   = lipgloss.Color("#444444")
-	white  = lipgloss.Color("#FBFBFB")
-	amber  = lipgloss.Color("#FFBF00")
-)
+// Theme every style is currently built from
+var currentTheme = builtinThemes[0]
 
 var (
-	baseStyle = lipgloss.NewStyle().
-			BorderForeground(lipgloss.Color("#FFBF00")).
-			Bold(true).
-			Padding(1, 1, 1, 2).
-			Margin(0, 0, 0, 2).
-			AlignHorizontal(lipgloss.Center)
-
 	activeTabBorder = lipgloss.Border{
 		Top:         "─",
 		Bottom:      " ",
@@ -67,11 +50,42 @@ var (
 		BottomRight: "┴",
 	}
 
-	base = lipgloss.NewStyle().Foreground(normal)
+	pageContentStyle = lipgloss.NewStyle().
+				Height(32)
+
+	// Charts drawn beside the tables
+	chartPanel = lipgloss.NewStyle().
+			Margin(2, 0, 0, 4)
+)
+
+// Styles depending on theme colors, (re)built by applyTheme
+var (
+	baseStyle  lipgloss.Style
+	tab        lipgloss.Style
+	activeTab  lipgloss.Style
+	tabGap     lipgloss.Style
+	gauge      lipgloss.Style
+	titleStyle lipgloss.Style
+)
+
+func init() {
+	applyTheme(currentTheme)
+}
+
+// Rebuilds every themed style using the given theme colors
+func applyTheme(th theme) {
+	currentTheme = th
+
+	baseStyle = lipgloss.NewStyle().
+		BorderForeground(th.accent).
+		Bold(true).
+		Padding(1, 1, 1, 2).
+		Margin(0, 0, 0, 2).
+		AlignHorizontal(lipgloss.Center)
 
 	tab = lipgloss.NewStyle().
 		Border(tabBorder, true).
-		BorderForeground(amber).
+		BorderForeground(th.accent).
 		Padding(0, 1)
 
 	activeTab = tab.Border(activeTabBorder, true)
@@ -82,35 +96,32 @@ var (
 		BorderRight(false)
 
 	gauge = lipgloss.NewStyle().
-		Foreground(normal).
+		Foreground(th.text).
 		Margin(1, 1).
 		Padding(1, 1)
 
 	titleStyle = lipgloss.NewStyle().
-			Margin(2, 5, 1, 5).
-			Padding(0, 1, 0, 1).
-			Italic(true).
-			Bold(true).
-			Foreground(lipgloss.Color(normal)).
-			BorderStyle(lipgloss.NormalBorder()).
-			BorderForeground(amber).
-			BorderBottom(true)
-
-	pageContentStyle = lipgloss.NewStyle().
-				Height(32)
-)
-
-//pageContentStyle.Render()
+		Margin(2, 5, 1, 5).
+		Padding(0, 1, 0, 1).
+		Italic(true).
+		Bold(true).
+		Foreground(th.text).
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(th.accent).
+		BorderBottom(true)
+}
 
-func gaugeProgress(cpuPercent float64) lipgloss.Color {
+// Returns the gauge color matching the load
+// according to the current theme thresholds
+func gaugeProgress(cpuPercent float64) lipgloss.TerminalColor {
 	switch {
-	case cpuPercent < 50:
-		return green
-	case cpuPercent < 75:
-		return yellow
-	case cpuPercent < 90:
-		return orange
+	case cpuPercent < currentTheme.warnAt:
+		return currentTheme.good
+	case cpuPercent < currentTheme.highAt:
+		return currentTheme.warn
+	case cpuPercent < currentTheme.criticalAt:
+		return currentTheme.high
 	default:
-		return red
+		return currentTheme.critical
 	}
 }
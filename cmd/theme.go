@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// Color palette and gauge thresholds used to build every style
+type theme struct {
+	name     string
+	accent   lipgloss.TerminalColor // Borders, separators and tabs
+	text     lipgloss.TerminalColor // Regular text
+	muted    lipgloss.TerminalColor // Empty part of gauges
+	good     lipgloss.TerminalColor // Load below warnAt
+	warn     lipgloss.TerminalColor // Load below highAt
+	high     lipgloss.TerminalColor // Load below criticalAt
+	critical lipgloss.TerminalColor // Load above criticalAt
+	selected lipgloss.TerminalColor // Selected table row
+
+	warnAt     float64
+	highAt     float64
+	criticalAt float64
+}
+
+// Built-in themes, in the order they are cycled through
+// Every color carries its 256 and 16 color fallbacks
+var builtinThemes = []theme{
+	{
+		name:       "amber",
+		accent:     lipgloss.CompleteColor{TrueColor: "#FFBF00", ANSI256: "214", ANSI: "11"},
+		text:       lipgloss.CompleteColor{TrueColor: "#EEEEEE", ANSI256: "255", ANSI: "15"},
+		muted:      lipgloss.CompleteColor{TrueColor: "#444444", ANSI256: "238", ANSI: "8"},
+		good:       lipgloss.CompleteColor{TrueColor: "#139213", ANSI256: "28", ANSI: "2"},
+		warn:       lipgloss.CompleteColor{TrueColor: "#F1F155", ANSI256: "227", ANSI: "11"},
+		high:       lipgloss.CompleteColor{TrueColor: "#FFA500", ANSI256: "214", ANSI: "3"},
+		critical:   lipgloss.CompleteColor{TrueColor: "#D62222", ANSI256: "160", ANSI: "9"},
+		selected:   lipgloss.CompleteColor{TrueColor: "#FFFFAF", ANSI256: "229", ANSI: "11"},
+		warnAt:     50,
+		highAt:     75,
+		criticalAt: 90,
+	},
+	{
+		name:       "light",
+		accent:     lipgloss.CompleteColor{TrueColor: "#1F5FAF", ANSI256: "25", ANSI: "4"},
+		text:       lipgloss.CompleteColor{TrueColor: "#1C1C1C", ANSI256: "234", ANSI: "0"},
+		muted:      lipgloss.CompleteColor{TrueColor: "#BCBCBC", ANSI256: "250", ANSI: "7"},
+		good:       lipgloss.CompleteColor{TrueColor: "#008700", ANSI256: "28", ANSI: "2"},
+		warn:       lipgloss.CompleteColor{TrueColor: "#AF8700", ANSI256: "136", ANSI: "3"},
+		high:       lipgloss.CompleteColor{TrueColor: "#D75F00", ANSI256: "166", ANSI: "3"},
+		critical:   lipgloss.CompleteColor{TrueColor: "#AF0000", ANSI256: "124", ANSI: "1"},
+		selected:   lipgloss.CompleteColor{TrueColor: "#005FD7", ANSI256: "26", ANSI: "4"},
+		warnAt:     50,
+		highAt:     75,
+		criticalAt: 90,
+	},
+	{
+		name:       "high-contrast",
+		accent:     lipgloss.CompleteColor{TrueColor: "#FFFFFF", ANSI256: "231", ANSI: "15"},
+		text:       lipgloss.CompleteColor{TrueColor: "#FFFFFF", ANSI256: "231", ANSI: "15"},
+		muted:      lipgloss.CompleteColor{TrueColor: "#808080", ANSI256: "244", ANSI: "8"},
+		good:       lipgloss.CompleteColor{TrueColor: "#00FF00", ANSI256: "46", ANSI: "10"},
+		warn:       lipgloss.CompleteColor{TrueColor: "#FFFF00", ANSI256: "226", ANSI: "11"},
+		high:       lipgloss.CompleteColor{TrueColor: "#FF8700", ANSI256: "208", ANSI: "11"},
+		critical:   lipgloss.CompleteColor{TrueColor: "#FF0000", ANSI256: "196", ANSI: "9"},
+		selected:   lipgloss.CompleteColor{TrueColor: "#00FFFF", ANSI256: "51", ANSI: "14"},
+		warnAt:     50,
+		highAt:     75,
+		criticalAt: 90,
+	},
+	{
+		// Okabe-Ito palette, distinguishable with the common color vision deficiencies
+		name:       "colorblind",
+		accent:     lipgloss.CompleteColor{TrueColor: "#56B4E9", ANSI256: "74", ANSI: "14"},
+		text:       lipgloss.CompleteColor{TrueColor: "#EEEEEE", ANSI256: "255", ANSI: "15"},
+		muted:      lipgloss.CompleteColor{TrueColor: "#444444", ANSI256: "238", ANSI: "8"},
+		good:       lipgloss.CompleteColor{TrueColor: "#0072B2", ANSI256: "25", ANSI: "4"},
+		warn:       lipgloss.CompleteColor{TrueColor: "#F0E442", ANSI256: "227", ANSI: "11"},
+		high:       lipgloss.CompleteColor{TrueColor: "#E69F00", ANSI256: "214", ANSI: "3"},
+		critical:   lipgloss.CompleteColor{TrueColor: "#D55E00", ANSI256: "166", ANSI: "1"},
+		selected:   lipgloss.CompleteColor{TrueColor: "#CC79A7", ANSI256: "175", ANSI: "13"},
+		warnAt:     50,
+		highAt:     75,
+		criticalAt: 90,
+	},
+	{
+		name:       "mono",
+		accent:     lipgloss.NoColor{},
+		text:       lipgloss.NoColor{},
+		muted:      lipgloss.NoColor{},
+		good:       lipgloss.NoColor{},
+		warn:       lipgloss.NoColor{},
+		high:       lipgloss.NoColor{},
+		critical:   lipgloss.NoColor{},
+		selected:   lipgloss.NoColor{},
+		warnAt:     50,
+		highAt:     75,
+		criticalAt: 90,
+	},
+}
+
+// Accepts "#RGB", "#RRGGBB" or an ANSI color code between 0 and 255
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])$`)
+
+// Detects the terminal color support and honours NO_COLOR
+// Returns false when the terminal can't render any color at all
+func detectColorSupport() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		lipgloss.SetColorProfile(termenv.Ascii)
+		return false
+	}
+	return lipgloss.ColorProfile() != termenv.Ascii
+}
+
+// Builds the list of selectable themes (built-in ones followed by
+// user defined ones) and returns the index of the configured theme
+func loadThemes(cfg *config.Config, colors bool) ([]theme, int, error) {
+	themes := make([]theme, len(builtinThemes))
+	copy(themes, builtinThemes)
+
+	// Sort user themes so cycling order is stable
+	names := make([]string, 0, len(cfg.Themes))
+	for name := range cfg.Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		th, err := userTheme(name, cfg.Themes[name])
+		if err != nil {
+			return nil, 0, err
+		}
+		// User themes may override built-in ones with the same name
+		if i := findTheme(themes, name); i >= 0 {
+			themes[i] = th
+			continue
+		}
+		themes = append(themes, th)
+	}
+
+	// Without color support only the monochrome theme makes sense
+	if !colors {
+		return themes, findTheme(themes, "mono"), nil
+	}
+
+	name := cfg.Theme
+	if name == "" {
+		name = "amber"
+	}
+	idx := findTheme(themes, name)
+	if idx < 0 {
+		return nil, 0, fmt.Errorf("unknown theme %q", name)
+	}
+
+	return themes, idx, nil
+}
+
+// Converts a config theme into a theme inheriting unset fields from its base
+func userTheme(name string, t config.Theme) (theme, error) {
+	baseName := t.Base
+	if baseName == "" {
+		baseName = "amber"
+	}
+	i := findTheme(builtinThemes, baseName)
+	if i < 0 {
+		return theme{}, fmt.Errorf("theme %q: unknown base theme %q", name, baseName)
+	}
+
+	th := builtinThemes[i]
+	th.name = name
+
+	colors := []struct {
+		value string
+		dst   *lipgloss.TerminalColor
+	}{
+		{t.Accent, &th.accent},
+		{t.Text, &th.text},
+		{t.Muted, &th.muted},
+		{t.Good, &th.good},
+		{t.Warn, &th.warn},
+		{t.High, &th.high},
+		{t.Critical, &th.critical},
+		{t.Selected, &th.selected},
+	}
+	for _, c := range colors {
+		if c.value == "" {
+			continue
+		}
+		if !colorPattern.MatchString(c.value) {
+			return theme{}, fmt.Errorf("theme %q: invalid color %q", name, c.value)
+		}
+		*c.dst = lipgloss.Color(c.value)
+	}
+
+	if t.WarnAt > 0 {
+		th.warnAt = t.WarnAt
+	}
+	if t.HighAt > 0 {
+		th.highAt = t.HighAt
+	}
+	if t.CriticalAt > 0 {
+		th.criticalAt = t.CriticalAt
+	}
+	if !(th.warnAt < th.highAt && th.highAt < th.criticalAt) {
+		return theme{}, fmt.Errorf("theme %q: thresholds must be increasing (warn < high < critical)", name)
+	}
+
+	return th, nil
+}
+
+// Returns the index of the theme with the given name or -1
+func findTheme(themes []theme, name string) int {
+	for i, th := range themes {
+		if th.name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// How long live snapshots are kept for time travel by default
+const defaultTravelWindow = 15 * time.Minute
+
+// Processes of a kept snapshot by PID, rates while traveling are taken against them
+type pastProcesses struct {
+	time  time.Time
+	byPID map[int32]systeminfo.ProcessSample
+}
+
+// Keeps a live snapshot, dropping the ones older than the window
+// Only the latest one keeps every process in full, the others a slimmed
+// down list, as command lines of a 15 minute window add up to hundreds of MB
+func (m *model) retain(s systeminfo.Snapshot) {
+	if n := len(m.past); n > 0 {
+		m.past[n-1].AllProcesses = m.slim(m.past[n-1].AllProcesses)
+	}
+	m.past = append(m.past, s)
+
+	drop := 0
+	for drop < len(m.past)-1 && s.Time.Sub(m.past[drop].Time) > m.pastWindow {
+		drop++
+	}
+	if drop == 0 {
+		return
+	}
+	m.past = m.past[drop:]
+
+	// Stay on the same sample, or on the oldest one left if it was dropped
+	if m.traveling {
+		if m.viewIdx -= drop; m.viewIdx < 0 {
+			m.travelTo(0)
+		}
+	}
+}
+
+// Processes of a past snapshot with what grouping, the watch list and
+// rates need. Command lines are only kept when a cmdline pattern matches
+func (m model) slim(procs []systeminfo.ProcessSample) []systeminfo.ProcessSample {
+	kept := make([]systeminfo.ProcessSample, len(procs))
+	for i, p := range procs {
+		kept[i] = systeminfo.ProcessSample{
+			PID: p.PID, Name: p.Name, User: p.User, Started: p.Started,
+			CPU: p.CPU, CPUTime: p.CPUTime, RSS: p.RSS,
+			ReadBytes: p.ReadBytes, WriteBytes: p.WriteBytes,
+		}
+		if m.cmdlineMatters(p.Cmdline) {
+			kept[i].Cmdline = p.Cmdline
+		}
+	}
+	return kept
+}
+
+// Reports whether a watch list entry or group rule matches the command line
+func (m model) cmdlineMatters(cmdline string) bool {
+	for _, rules := range [][]systeminfo.Watch{m.watches, m.groupRules} {
+		for _, w := range rules {
+			if w.Cmdline != nil && w.Cmdline.MatchString(cmdline) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Shows the kept snapshot at index i, going back to live past the newest one
+func (m *model) travelTo(i int) {
+	if len(m.past) == 0 {
+		return
+	}
+	i = max(i, 0)
+	if i >= len(m.past)-1 {
+		m.goLive()
+		return
+	}
+
+	m.traveling = true
+	m.viewIdx = i
+
+	// Deltas and process rates compare against the sample before the one shown
+	prev := m.past[max(m.viewIdx-1, 0)]
+	m.cpuStats = prev.CPUTimes
+	m.travelPrev = pastProcesses{}
+	if i > 0 {
+		m.travelPrev = pastProcesses{time: prev.Time, byPID: make(map[int32]systeminfo.ProcessSample, len(prev.AllProcesses))}
+		for _, p := range prev.AllProcesses {
+			m.travelPrev.byPID[p.PID] = p
+		}
+	}
+	m.showSnapshot(m.past[m.viewIdx])
+}
+
+// Goes back to showing the latest sample
+func (m *model) goLive() {
+	m.traveling = false
+	m.travelPrev = pastProcesses{}
+	if n := len(m.past); n > 0 {
+		m.cpuStats = m.past[max(n-2, 0)].CPUTimes
+		m.showSnapshot(m.past[n-1])
+	}
+}
+
+// Index of the first kept snapshot taken at or after t
+func (m model) pastIndex(t time.Time) int {
+	return sort.Search(len(m.past), func(i int) bool { return !m.past[i].Time.Before(t) })
+}
+
+// Handles the time travel keys
+func (m *model) travelKey(msg tea.KeyMsg) {
+	pos := len(m.past) - 1
+	if m.traveling {
+		pos = m.viewIdx
+	}
+	if pos < 0 {
+		return
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Back):
+		m.travelTo(pos - 1)
+	case key.Matches(msg, m.keys.Forward):
+		m.travelTo(pos + 1)
+	case key.Matches(msg, m.keys.BackMinute):
+		// Last sample taken a minute or more before the one shown
+		target := m.past[pos].Time.Add(-time.Minute)
+		i := m.pastIndex(target)
+		if i == len(m.past) || m.past[i].Time.After(target) {
+			i--
+		}
+		m.travelTo(i)
+	case key.Matches(msg, m.keys.ForwardMinute):
+		m.travelTo(m.pastIndex(m.past[pos].Time.Add(time.Minute)))
+	case key.Matches(msg, m.keys.Live):
+		m.goLive()
+	}
+}
+
+// Banner shown above the tabs while looking at a past sample
+func (m model) travelBanner() string {
+	shown := m.past[m.viewIdx].Time
+	ago := m.past[len(m.past)-1].Time.Sub(shown).Round(time.Second)
+
+	text := fmt.Sprintf("⏪ viewing T-%s  (%s, %d/%d kept)", ago, shown.Format("15:04:05"), m.viewIdx+1, len(m.past))
+	k := m.keys
+	hint := fmt.Sprintf("%s/%s step • %s/%s minute • %s live",
+		k.Back.Help().Key, k.Forward.Help().Key, k.BackMinute.Help().Key, k.ForwardMinute.Help().Key, k.Live.Help().Key)
+	return lipgloss.NewStyle().
+		Bold(true).
+		Foreground(currentTheme.warn).
+		MarginLeft(4).
+		Render(text) +
+		lipgloss.NewStyle().Foreground(currentTheme.muted).Render("  "+hint)
+}
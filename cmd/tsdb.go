@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/export"
+	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/systeminfo"
+	"github/iegpeppino/syspulse/tsdb"
+	"path/filepath"
+	"time"
+)
+
+// Default time between samples stored on disk
+const defaultTSDBInterval = 10 * time.Second
+
+// Stores collected samples in the on-disk store, at most one per interval
+type tsdbWriter struct {
+	db    *tsdb.DB
+	every time.Duration
+	top   int // Processes stored with per-process series
+	last  time.Time
+}
+
+// Opens the store set in the config, nil when it's disabled
+func openTSDB(cfg *config.TSDB, processTop int) (*tsdbWriter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	dir, err := tsdbDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	every := defaultTSDBInterval
+	if cfg.Interval != "" {
+		every, err = time.ParseDuration(cfg.Interval)
+		if err != nil || every <= 0 {
+			return nil, fmt.Errorf("tsdb: invalid interval %q", cfg.Interval)
+		}
+	}
+
+	retention := map[string]time.Duration{}
+	for tier, v := range cfg.Retention {
+		d, err := tsdb.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("tsdb: %s tier: %w", tier, err)
+		}
+		retention[tier] = d
+	}
+
+	db, err := tsdb.Open(tsdb.Options{
+		Dir:       dir,
+		Retention: retention,
+		OnError: func(err error) {
+			logger.CollectorError("tsdb", "Compaction failed", err)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tsdbWriter{db: db, every: every, top: processTop}, nil
+}
+
+// Directory of the store, $XDG_STATE_HOME/syspulse/tsdb by default
+func tsdbDir(cfg *config.TSDB) (string, error) {
+	if cfg != nil && cfg.Path != "" {
+		return cfg.Path, nil
+	}
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tsdb"), nil
+}
+
+// Stores a sample unless the previous one is too recent
+func (w *tsdbWriter) append(t time.Time, metrics []systeminfo.Metric, pinned int) {
+	if t.Sub(w.last) < w.every {
+		return
+	}
+	w.last = t
+	if err := w.db.Append(t, export.LimitProcesses(metrics, w.top, pinned)); err != nil {
+		logger.CollectorError("tsdb", "Storing sample failed", err)
+	}
+}
+
+func (w *tsdbWriter) close() {
+	if err := w.db.Close(); err != nil {
+		logger.CollectorError("tsdb", "Closing store failed", err)
+	}
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"fmt"
+	"github/iegpeppino/syspulse/alert"
+	"github/iegpeppino/syspulse/analysis"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/export"
 	"github/iegpeppino/syspulse/logger"
+	"github/iegpeppino/syspulse/recording"
 	"github/iegpeppino/syspulse/systeminfo"
 	"log/slog"
 	"os"
@@ -26,60 +31,76 @@ type model struct {
 	width           int
 	keys            keyMap
 	help            help.Model
+	themes          []theme
+	themeIdx        int
 	cpuTotalPercent float64
 	cpuStats        cpu.TimesStat
 	cpuPrevStats    cpu.TimesStat
 	cpuTable        table.Model
 	processes       []systeminfo.ProcessInfo
+	pinned          int // Watched processes listed first in processes
+	watches         []systeminfo.Watch
+	watchMissing    []string                   // Watch list entries no process matches
+	samples         []systeminfo.ProcessSample // Every process of the sample shown, grouped when grouping
+	groupIdx        int                        // Index in groupModes of the grouping shown
+	sortIdx         int                        // Index in sortModes of the order of the PROCESSES tab
+	groupRules      []systeminfo.Watch
+	expanded        map[string]bool // Groups listing their members
+	groupRows       []groupRow      // What each row of the grouped table holds
 	procTable       table.Model
+	procHistory     *systeminfo.ProcessHistory // Bounded history of every process seen
+	inspected       *procRef                   // Process whose history is shown, nil for the table
 	memory          mem.VirtualMemoryStat
 	memTable        table.Model
 	disk            []systeminfo.DiskInfo
 	diskTable       table.Model
+	collectOpts     systeminfo.CollectOptions
+	history         *systeminfo.History   // Recent values of every series, drawn by the charts
+	sampleTime      time.Time             // Time of the sample shown
+	windowIdx       int                   // Index in chartWindows of the window charted
+	statsIdx        int                   // Index in statsWindows of the statistics columns window, plus one, 0 hides them
+	past            []systeminfo.Snapshot // Recent live snapshots kept for time travel, oldest first
+	pastWindow      time.Duration         // How long snapshots are kept
+	traveling       bool                  // Showing a past snapshot instead of the live one
+	viewIdx         int                   // Index in past of the snapshot shown while traveling
+	travelPrev      pastProcesses         // Processes of the snapshot before the one shown
+	store           *export.Store         // Metrics served on /metrics, nil when not serving
+	exporters       *export.Runner        // Push exporters, nil when none is configured
+	exportTop       int                   // Processes exported with per-process series
+	tsdb            *tsdbWriter           // On-disk history, nil when disabled
+	forecaster      *analysis.DiskForecaster
+	forecastHorizon time.Duration // Filesystems expected to fill within it are highlighted
+	leaks           *analysis.LeakDetector
+	anomalies       *analysis.AnomalyDetector // nil when detection is disabled
+	recordCfg       config.Record
+	recorder        *recording.Recorder // Session being recorded, nil when not recording
+	replay          *replayState        // Recording played back, nil when live
+	alerts          *alert.Engine
+	firing          int        // Number of firing alerts
+	lifecycle       *lifecycle // Processes starting and exiting
+	eventsTable     table.Model
+	logTable        table.Model
+	logLevel        int    // Index in logLevels of the minimum level shown
+	logSource       string // Source shown in the LOG tab, "" for all
+	seenSeq         uint64 // Last event seen in the LOG tab
 	err             error
 }
 
-// Setup for key bindings
-type keyMap struct {
-	Left  key.Binding
-	Right key.Binding
-	Help  key.Binding
-	Quit  key.Binding
-}
-
-// Setting help message formats
-func (k keyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Help, k.Quit}
-}
-
-func (k keyMap) FullHelp() [][]key.Binding {
-	return [][]key.Binding{
-		{k.Left, k.Right, k.Help, k.Quit},
-	}
-}
-
-// Set key bindings using lipgloss.help
-var keys = keyMap{
-	Left: key.NewBinding(
-		key.WithKeys("left", "a"),
-		key.WithHelp("←/a", "switch tab to left"),
-	),
-	Right: key.NewBinding(
-		key.WithKeys("right", "d"),
-		key.WithHelp("→/d", "switch tab to right"),
-	),
-	Help: key.NewBinding(
-		key.WithKeys("h"),
-		key.WithHelp("h", "toggle help"),
-	),
-	Quit: key.NewBinding(
-		key.WithKeys("q", "esc", "ctrl+c"),
-		key.WithHelp("q", "quit"),
-	),
-}
+// Tab indexes, in display order
+const (
+	cpuTab = iota
+	memTab
+	procTab
+	diskTab
+	eventsTab
+	logTab
+)
 
 type tickMsg struct{}
 
+// Result of a collection pass
+type snapshotMsg systeminfo.Snapshot
+
 // Setting the ticker for 500 milliseconds intervals
 func tick() tea.Cmd {
 	return tea.Tick(500*time.Millisecond, func(t time.Time) tea.Msg {
@@ -87,7 +108,21 @@ func tick() tea.Cmd {
 	})
 }
 
+// Number of processes listed in the PROCESSES tab
+const shownProcesses = 7
+
+// Runs every collector outside of the update loop
+// since reading the CPU percent blocks for a second
+func collect(opts systeminfo.CollectOptions) tea.Cmd {
+	return func() tea.Msg {
+		return snapshotMsg(systeminfo.Collect(opts))
+	}
+}
+
 func (m model) Init() tea.Cmd {
+	if m.replay != nil {
+		return replaySample(m.replay.samples[0])
+	}
 	return tick()
 }
 
@@ -104,128 +139,275 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		m.help.Width = msg.Width
 
-	// In case of tick
+	// In case of tick, collect stats in the background
 	case tickMsg:
+		return m, collect(m.collectOpts)
 
-		// Get and update system stats
-		cpuPercent, err := systeminfo.GetCPUPercent()
-		if err != nil {
-			logger.Logger.Error("Couldn't get CPU times", slog.String("error", err.Error()))
+	// Get and update system stats
+	case snapshotMsg:
+		m.applySnapshot(systeminfo.Snapshot(msg))
+		if m.replay != nil {
+			return m, m.replay.schedule()
 		}
-		m.cpuTotalPercent = cpuPercent
+		return m, tick()
 
-		mem, err := systeminfo.GetMEMLoad()
-		if err != nil {
-			logger.Logger.Error("Couldn't get memory stats", slog.String("error", err.Error()))
-		}
-		m.memory = *mem
-
-		// Compare previous cpuTimes with current
-		// and observe increment or decrement tendency
-		cpuTimes, _ := systeminfo.GetCPULoad()
-		if len(cpuTimes) > 0 {
-			m.cpuPrevStats = m.cpuStats
-			m.cpuStats = cpuTimes[0]
+	// Next sample of a replay
+	case replayTickMsg:
+		if m.replay != nil {
+			return m, m.replayTick(msg)
 		}
 
-		processes, err := systeminfo.GetProcessInfo(7)
-		if err != nil {
-			logger.Logger.Error("Unable to read running processes", slog.String("error", err.Error()))
+	// Handle key pressing events
+	case tea.KeyMsg:
+		if m.replay != nil {
+			if m.replay.jumping {
+				return m, m.updateJump(msg)
+			}
+			if cmd, ok := m.replayKey(msg); ok {
+				return m, cmd
+			}
+		}
+		switch {
+		case key.Matches(msg, m.keys.Left):
+			m.switchTab(max(m.ActiveTab-1, 0)) // Decrement activeTab if possible
+			return m, cmd
+		case key.Matches(msg, m.keys.Right):
+			m.switchTab(min(m.ActiveTab+1, len(m.tabs)-1)) // Increment activeTab if possible
+			return m, cmd
+		case key.Matches(msg, m.keys.Help):
+			m.help.ShowAll = !m.help.ShowAll // Show full help message
+		case key.Matches(msg, m.keys.Theme):
+			m.setTheme((m.themeIdx + 1) % len(m.themes)) // Switch to next theme
+			logger.Logger.Info("Theme changed", slog.String("source", "user"), slog.String("theme", currentTheme.name))
+		case key.Matches(msg, m.keys.LogLevel):
+			m.cycleLogLevel()
+		case key.Matches(msg, m.keys.LogSource):
+			m.cycleLogSource()
+		case key.Matches(msg, m.keys.Record):
+			m.toggleRecording()
+		case key.Matches(msg, m.keys.Window):
+			m.cycleWindow()
+		case key.Matches(msg, m.keys.Stats):
+			m.cycleStats()
+		case key.Matches(msg, m.keys.Select):
+			m.toggleDetail()
+		case key.Matches(msg, m.keys.Group):
+			m.cycleGroup()
+		case key.Matches(msg, m.keys.Sort):
+			m.cycleSort()
+		case key.Matches(msg, m.keys.Back), key.Matches(msg, m.keys.Forward),
+			key.Matches(msg, m.keys.BackMinute), key.Matches(msg, m.keys.ForwardMinute),
+			key.Matches(msg, m.keys.Live):
+			m.travelKey(msg)
+		case key.Matches(msg, m.keys.Quit):
+			return m, tea.Quit // Quit program :(
+		default:
+			// Let the process, log and events tables scroll
+			switch m.ActiveTab {
+			case procTab:
+				if m.inspected == nil {
+					m.procTable, cmd = m.procTable.Update(msg)
+				}
+				return m, cmd
+			case logTab:
+				m.logTable, cmd = m.logTable.Update(msg)
+				return m, cmd
+			case eventsTab:
+				m.eventsTable, cmd = m.eventsTable.Update(msg)
+				return m, cmd
+			}
 		}
-		m.processes = processes
 
-		disks, err := systeminfo.GetDISKUse()
-		if err != nil {
-			logger.Logger.Error("Disk info error", slog.String("error", err.Error()))
+	}
+
+	return m, nil
+}
+
+// Messages logged for each failing collector
+var collectorMessages = map[string]string{
+	"cpu_percent": "Couldn't get CPU percent",
+	"cpu_times":   "Couldn't get CPU times",
+	"memory":      "Couldn't get memory stats",
+	"swap":        "Couldn't get swap stats",
+	"process":     "Unable to read running processes",
+	"disk":        "Disk info error",
+}
+
+// Handles a new sample: shares, records and shows it
+func (m *model) applySnapshot(s systeminfo.Snapshot) {
+	metrics := forecastMetrics(m.forecaster, s, s.Metrics())
+	metrics = anomalyMetrics(m.anomalies, s.Time, metrics, m.replay != nil)
+	observeLeaks(m.leaks, s)
+	observeProcessHistory(m.procHistory, s)
+	metrics = m.lifecycle.observe(s, metrics)
+	metrics = watchMetrics(m.watches, s, metrics)
+	m.history.Add(s.Time, metrics) // Once every derived metric is in
+
+	// Live samples are logged, shared and recorded, replayed ones only shown
+	if m.replay == nil {
+		logCollectorErrors(s)
+
+		// Share the metrics with the /metrics endpoint and the push exporters
+		if m.store != nil {
+			m.store.Set(s.Time, metrics, s.Pinned)
 		}
-		m.disk = disks
-
-		// Update CPU table information
-		cpuRows := []table.Row{
-			{"User", fmt.Sprintf("%.2f%%", m.cpuStats.User), delta(m.cpuStats.User, m.cpuPrevStats.User)},
-			{"System", fmt.Sprintf("%.2f%%", m.cpuStats.System), delta(m.cpuStats.System, m.cpuPrevStats.System)},
-			{"Idle", fmt.Sprintf("%.2f%%", m.cpuStats.Idle), delta(m.cpuStats.Idle, m.cpuPrevStats.Idle)},
-			{"Nice", fmt.Sprintf("%.2f%%", m.cpuStats.Nice), delta(m.cpuStats.Nice, m.cpuPrevStats.Nice)},
-			{"Guest", fmt.Sprintf("%.2f%%", m.cpuStats.Guest), delta(m.cpuStats.Guest, m.cpuPrevStats.Guest)},
-			{"IRQ", fmt.Sprintf("%.2f%%", m.cpuStats.Irq), delta(m.cpuStats.Irq, m.cpuPrevStats.Irq)},
-			{"SoftIRQ", fmt.Sprintf("%.2f%%", m.cpuStats.Softirq), delta(m.cpuStats.Softirq, m.cpuPrevStats.Softirq)},
+		if m.exporters != nil {
+			m.exporters.Submit(s.Time, export.LimitProcesses(metrics, m.exportTop, s.Pinned))
+		}
+		if m.tsdb != nil {
+			m.tsdb.append(s.Time, metrics, s.Pinned)
 		}
 
-		m.cpuTable.SetRows(cpuRows)
-
-		// Update RAM table information
-		memRows := []table.Row{
-			{"Total", fmt.Sprintf("%s", getByteMagnitude(m.memory.Total))},
-			{"Used", fmt.Sprintf("%s", getByteMagnitude(m.memory.Used))},
-			{"Available", fmt.Sprintf("%s", getByteMagnitude(m.memory.Available))},
-			{"Free", fmt.Sprintf("%s", getByteMagnitude(m.memory.Free))},
-			{"Buffers", fmt.Sprintf("%s", getByteMagnitude(m.memory.Buffers))},
-			{"Cached", fmt.Sprintf("%s", getByteMagnitude(m.memory.Cached))},
+		if m.recorder != nil {
+			m.recordSnapshot(s)
 		}
 
-		m.memTable.SetRows(memRows)
+		m.retain(s)
+	}
+
+	// Check alert thresholds and log their transitions
+	// replays use the alerts computed when the recording was loaded
+	if m.replay == nil {
+		m.evaluateAlerts(s.Time, metrics)
+	} else {
+		m.firing = m.replay.firing[m.replay.pos]
+	}
+
+	// While looking back in time new samples are kept but not shown
+	if !m.traveling {
+		m.showSnapshot(s)
+	}
+
+	m.updateLogTable()
+}
+
+// Updates the model and its tables to show a snapshot
+func (m *model) showSnapshot(s systeminfo.Snapshot) {
+	m.sampleTime = s.Time
+	m.cpuTotalPercent = s.CPUPercent
+	m.memory = s.Memory
+
+	// Compare previous cpuTimes with current
+	// and observe increment or decrement tendency
+	m.cpuPrevStats = m.cpuStats
+	m.cpuStats = s.CPUTimes
+
+	// Watched processes come first, followed by the top ones
+	m.processes = s.Processes
+	if len(m.processes) > s.Pinned+shownProcesses {
+		m.processes = m.processes[:s.Pinned+shownProcesses]
+	}
+	m.pinned = min(s.Pinned, len(m.processes))
+	m.samples = nil
+	if s.Has(systeminfo.SectionProcesses) {
+		m.samples = processSamples(s)
+	}
+	m.watchMissing = missingWatches(m.watches, s)
+	m.disk = s.Disks
+
+	m.updateTables()
+	m.updateEventsTable()
+}
 
-		// Update Running Processes table information
+// Fills the tables with the sample shown
+func (m *model) updateTables() {
+	// Update CPU table information
+	cpuRows := []table.Row{}
+	for _, c := range []struct {
+		label, mode string
+		now, prev   float64
+	}{
+		{"User", "user", m.cpuStats.User, m.cpuPrevStats.User},
+		{"System", "system", m.cpuStats.System, m.cpuPrevStats.System},
+		{"Idle", "idle", m.cpuStats.Idle, m.cpuPrevStats.Idle},
+		{"Nice", "nice", m.cpuStats.Nice, m.cpuPrevStats.Nice},
+		{"Guest", "guest", m.cpuStats.Guest, m.cpuPrevStats.Guest},
+		{"IRQ", "irq", m.cpuStats.Irq, m.cpuPrevStats.Irq},
+		{"SoftIRQ", "softirq", m.cpuStats.Softirq, m.cpuPrevStats.Softirq},
+	} {
+		row := table.Row{c.label, fmt.Sprintf("%.2f%%", c.now), delta(c.now, c.prev)}
+		// Stats over the share between samples, the one since boot barely moves
+		row = append(row, m.statsCells("cpu.mode_percent", map[string]string{"mode": c.mode}, percentCell)...)
+		cpuRows = append(cpuRows, row)
+	}
+
+	m.cpuTable.SetRows(cpuRows)
+
+	// Update RAM table information
+	memRows := []table.Row{}
+	for _, r := range []struct {
+		label, metric string
+		value         uint64
+	}{
+		{"Total", "memory.total_bytes", m.memory.Total},
+		{"Used", "memory.used_bytes", m.memory.Used},
+		{"Available", "memory.available_bytes", m.memory.Available},
+		{"Free", "memory.free_bytes", m.memory.Free},
+		{"Buffers", "memory.buffers_bytes", m.memory.Buffers},
+		{"Cached", "memory.cached_bytes", m.memory.Cached},
+	} {
+		row := table.Row{r.label, getByteMagnitude(r.value)}
+		row = append(row, m.statsCells(r.metric, nil, bytesCell)...)
+		memRows = append(memRows, row)
+	}
+
+	m.memTable.SetRows(memRows)
+
+	// Update Running Processes table information, or its groups
+	if m.groupMode() != "" {
+		m.updateGroupRows()
+	} else {
 		procRows := []table.Row{}
-		for _, p := range processes {
+		for i, p := range m.processes {
+			name := p.Name
+			if i < m.pinned {
+				name = watchMark + name
+			}
 			row := table.Row{
 				fmt.Sprintf("%d", p.PID),
-				p.Name,
+				name,
 				fmt.Sprint(p.Status),
 				fmt.Sprint(p.Runtime),
 				fmt.Sprintf("%s", getByteMagnitude(p.Memory)),
 				fmt.Sprintf("%.2f%%", p.CPU),
+				m.leakCell(p.PID),
 			}
+			labels := map[string]string{"pid": fmt.Sprint(p.PID), "name": p.Name}
+			row = append(row, m.statsCells("process.cpu_percent", labels, percentCell)...)
+			row = append(row, m.statsCells("process.rss_bytes", labels, bytesCell)...)
 			procRows = append(procRows, row)
 		}
 
 		m.procTable.SetRows(procRows)
+	}
 
-		// Update Disk table information
-		diskRows := []table.Row{}
-		for _, d := range m.disk {
-			row := table.Row{
-				fmt.Sprint(d.Partition.Mountpoint),
-				d.Partition.Fstype,
-				fmt.Sprintf("%s", getByteMagnitude(d.Total)),
-				fmt.Sprintf("%s", getByteMagnitude(d.Used)),
-				fmt.Sprintf("%s", getByteMagnitude(d.Free)),
-			}
-			diskRows = append(diskRows, row)
-		}
-
-		m.diskTable.SetRows(diskRows)
-
-		return m, tick()
-
-	// Handle key pressing events
-	case tea.KeyMsg:
-		switch {
-		case key.Matches(msg, m.keys.Left):
-			m.ActiveTab = max(m.ActiveTab-1, 0) // Decrement activeTab if possible
-			return m, cmd
-		case key.Matches(msg, m.keys.Right):
-			m.ActiveTab = min(m.ActiveTab+1, len(m.tabs)-1) // Increment activeTab if possible
-			return m, cmd
-		case key.Matches(msg, m.keys.Help):
-			m.help.ShowAll = !m.help.ShowAll // Show full help message
-		case key.Matches(msg, m.keys.Quit):
-			return m, tea.Quit // Quit program :(
+	// Update Disk table information
+	diskRows := []table.Row{}
+	for _, d := range m.disk {
+		row := table.Row{
+			fmt.Sprint(d.Partition.Mountpoint),
+			d.Partition.Fstype,
+			fmt.Sprintf("%s", getByteMagnitude(d.Total)),
+			fmt.Sprintf("%s", getByteMagnitude(d.Used)),
+			fmt.Sprintf("%s", getByteMagnitude(d.Free)),
+			m.forecastCell(d),
 		}
-
+		labels := map[string]string{"mountpoint": d.Partition.Mountpoint, "fstype": d.Partition.Fstype}
+		row = append(row, m.statsCells("disk.used_percent", labels, percentCell)...)
+		diskRows = append(diskRows, row)
 	}
 
-	return m, nil
+	m.diskTable.SetRows(diskRows)
 }
 
 func (m model) View() string {
 
 	if m.width == 0 || m.height == 0 {
-		return "Loading...\nPress 'q' to quit."
+		return fmt.Sprintf("Loading...\nPress '%s' to quit.", m.keys.Quit.Keys()[0])
 	}
 
 	if m.err != nil {
-		return fmt.Sprintf("Error: %v\nPress 'q' to quit.", m.err)
+		return fmt.Sprintf("Error: %v\nPress '%s' to quit.", m.err, m.keys.Quit.Keys()[0])
 	}
 
 	// Render category tabs
@@ -255,12 +437,22 @@ func (m model) View() string {
 
 	baseStyle.MaxWidth(m.width)
 
-	return lipgloss.JoinVertical(
-		lipgloss.Left,
-		page.String(),                         // Render category tabs
-		m.renderTab(m.ActiveTab),              // Render active tab content
-		fmt.Sprint(sep),                       // Render bottom separator
+	parts := []string{page.String()} // Render category tabs
+	if m.traveling {
+		parts = append(parts, m.travelBanner()) // Render how far back the shown sample is
+	}
+	parts = append(parts,
+		m.renderTab(m.ActiveTab), // Render active tab content
+		fmt.Sprint(sep),          // Render bottom separator
+	)
+	if m.replay != nil {
+		parts = append(parts, m.renderTimeline()) // Render replay position and controls
+	}
+	parts = append(parts,
+		m.statusBar(),                         // Render unseen errors and firing alerts
 		baseStyle.Render(m.help.View(m.keys)), // Render help message with controls
 	)
 
+	return lipgloss.JoinVertical(lipgloss.Left, parts...)
+
 }
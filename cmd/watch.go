@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"github/iegpeppino/syspulse/systeminfo"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Mark of the watched processes in the PROCESSES table
+const watchMark = "★ "
+
+// Builds the watch list set in the config
+func newWatches(cfg []config.Watch) ([]systeminfo.Watch, error) {
+	return newMatchers("watch", cfg)
+}
+
+// Builds process matchers (watch list entries or group rules) from
+// the config section named
+func newMatchers(section string, cfg []config.Watch) ([]systeminfo.Watch, error) {
+	watches := make([]systeminfo.Watch, 0, len(cfg))
+	names := map[string]bool{}
+	for i, c := range cfg {
+		w := systeminfo.Watch{Name: c.Name, PID: c.PID, Process: c.Process, User: c.User}
+		var criteria []string
+		if c.PID != 0 {
+			criteria = append(criteria, fmt.Sprintf("pid %d", c.PID))
+		}
+		if c.Process != "" {
+			criteria = append(criteria, c.Process)
+		}
+		if c.Cmdline != "" {
+			re, err := regexp.Compile(c.Cmdline)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid cmdline pattern %q: %w", section, c.Cmdline, err)
+			}
+			w.Cmdline = re
+			criteria = append(criteria, "/"+c.Cmdline+"/")
+		}
+		if c.User != "" {
+			criteria = append(criteria, "user "+c.User)
+		}
+		if len(criteria) == 0 {
+			return nil, fmt.Errorf("%s: entry %d needs a pid, process, cmdline or user", section, i+1)
+		}
+		if w.Name == "" {
+			w.Name = strings.Join(criteria, " ")
+		}
+		if names[w.Name] {
+			return nil, fmt.Errorf("%s: duplicated entry %q", section, w.Name)
+		}
+		names[w.Name] = true
+		watches = append(watches, w)
+	}
+	return watches, nil
+}
+
+// Every process of a sample, the watch list and groups are built from them
+// Recordings only keep the listed processes, watched ones included
+func processSamples(s systeminfo.Snapshot) []systeminfo.ProcessSample {
+	if len(s.AllProcesses) > 0 {
+		return s.AllProcesses
+	}
+	procs := make([]systeminfo.ProcessSample, len(s.Processes))
+	for i, p := range s.Processes {
+		procs[i] = p.Sample()
+	}
+	return procs
+}
+
+// Returns the metrics with the state of every watch list entry added
+func watchMetrics(watches []systeminfo.Watch, s systeminfo.Snapshot, metrics []systeminfo.Metric) []systeminfo.Metric {
+	if len(watches) == 0 || !s.Has(systeminfo.SectionProcesses) {
+		return metrics
+	}
+	return append(metrics, systeminfo.WatchMetrics(watches, processSamples(s))...)
+}
+
+// Watch list entries no running process of a sample matches
+func missingWatches(watches []systeminfo.Watch, s systeminfo.Snapshot) []string {
+	if len(watches) == 0 || !s.Has(systeminfo.SectionProcesses) {
+		return nil
+	}
+	var missing []string
+	for _, m := range systeminfo.WatchMetrics(watches, processSamples(s)) {
+		if m.Name == "watch.missing" && m.Value == 1 {
+			missing = append(missing, m.Labels["watch"])
+		}
+	}
+	return missing
+}
+
+// Line listing the watched processes not running, empty when all are
+func (m model) renderMissing() string {
+	if len(m.watchMissing) == 0 {
+		return ""
+	}
+	return lipgloss.NewStyle().Foreground(currentTheme.critical).MarginLeft(5).
+		Render(fmt.Sprintf("⚠ Watched but not running: %s", strings.Join(m.watchMissing, ", ")))
+}
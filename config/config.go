@@ -1,4 +1,313 @@
 package config
 
-// Load thresholds and other configuration
-// will be implemented here in the future
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// User settings read from the JSON config file
+// Every field is optional, missing ones keep their defaults
+type Config struct {
+	Theme  string           `json:"theme"`
+	Themes map[string]Theme `json:"themes"`
+
+	// Keys maps an action name (e.g. "quit") to the keys triggering it
+	Keys map[string][]string `json:"keys"`
+
+	Log Log `json:"log"`
+
+	// Alert rules, the built-in ones are used when unset
+	Alerts []Alert `json:"alerts"`
+
+	Serve Serve `json:"serve"`
+
+	Exporters Exporters `json:"exporters"`
+
+	Record Record `json:"record"`
+
+	History History `json:"history"`
+
+	// On-disk metric store, disabled when unset
+	TSDB *TSDB `json:"tsdb"`
+
+	Forecast Forecast `json:"forecast"`
+
+	Leaks Leaks `json:"leaks"`
+
+	Anomalies Anomalies `json:"anomalies"`
+
+	// Processes pinned to the top of the PROCESSES tab
+	Watch []Watch `json:"watch"`
+
+	// Process group rules, matched in order like watch entries
+	// The first one a process matches names its group
+	Groups []Watch `json:"groups"`
+}
+
+// Watch list entry, a process matches when it meets every criterion set
+type Watch struct {
+	Name    string `json:"name"`    // Shown and used as the "watch" label, defaults to the criteria
+	PID     int32  `json:"pid"`     // Exact PID
+	Process string `json:"process"` // Exact executable name, e.g. "nginx"
+	Cmdline string `json:"cmdline"` // Regular expression matched against the command line
+	User    string `json:"user"`    // Owner of the process
+}
+
+// Anomaly detection settings
+type Anomalies struct {
+	Sigma    float64  `json:"sigma"`     // Deviation from the baseline flagged as anomalous, in standard deviations
+	HalfLife string   `json:"half_life"` // How fast baselines forget old readings, e.g. "15m"
+	Seasonal bool     `json:"seasonal"`  // Learn a baseline per hour of day
+	Metrics  []string `json:"metrics"`   // Watched metric names, * matches anything. An empty list disables detection
+}
+
+// Memory leak detection settings
+type Leaks struct {
+	Window string `json:"window"` // RSS history a process is judged on, e.g. "30m"
+}
+
+// Disk full forecasting settings
+type Forecast struct {
+	Window  string `json:"window"`  // Usage history the growth trend is fitted on, e.g. "6h"
+	Horizon string `json:"horizon"` // Filesystems expected to fill within it are highlighted, e.g. "24h"
+}
+
+// Long term metric history kept on disk by "syspulse serve" and the TUI
+type TSDB struct {
+	Path      string            `json:"path"`      // Defaults to $XDG_STATE_HOME/syspulse/tsdb
+	Interval  string            `json:"interval"`  // Minimum time between stored samples, "10s" by default
+	Retention map[string]string `json:"retention"` // How long each tier ("raw", "1m", "10m", "1h") is kept, e.g. {"raw": "2d"}
+}
+
+// Live TUI history settings
+type History struct {
+	Window string `json:"window"` // How far back time travel can go, e.g. "15m"
+}
+
+// Session recording settings, used by "syspulse record"
+// and by the TUI record toggle
+type Record struct {
+	Dir         string `json:"dir"`          // Where TUI recordings go, defaults to $XDG_STATE_HOME/syspulse/recordings
+	MaxSizeMB   int    `json:"max_size_mb"`  // Roll over to a new file past this size, 0 for no limit
+	MaxDuration string `json:"max_duration"` // Roll over to a new file after this long, e.g. "6h"
+	Keep        int    `json:"keep"`         // Files kept per session, older ones are deleted (0 keeps all)
+}
+
+// Push based metric destinations, each one is disabled when unset
+type Exporters struct {
+	Influx   *Influx   `json:"influx"`
+	Graphite *Graphite `json:"graphite"`
+	OTLP     *OTLP     `json:"otlp"`
+	StatsD   *StatsD   `json:"statsd"`
+}
+
+// StatsD/DogStatsD UDP emitter
+type StatsD struct {
+	Address    string            `json:"address"`     // Defaults to 127.0.0.1:8125
+	Flavor     string            `json:"flavor"`      // statsd or dogstatsd
+	Prefix     string            `json:"prefix"`      // Defaults to "syspulse"
+	Tags       map[string]string `json:"tags"`        // Added to every metric (dogstatsd only), "host" is set by default
+	SampleRate float64           `json:"sample_rate"` // Share of metrics sent, 1 by default
+	PacketSize int               `json:"packet_size"` // Max datagram size in bytes, 1432 by default
+}
+
+// OpenTelemetry OTLP/HTTP metrics export
+type OTLP struct {
+	Endpoint string            `json:"endpoint"` // Defaults to http://localhost:4318/v1/metrics
+	Encoding string            `json:"encoding"` // protobuf or json
+	Headers  map[string]string `json:"headers"`  // Extra request headers, e.g. for authentication
+	Resource map[string]string `json:"resource"` // Resource attributes added to the host ones
+	Timeout  string            `json:"timeout"`  // Per request timeout
+}
+
+// InfluxDB line protocol output
+type Influx struct {
+	Output string            `json:"output"` // "-" for stdout, a file path or an http(s) write URL
+	Token  string            `json:"token"`  // API token for HTTP outputs
+	Prefix string            `json:"prefix"` // Prepended to measurement names
+	Tags   map[string]string `json:"tags"`   // Added to every line, "host" is set by default
+	Batch
+}
+
+// Graphite plaintext output
+type Graphite struct {
+	Address  string            `json:"address"`  // host:port of the carbon receiver
+	Protocol string            `json:"protocol"` // tcp or udp
+	Prefix   string            `json:"prefix"`   // Defaults to "syspulse.<host>"
+	Tagged   bool              `json:"tagged"`   // Send labels as Graphite tags instead of path segments
+	Tags     map[string]string `json:"tags"`     // Extra tags, only used when tagged
+	Batch
+}
+
+// Batching and buffering of a push exporter
+type Batch struct {
+	BatchSize     int    `json:"batch_size"`     // Lines per write
+	FlushInterval string `json:"flush_interval"` // Max time lines wait before being written
+	BufferPath    string `json:"buffer_path"`    // Undelivered lines, defaults under the state directory
+	BufferMaxMB   int    `json:"buffer_max_mb"`  // Oldest lines are dropped past this size, -1 disables the buffer
+}
+
+// Metrics endpoint settings, used by "syspulse serve"
+// and by the TUI when Listen is set
+type Serve struct {
+	Listen     string `json:"listen"`      // Address of the /metrics endpoint, e.g. ":9101"
+	Interval   string `json:"interval"`    // Collection interval when running headless
+	ProcessTop int    `json:"process_top"` // Processes exported with per-process series, -1 for all
+}
+
+// Threshold alert over a metric (e.g. "disk.used_percent")
+// optionally restricted to the series matching Labels
+type Alert struct {
+	Name   string            `json:"name"`
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels"`
+	Above  *float64          `json:"above"`
+	Below  *float64          `json:"below"`
+	For    string            `json:"for"` // How long the threshold must be exceeded, e.g. "30s"
+}
+
+// Log destination, rotation and format settings
+type Log struct {
+	Path       string `json:"path"`         // Defaults to $XDG_STATE_HOME/syspulse/syspulse.log
+	Level      string `json:"level"`        // debug, info, warn or error
+	Format     string `json:"format"`       // json or text
+	MaxSizeMB  int    `json:"max_size_mb"`  // Rotate once the file reaches this size
+	MaxAgeDays int    `json:"max_age_days"` // Rotate once the file is this old
+	MaxBackups int    `json:"max_backups"`  // Rotated files kept, older ones are deleted
+}
+
+// Rejects a level or format the logger wouldn't understand
+func (l Log) check() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q, want debug, info, warn or error", l.Level)
+	}
+	switch strings.ToLower(l.Format) {
+	case "", "json", "text":
+		return nil
+	}
+	return fmt.Errorf("invalid log format %q, want json or text", l.Format)
+}
+
+// Colors and gauge thresholds of a user defined theme
+// Colors accept "#RRGGBB" hex values or ANSI 0-255 codes
+// and any empty field is inherited from the Base theme
+type Theme struct {
+	Base       string  `json:"base"`
+	Accent     string  `json:"accent"`
+	Text       string  `json:"text"`
+	Muted      string  `json:"muted"`
+	Good       string  `json:"good"`
+	Warn       string  `json:"warn"`
+	High       string  `json:"high"`
+	Critical   string  `json:"critical"`
+	Selected   string  `json:"selected"`
+	WarnAt     float64 `json:"warn_at"`
+	HighAt     float64 `json:"high_at"`
+	CriticalAt float64 `json:"critical_at"`
+}
+
+// Returns the configuration used when there's no config file
+func Default() *Config {
+	return &Config{
+		Theme: "amber",
+		Log: Log{
+			Level:      "error",
+			Format:     "json",
+			MaxSizeMB:  10,
+			MaxAgeDays: 7,
+			MaxBackups: 3,
+		},
+		Serve: Serve{
+			Interval:   "5s",
+			ProcessTop: 10,
+		},
+		Record: Record{
+			MaxSizeMB: 100,
+		},
+		History: History{
+			Window: "15m",
+		},
+		Forecast: Forecast{
+			Window:  "6h",
+			Horizon: "24h",
+		},
+		Leaks: Leaks{
+			Window: "30m",
+		},
+		Anomalies: Anomalies{
+			Sigma:    3,
+			HalfLife: "15m",
+		},
+	}
+}
+
+// Returns the default config file location
+// ($XDG_CONFIG_HOME/syspulse/config.json on Linux)
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "syspulse", "config.json")
+}
+
+// Returns the directory for logs and other state
+// ($XDG_STATE_HOME/syspulse, ~/.local/state/syspulse by default)
+func StateDir() (string, error) {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to resolve state directory: %w", err)
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "syspulse"), nil
+}
+
+// Reads the config file at path, or at DefaultPath() if path is empty
+// A missing default file is not an error, defaults are returned instead
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !explicit {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("unable to read config: %w", err)
+	}
+
+	if err := decode(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := cfg.Log.check(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Decodes data on top of cfg rejecting unknown fields
+// so typos in the config file don't go unnoticed
+func decode(data []byte, cfg *Config) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(cfg)
+}
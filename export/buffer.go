@@ -0,0 +1,428 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Batches line based payloads (Influx, Graphite) before sending them
+// Lines that can't be delivered are kept in a bounded on-disk buffer
+// and sent again, oldest first, once the destination is back
+type linePusher struct {
+	mu            sync.Mutex
+	send          func([]byte) error
+	batchSize     int           // Lines per send
+	flushInterval time.Duration // Max time lines wait before being sent
+	maxBatchBytes int           // Max payload size per send, 0 for no limit
+
+	pending   [][]byte
+	lastFlush time.Time
+	spool     *spool // nil when buffering is disabled
+}
+
+func newLinePusher(send func([]byte) error, batchSize int, flushInterval time.Duration, spool *spool) *linePusher {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &linePusher{
+		send:          send,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		spool:         spool,
+		lastFlush:     time.Now(),
+	}
+}
+
+// Queues lines and sends them once a batch is full or flushInterval passed
+func (p *linePusher) push(lines [][]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending = append(p.pending, lines...)
+	if len(p.pending) < p.batchSize && time.Since(p.lastFlush) < p.flushInterval {
+		return nil
+	}
+	return p.flushLocked()
+}
+
+// Sends lines that waited flushInterval, called on a timer so they
+// don't sit around until the next push when samples stop coming
+// Buffered lines are retried along with them, not on their own
+func (p *linePusher) flushDue() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.pending) == 0 || time.Since(p.lastFlush) < p.flushInterval {
+		return nil
+	}
+	return p.flushLocked()
+}
+
+// Sends every pending line
+func (p *linePusher) flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.flushLocked()
+}
+
+func (p *linePusher) flushLocked() error {
+	p.lastFlush = time.Now()
+	lines := p.pending
+	p.pending = nil
+
+	// Older buffered lines go first so order is preserved
+	// Rejected ones are gone already, only a failed send stops here
+	var rejected error
+	if p.spool != nil && p.spool.pending() > 0 {
+		if err := p.spool.drain(p.sendBatches, p.batchSize); err != nil {
+			if isPartial(err) {
+				return p.keep(lines, err)
+			}
+			rejected = err
+		}
+	}
+
+	if err := p.sendBatches(lines); err != nil {
+		var pe *partialError
+		if errors.As(err, &pe) {
+			return errors.Join(rejected, p.keep(lines[pe.sent:], err))
+		}
+		return errors.Join(rejected, err)
+	}
+	return rejected
+}
+
+// Buffers lines that couldn't be sent and returns the send error
+func (p *linePusher) keep(lines [][]byte, sendErr error) error {
+	if p.spool == nil {
+		return fmt.Errorf("dropped %d lines: %w", len(lines), sendErr)
+	}
+	if err := p.spool.append(lines); err != nil {
+		return fmt.Errorf("%w (buffering failed: %v)", sendErr, err)
+	}
+	return sendErr
+}
+
+// Sends lines in batches of at most batchSize lines (and maxBatchBytes)
+// A batch the destination rejects is dropped and sending goes on, any
+// other failure stops it with a *partialError holding what was done
+func (p *linePusher) sendBatches(lines [][]byte) error {
+	var buf bytes.Buffer
+	var rejected []error
+	sent, n := 0, 0
+	flush := func() error {
+		if n == 0 {
+			return nil
+		}
+		if err := p.send(buf.Bytes()); err != nil {
+			var perm *permanentError
+			if !errors.As(err, &perm) {
+				return &partialError{sent: sent, err: err}
+			}
+			rejected = append(rejected, fmt.Errorf("dropped %d rejected lines: %w", n, err))
+		}
+		sent += n
+		buf.Reset()
+		n = 0
+		return nil
+	}
+
+	for _, line := range lines {
+		if n > 0 && (n >= p.batchSize || (p.maxBatchBytes > 0 && buf.Len()+len(line)+1 > p.maxBatchBytes)) {
+			if err := flush(); err != nil {
+				return errors.Join(append(rejected, err)...)
+			}
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		n++
+	}
+	if err := flush(); err != nil {
+		return errors.Join(append(rejected, err)...)
+	}
+	return errors.Join(rejected...)
+}
+
+// Send failure retrying won't fix, like a payload the server refuses
+// The batch is dropped instead of being buffered again
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Send failure after the first "sent" lines were delivered
+type partialError struct {
+	sent int
+	err  error
+}
+
+func (e *partialError) Error() string { return e.err.Error() }
+func (e *partialError) Unwrap() error { return e.err }
+
+// Whether sending stopped on a failure worth retrying
+func isPartial(err error) bool {
+	var pe *partialError
+	return errors.As(err, &pe)
+}
+
+// Append only file of undelivered lines, capped at maxBytes
+// Lines are read from an offset kept next to it (<path>.pos) so sending
+// them never rewrites the file, the delivered head is only cut off once
+// it's most of the file. When full, the oldest lines are skipped
+type spool struct {
+	path     string
+	maxBytes int64
+	offset   int64 // Start of the first undelivered line
+	end      int64 // File size
+}
+
+func newSpool(path string, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create buffer directory: %w", err)
+	}
+	s := &spool{path: path, maxBytes: maxBytes}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("unable to read buffer: %w", err)
+	}
+	return s, nil
+}
+
+// Picks up a buffer left by a previous run, cutting off a line
+// half written when it stopped
+func (s *spool) load() error {
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		os.Remove(s.posPath())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	end, err := lastLineEnd(f, info.Size())
+	if err != nil {
+		return err
+	}
+	if end < info.Size() {
+		if err := f.Truncate(end); err != nil {
+			return err
+		}
+	}
+	s.end = end
+
+	// A missing or bad offset sends everything again, duplicates beat losses
+	if data, err := os.ReadFile(s.posPath()); err == nil {
+		if off, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil && off >= 0 && off <= end {
+			s.offset = off
+		}
+	}
+	return nil
+}
+
+// End of the last complete line of the first size bytes of f
+func lastLineEnd(f *os.File, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for pos := size; pos > 0; {
+		n := int64(len(buf))
+		if n > pos {
+			n = pos
+		}
+		pos -= n
+		if _, err := f.ReadAt(buf[:n], pos); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *spool) posPath() string { return s.path + ".pos" }
+
+// Bytes still waiting to be sent
+func (s *spool) pending() int64 { return s.end - s.offset }
+
+func (s *spool) append(lines [][]byte) error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, l := range lines {
+		w.Write(l)
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if info, serr := f.Stat(); serr == nil {
+		s.end = info.Size()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.maxBytes > 0 && s.pending() > s.maxBytes {
+		return s.trim()
+	}
+	return nil
+}
+
+// Skips the oldest lines until the buffer fits in maxBytes
+func (s *spool) trim() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(f, s.offset, s.end-s.offset))
+	var skip int64
+	for s.pending()-skip > s.maxBytes {
+		l, err := r.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			break
+		}
+		skip += int64(len(l))
+	}
+	return s.advance(skip)
+}
+
+// Sends the buffered lines chunk lines at a time, oldest first
+// Stops at the first failed send, rejected chunks are dropped
+func (s *spool) drain(send func([][]byte) error, chunk int) error {
+	var rejected []error
+	for s.pending() > 0 {
+		lines, size, err := s.read(chunk)
+		if err != nil {
+			return errors.Join(append(rejected, err)...)
+		}
+		if size == 0 {
+			break // A half written line, nothing complete to send
+		}
+		if len(lines) == 0 {
+			err = s.advance(size)
+		} else if err = send(lines); err != nil {
+			var pe *partialError
+			if errors.As(err, &pe) {
+				var sent int64
+				for _, l := range lines[:pe.sent] {
+					sent += int64(len(l)) + 1
+				}
+				if aerr := s.advance(sent); aerr != nil {
+					err = fmt.Errorf("%w (buffer update failed: %v)", err, aerr)
+				}
+				return errors.Join(append(rejected, err)...)
+			}
+			rejected = append(rejected, err)
+			err = s.advance(size)
+		} else {
+			err = s.advance(size)
+		}
+		if err != nil {
+			return errors.Join(append(rejected, err)...)
+		}
+	}
+	return errors.Join(rejected...)
+}
+
+// Reads up to n lines from the offset, along with the bytes they take
+func (s *spool) read(n int) ([][]byte, int64, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(f, s.offset, s.end-s.offset))
+	var lines [][]byte
+	var size int64
+	for len(lines) < n {
+		l, err := r.ReadBytes('\n')
+		if err != nil {
+			break // Only complete lines are read
+		}
+		size += int64(len(l))
+		if len(l) > 1 {
+			lines = append(lines, l[:len(l)-1])
+		}
+	}
+	return lines, size, nil
+}
+
+// Moves the offset past n delivered bytes
+// The file goes away once everything is sent, and is compacted
+// once the delivered head takes more than half of it
+func (s *spool) advance(n int64) error {
+	if n == 0 {
+		return nil
+	}
+	s.offset += n
+	if s.offset >= s.end {
+		s.offset, s.end = 0, 0
+		err := os.Remove(s.path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		if perr := os.Remove(s.posPath()); perr != nil && !os.IsNotExist(perr) && err == nil {
+			err = perr
+		}
+		return err
+	}
+	if s.offset > s.end/2 {
+		return s.compact()
+	}
+	return os.WriteFile(s.posPath(), []byte(strconv.FormatInt(s.offset, 10)), 0644)
+}
+
+// Copies the undelivered lines to a new file, through a temporary
+// file so a crash never leaves a half written buffer behind
+func (s *spool) compact() error {
+	src, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := s.path + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, io.NewSectionReader(src, s.offset, s.end-s.offset))
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// The offset is reset first: a crash in between resends the
+	// compacted lines rather than skipping some
+	if err := os.Remove(s.posPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.end -= s.offset
+	s.offset = 0
+	return nil
+}
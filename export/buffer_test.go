@@ -0,0 +1,188 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Destination recording the lines it receives, failing while down
+// and rejecting payloads holding a "bad" line
+type fakeDest struct {
+	down  bool
+	sends int
+	got   []string
+}
+
+func (d *fakeDest) send(b []byte) error {
+	d.sends++
+	if d.down {
+		return errors.New("connection refused")
+	}
+	if strings.Contains(string(b), "bad") {
+		return &permanentError{err: errors.New("400 Bad Request")}
+	}
+	d.got = append(d.got, strings.Fields(string(b))...)
+	return nil
+}
+
+func lines(names ...string) [][]byte {
+	var out [][]byte
+	for _, n := range names {
+		out = append(out, []byte(n))
+	}
+	return out
+}
+
+func testSpool(t *testing.T, maxBytes int64) *spool {
+	t.Helper()
+	sp, err := newSpool(filepath.Join(t.TempDir(), "buffer", "influx.lp"), maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp
+}
+
+func TestPusherBuffersUntilDestinationIsBack(t *testing.T) {
+	d := &fakeDest{down: true}
+	p := newLinePusher(d.send, 2, time.Hour, testSpool(t, 0))
+
+	if err := p.push(lines("a", "b")); err == nil {
+		t.Fatal("push() while down returned no error")
+	}
+	if err := p.push(lines("c", "d")); err == nil {
+		t.Fatal("push() while down returned no error")
+	}
+	if sends := d.sends; sends != 2 {
+		t.Errorf("%d sends while down, want one per push", sends)
+	}
+
+	d.down = false
+	if err := p.push(lines("e", "f")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c", "d", "e", "f"}; !reflect.DeepEqual(d.got, want) {
+		t.Errorf("sent %v, want %v", d.got, want)
+	}
+	if _, err := os.Stat(p.spool.path); !os.IsNotExist(err) {
+		t.Errorf("buffer still exists (%v) once drained", err)
+	}
+}
+
+func TestPusherDropsRejectedBatches(t *testing.T) {
+	d := &fakeDest{}
+	p := newLinePusher(d.send, 2, time.Hour, testSpool(t, 0))
+
+	err := p.push(lines("a", "bad", "c", "d"))
+	var perm *permanentError
+	if !errors.As(err, &perm) {
+		t.Fatalf("push() error = %v, want the rejection", err)
+	}
+	if want := []string{"c", "d"}; !reflect.DeepEqual(d.got, want) {
+		t.Errorf("sent %v, want %v", d.got, want)
+	}
+	if n := p.spool.pending(); n != 0 {
+		t.Errorf("%d bytes buffered, want the rejected batch dropped", n)
+	}
+}
+
+func TestPusherFlushDue(t *testing.T) {
+	d := &fakeDest{}
+	p := newLinePusher(d.send, 100, 10*time.Millisecond, nil)
+
+	if err := p.push(lines("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.flushDue(); err != nil || len(d.got) != 0 {
+		t.Fatalf("flushDue() before the interval sent %v (%v), want nothing", d.got, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := p.flushDue(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(d.got, want) {
+		t.Errorf("sent %v, want %v", d.got, want)
+	}
+}
+
+func TestSpoolOffsetSurvivesRestart(t *testing.T) {
+	sp := testSpool(t, 0)
+	var names []string
+	for i := 0; i < 10; i++ {
+		names = append(names, fmt.Sprintf("line%d", i))
+	}
+	if err := sp.append(lines(names...)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delivering the first 3 lines only moves the offset
+	d := &fakeDest{}
+	calls := 0
+	err := sp.drain(func(l [][]byte) error {
+		if calls++; calls > 1 {
+			return &partialError{err: errors.New("connection refused")}
+		}
+		for _, b := range l {
+			d.got = append(d.got, string(b))
+		}
+		return nil
+	}, 3)
+	if !isPartial(err) {
+		t.Fatalf("drain() error = %v, want the failed send", err)
+	}
+	data, err := os.ReadFile(sp.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "line0\n") {
+		t.Errorf("buffer was rewritten, starts with %q", data[:6])
+	}
+
+	// A half written line left by a crash is cut off
+	f, err := os.OpenFile(sp.path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("partial")
+	f.Close()
+
+	sp, err = newSpool(sp.path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := sp.read(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := lines(names[3:]...); !reflect.DeepEqual(got, want) {
+		t.Errorf("after reopening read %q, want %q", got, want)
+	}
+}
+
+func TestSpoolTrimKeepsNewest(t *testing.T) {
+	sp := testSpool(t, 12) // Room for two "lineN\n" lines
+	for i := 0; i < 5; i++ {
+		if err := sp.append(lines(fmt.Sprintf("line%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _, err := sp.read(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := lines("line3", "line4"); !reflect.DeepEqual(got, want) {
+		t.Errorf("buffer holds %q, want %q", got, want)
+	}
+	info, err := os.Stat(sp.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 2*12 {
+		t.Errorf("buffer file is %d bytes, want the skipped head compacted away", info.Size())
+	}
+}
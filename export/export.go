@@ -0,0 +1,118 @@
+package export
+
+import (
+	"github/iegpeppino/syspulse/systeminfo"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Latest collected metrics, shared between the
+// collection loop (or the TUI) and the exporters
+type Store struct {
+	mu      sync.RWMutex
+	metrics []systeminfo.Metric
+	pinned  int // Watched processes listed first among the process metrics
+	time    time.Time
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Replaces the stored metrics
+func (s *Store) Set(t time.Time, metrics []systeminfo.Metric, pinned int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = metrics
+	s.pinned = pinned
+	s.time = t
+}
+
+// Returns the stored metrics, when they were collected
+// and how many watched processes they start with
+func (s *Store) Get() (time.Time, []systeminfo.Metric, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.time, s.metrics, s.pinned
+}
+
+// Metrics sharing the same name, in order of first appearance
+type family struct {
+	name    string
+	info    systeminfo.MetricInfo
+	metrics []systeminfo.Metric
+}
+
+// Groups metrics by name so each family is described once
+func groupFamilies(metrics []systeminfo.Metric) []family {
+	var families []family
+	index := map[string]int{}
+	for _, m := range metrics {
+		i, ok := index[m.Name]
+		if !ok {
+			i = len(families)
+			index[m.Name] = i
+			families = append(families, family{name: m.Name, info: systeminfo.DescribeMetric(m.Name)})
+		}
+		families[i].metrics = append(families[i].metrics, m)
+	}
+	return families
+}
+
+// Returns the label names of a metric, sorted
+func labelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Converts a dotted metric name into an underscore separated one
+// replacing every character outside [a-zA-Z0-9_:]
+func sanitizeName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// Limits per-process metrics so exported series stay bounded: the
+// first pinned processes (the watched ones, listed first) are always
+// kept, along with the max top ones by CPU after them; max < 0 keeps all
+func LimitProcesses(metrics []systeminfo.Metric, max, pinned int) []systeminfo.Metric {
+	if max < 0 {
+		return metrics
+	}
+
+	// Snapshot processes are sorted by CPU after the pinned ones,
+	// keep the first pids seen
+	kept := map[string]bool{}
+	out := make([]systeminfo.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		pid, isProcess := m.Labels["pid"]
+		if !isProcess || !strings.HasPrefix(m.Name, "process.") {
+			out = append(out, m)
+			continue
+		}
+		if !kept[pid] {
+			if len(kept) >= pinned+max {
+				continue
+			}
+			kept[pid] = true
+		}
+		out = append(out, m)
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package export
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Max payload of a Graphite UDP datagram, safe for the usual 1500 bytes MTU
+const graphiteUDPPayload = 1400
+
+// Writes samples in the Graphite plaintext protocol over TCP or UDP
+type Graphite struct {
+	prefix string
+	tags   map[string]string
+	tagged bool
+	pusher *linePusher
+	conn   *netConn
+}
+
+// Graphite exporter settings
+type GraphiteOptions struct {
+	Address       string            // host:port of the carbon receiver
+	Protocol      string            // "tcp" (default) or "udp"
+	Prefix        string            // Path prefix, e.g. "syspulse.myhost"
+	Tags          map[string]string // Extra tags, only used when Tagged
+	Tagged        bool              // Use Graphite 1.1 tags (name;k=v) instead of path segments for labels
+	BatchSize     int
+	FlushInterval time.Duration
+	BufferPath    string
+	BufferMaxSize int64
+}
+
+func NewGraphite(opts GraphiteOptions) (*Graphite, error) {
+	protocol := opts.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	if protocol != "tcp" && protocol != "udp" {
+		return nil, fmt.Errorf("graphite: unknown protocol %q (expected tcp or udp)", opts.Protocol)
+	}
+	if opts.Address == "" {
+		return nil, fmt.Errorf("graphite: an address is required")
+	}
+
+	e := &Graphite{
+		prefix: strings.TrimSuffix(opts.Prefix, "."),
+		tags:   opts.Tags,
+		tagged: opts.Tagged,
+		conn:   &netConn{network: protocol, address: opts.Address},
+	}
+
+	var sp *spool
+	if opts.BufferPath != "" {
+		var err error
+		if sp, err = newSpool(opts.BufferPath, opts.BufferMaxSize); err != nil {
+			return nil, fmt.Errorf("graphite: %w", err)
+		}
+	}
+
+	e.pusher = newLinePusher(e.conn.write, opts.BatchSize, opts.FlushInterval, sp)
+	if protocol == "udp" {
+		e.pusher.maxBatchBytes = graphiteUDPPayload
+	}
+	return e, nil
+}
+
+func (e *Graphite) Name() string { return "graphite" }
+
+func (e *Graphite) Export(t time.Time, metrics []systeminfo.Metric) error {
+	return e.pusher.push(GraphiteLines(t, metrics, e.prefix, e.tags, e.tagged))
+}
+
+func (e *Graphite) FlushDue() error { return e.pusher.flushDue() }
+
+func (e *Graphite) Close() error {
+	err := e.pusher.flush()
+	e.conn.close()
+	return err
+}
+
+// Converts metrics into "path value timestamp" lines
+// Labels become path segments (name.k.v) or, when tagged, name;k=v tags
+func GraphiteLines(t time.Time, metrics []systeminfo.Metric, prefix string, tags map[string]string, tagged bool) [][]byte {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	lines := make([][]byte, 0, len(metrics))
+
+	for _, m := range metrics {
+		var path strings.Builder
+		if prefix != "" {
+			path.WriteString(prefix)
+			path.WriteByte('.')
+		}
+		path.WriteString(graphiteSegment(m.Name, true))
+
+		if tagged {
+			all := make(map[string]string, len(tags)+len(m.Labels))
+			for k, v := range tags {
+				all[k] = v
+			}
+			for k, v := range m.Labels {
+				all[k] = v
+			}
+			keys := make([]string, 0, len(all))
+			for k := range all {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if v := graphiteTagValue(all[k]); v != "" {
+					fmt.Fprintf(&path, ";%s=%s", graphiteSegment(k, false), v)
+				}
+			}
+		} else {
+			for _, k := range labelKeys(m.Labels) {
+				fmt.Fprintf(&path, ".%s.%s", graphiteSegment(k, false), graphiteSegment(m.Labels[k], false))
+			}
+		}
+
+		lines = append(lines, []byte(path.String()+" "+strconv.FormatFloat(m.Value, 'f', -1, 64)+" "+ts))
+	}
+	return lines
+}
+
+// Makes s safe as a path segment, keeping dots only when asked
+func graphiteSegment(s string, keepDots bool) string {
+	if s == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		case r == '.' && keepDots:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// Tag values can't hold ';', '~' or whitespace
+func graphiteTagValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ';' || r == '~' || r == ' ' || r == '\t' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Lazily (re)connected TCP or UDP connection
+type netConn struct {
+	mu      sync.Mutex
+	network string
+	address string
+	conn    net.Conn
+}
+
+// Writes a payload, reconnecting first when needed
+// A failed write drops the connection so the next one reconnects
+func (c *netConn) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, err := net.DialTimeout(c.network, c.address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(b); err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (c *netConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
@@ -0,0 +1,212 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writes samples as InfluxDB line protocol to stdout,
+// a file or an HTTP write endpoint
+type Influx struct {
+	prefix string
+	tags   map[string]string
+	pusher *linePusher
+	closer io.Closer
+}
+
+// Influx exporter settings
+type InfluxOptions struct {
+	Output        string            // "-" for stdout, an http(s) write URL or a file path
+	Token         string            // Sent as "Authorization: Token <token>" to HTTP outputs
+	Prefix        string            // Prepended to every measurement name
+	Tags          map[string]string // Added to every line
+	BatchSize     int
+	FlushInterval time.Duration
+	BufferPath    string // On-disk buffer of undelivered lines, empty to disable
+	BufferMaxSize int64
+}
+
+func NewInflux(opts InfluxOptions) (*Influx, error) {
+	e := &Influx{prefix: opts.Prefix, tags: opts.Tags}
+
+	var send func([]byte) error
+	switch {
+	case opts.Output == "" || opts.Output == "-":
+		send = func(b []byte) error {
+			_, err := os.Stdout.Write(b)
+			return err
+		}
+	case strings.HasPrefix(opts.Output, "http://"), strings.HasPrefix(opts.Output, "https://"):
+		send = influxHTTPSender(opts.Output, opts.Token)
+	default:
+		f, err := os.OpenFile(opts.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("influx: unable to open output: %w", err)
+		}
+		e.closer = f
+		send = func(b []byte) error {
+			_, err := f.Write(b)
+			return err
+		}
+	}
+
+	var sp *spool
+	if opts.BufferPath != "" {
+		var err error
+		if sp, err = newSpool(opts.BufferPath, opts.BufferMaxSize); err != nil {
+			return nil, fmt.Errorf("influx: %w", err)
+		}
+	}
+
+	e.pusher = newLinePusher(send, opts.BatchSize, opts.FlushInterval, sp)
+	return e, nil
+}
+
+// Posts line protocol payloads to an InfluxDB write URL
+// (e.g. http://host:8086/api/v2/write?org=o&bucket=b&precision=ns)
+func influxHTTPSender(url, token string) func([]byte) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(b []byte) error {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			err := fmt.Errorf("influx write failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+			// Client errors won't go away by sending the same lines again,
+			// except for timeouts and rate limiting
+			if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+				return &permanentError{err: err}
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+func (e *Influx) Name() string { return "influx" }
+
+func (e *Influx) Export(t time.Time, metrics []systeminfo.Metric) error {
+	return e.pusher.push(InfluxLines(t, metrics, e.prefix, e.tags))
+}
+
+func (e *Influx) FlushDue() error { return e.pusher.flushDue() }
+
+func (e *Influx) Close() error {
+	err := e.pusher.flush()
+	if e.closer != nil {
+		if cerr := e.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Converts metrics into line protocol
+// The first segment of the metric name is the measurement and the rest
+// the field, so "disk.used_bytes{mountpoint=/}" becomes
+// "disk,mountpoint=/ used_bytes=..." with series sharing tags on one line
+func InfluxLines(t time.Time, metrics []systeminfo.Metric, prefix string, tags map[string]string) [][]byte {
+	type point struct {
+		measurement string
+		tags        map[string]string
+		fields      []string
+	}
+	var points []*point
+	index := map[string]*point{}
+
+	for _, m := range metrics {
+		measurement, field, ok := strings.Cut(m.Name, ".")
+		if !ok {
+			measurement, field = m.Name, "value"
+		}
+		measurement = prefix + measurement
+
+		allTags := make(map[string]string, len(tags)+len(m.Labels))
+		for k, v := range tags {
+			allTags[k] = v
+		}
+		for k, v := range m.Labels {
+			allTags[k] = v
+		}
+
+		key := measurement + "," + tagSet(allTags)
+		p, ok := index[key]
+		if !ok {
+			p = &point{measurement: measurement, tags: allTags}
+			index[key] = p
+			points = append(points, p)
+		}
+
+		// Counters are floats too, InfluxDB 1.x rejects unsigned fields by default
+		value := strconv.FormatFloat(m.Value, 'f', -1, 64)
+		p.fields = append(p.fields, influxEscape(field, ",= ")+"="+value)
+	}
+
+	ts := strconv.FormatInt(t.UnixNano(), 10)
+	lines := make([][]byte, 0, len(points))
+	for _, p := range points {
+		var b strings.Builder
+		b.WriteString(influxEscape(p.measurement, ", "))
+		if ts := tagSet(p.tags); ts != "" {
+			b.WriteByte(',')
+			b.WriteString(ts)
+		}
+		b.WriteByte(' ')
+		b.WriteString(strings.Join(p.fields, ","))
+		b.WriteByte(' ')
+		b.WriteString(ts)
+		lines = append(lines, []byte(b.String()))
+	}
+	return lines
+}
+
+// Formats tags as sorted k=v pairs, skipping empty values
+func tagSet(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = influxEscape(k, ",= ") + "=" + influxEscape(tags[k], ",= ")
+	}
+	return strings.Join(parts, ",")
+}
+
+// Backslash escapes the given characters (and backslashes)
+func influxEscape(s, chars string) string {
+	if !strings.ContainsAny(s, chars+`\`) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,389 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Requests kept for retry while the collector is unreachable
+// older ones are dropped first
+const otlpMaxQueue = 120
+
+// Retry backoff bounds
+const (
+	otlpMinBackoff = time.Second
+	otlpMaxBackoff = time.Minute
+)
+
+// Exports samples over OTLP/HTTP, protobuf or JSON encoded,
+// using the OpenTelemetry semantic convention names
+type OTLP struct {
+	mu       sync.Mutex
+	endpoint string
+	encoding string
+	headers  map[string]string
+	resource []otlpKeyValue
+	start    time.Time
+	client   *http.Client
+
+	queue       [][]byte // Encoded requests waiting to be sent, oldest first
+	backoff     time.Duration
+	nextAttempt time.Time
+}
+
+// OTLP exporter settings
+type OTLPOptions struct {
+	Endpoint string            // Full metrics URL, "/v1/metrics" is added when there's no path
+	Encoding string            // "protobuf" (default) or "json"
+	Headers  map[string]string // Extra request headers (e.g. authentication)
+	Resource map[string]string // Resource attributes, merged over the host ones
+	Timeout  time.Duration
+}
+
+func NewOTLP(opts OTLPOptions) (*OTLP, error) {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = "http://localhost:4318/v1/metrics"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("otlp: invalid endpoint %q", opts.Endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+
+	encoding := opts.Encoding
+	if encoding == "" {
+		encoding = "protobuf"
+	}
+	if encoding != "protobuf" && encoding != "json" {
+		return nil, fmt.Errorf("otlp: unknown encoding %q (expected protobuf or json)", opts.Encoding)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &OTLP{
+		endpoint: u.String(),
+		encoding: encoding,
+		headers:  opts.Headers,
+		resource: otlpResource(opts.Resource),
+		start:    time.Now(),
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Host resource attributes, overridden by the configured ones
+func otlpResource(extra map[string]string) []otlpKeyValue {
+	attrs := map[string]string{
+		"service.name": "syspulse",
+		"os.type":      runtime.GOOS,
+		"host.arch":    otelArch(runtime.GOARCH),
+	}
+	if host, err := os.Hostname(); err == nil {
+		attrs["host.name"] = host
+	}
+	for k, v := range extra {
+		attrs[k] = v
+	}
+
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, k := range labelKeys(attrs) {
+		kvs = append(kvs, otlpString(k, attrs[k]))
+	}
+	return kvs
+}
+
+// Maps Go architecture names to the host.arch well-known values
+func otelArch(goarch string) string {
+	switch goarch {
+	case "386":
+		return "x86"
+	case "ppc64le", "ppc64":
+		return "ppc64"
+	default:
+		return goarch
+	}
+}
+
+func (e *OTLP) Name() string { return "otlp" }
+
+// Queues the sample and sends every queued request unless
+// a previous failure is still backing off
+func (e *OTLP) Export(t time.Time, metrics []systeminfo.Metric) error {
+	payload, err := e.encode(newOTLPRequest(t, e.start, metrics, e.resource))
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var dropped error
+	e.queue = append(e.queue, payload)
+	if n := len(e.queue) - otlpMaxQueue; n > 0 {
+		e.queue = e.queue[n:]
+		dropped = fmt.Errorf("retry queue full, dropped %d request(s)", n)
+	}
+
+	if time.Now().Before(e.nextAttempt) {
+		return dropped
+	}
+	if err := e.sendQueued(); err != nil {
+		return err
+	}
+	return dropped
+}
+
+// Sends one last time whatever is still queued
+func (e *OTLP) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.sendQueued(); err != nil {
+		return fmt.Errorf("otlp: %d request(s) not delivered: %w", len(e.queue), err)
+	}
+	return nil
+}
+
+// Sends queued requests oldest first
+// Retryable failures keep the queue and back off exponentially,
+// requests the collector rejects are dropped
+func (e *OTLP) sendQueued() error {
+	for len(e.queue) > 0 {
+		retryAfter, err := e.post(e.queue[0])
+		if err == nil {
+			e.queue = e.queue[1:]
+			e.backoff = 0
+			continue
+		}
+
+		if retryAfter < 0 {
+			e.queue = e.queue[1:] // Permanent failure, retrying won't help
+			return err
+		}
+
+		e.backoff = min(max(e.backoff*2, otlpMinBackoff), otlpMaxBackoff)
+		wait := max(e.backoff, retryAfter)
+		e.nextAttempt = time.Now().Add(wait)
+		return fmt.Errorf("%w (retrying in %s, %d request(s) queued)", err, wait.Round(time.Second), len(e.queue))
+	}
+	return nil
+}
+
+// Posts a payload, returning how long to wait before retrying
+// or a negative duration when the failure is permanent
+func (e *OTLP) post(payload []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return -1, err
+	}
+	if e.encoding == "json" {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode/100 == 2:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable, resp.StatusCode == http.StatusGatewayTimeout:
+		var wait time.Duration
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(secs) * time.Second
+		}
+		return wait, fmt.Errorf("otlp export failed: %s", resp.Status)
+	default:
+		return -1, fmt.Errorf("otlp export rejected: %s", resp.Status)
+	}
+}
+
+func (e *OTLP) encode(r *otlpRequest) ([]byte, error) {
+	if e.encoding == "json" {
+		return json.Marshal(r)
+	}
+	return r.marshal(), nil
+}
+
+// How a syspulse metric is exported over OTLP
+type otelMetric struct {
+	name   string
+	unit   string
+	kind   otelKind
+	scale  float64           // Applied to values, e.g. 0.01 to turn percents into ratios
+	attrs  map[string]string // Fixed attributes
+	labels map[string]string // syspulse label -> OTel attribute
+}
+
+type otelKind int
+
+const (
+	otelGauge         otelKind = iota
+	otelUpDownCounter          // Non monotonic cumulative sum
+	otelCounter                // Monotonic cumulative sum
+)
+
+var (
+	filesystemLabels = map[string]string{"mountpoint": "system.filesystem.mountpoint", "fstype": "system.filesystem.type"}
+	processLabels    = map[string]string{"pid": "process.pid", "name": "process.executable.name"}
+)
+
+// syspulse metrics with a semantic convention equivalent
+// Anything else is exported as "syspulse.<name>"
+var otelMetrics = map[string]otelMetric{
+	"cpu.percent":             {name: "system.cpu.utilization", unit: "1", scale: 0.01},
+	"memory.total_bytes":      {name: "system.memory.limit", unit: "By", kind: otelUpDownCounter},
+	"memory.used_bytes":       {name: "system.memory.usage", unit: "By", kind: otelUpDownCounter, attrs: map[string]string{"system.memory.state": "used"}},
+	"memory.free_bytes":       {name: "system.memory.usage", unit: "By", kind: otelUpDownCounter, attrs: map[string]string{"system.memory.state": "free"}},
+	"memory.buffers_bytes":    {name: "system.memory.usage", unit: "By", kind: otelUpDownCounter, attrs: map[string]string{"system.memory.state": "buffers"}},
+	"memory.cached_bytes":     {name: "system.memory.usage", unit: "By", kind: otelUpDownCounter, attrs: map[string]string{"system.memory.state": "cached"}},
+	"memory.available_bytes":  {name: "system.linux.memory.available", unit: "By", kind: otelUpDownCounter},
+	"memory.used_percent":     {name: "system.memory.utilization", unit: "1", scale: 0.01, attrs: map[string]string{"system.memory.state": "used"}},
+	"swap.used_bytes":         {name: "system.paging.usage", unit: "By", kind: otelUpDownCounter, attrs: map[string]string{"system.paging.state": "used"}},
+	"swap.free_bytes":         {name: "system.paging.usage", unit: "By", kind: otelUpDownCounter, attrs: map[string]string{"system.paging.state": "free"}},
+	"swap.used_percent":       {name: "system.paging.utilization", unit: "1", scale: 0.01, attrs: map[string]string{"system.paging.state": "used"}},
+	"disk.total_bytes":        {name: "system.filesystem.limit", unit: "By", kind: otelUpDownCounter, labels: filesystemLabels},
+	"disk.used_bytes":         {name: "system.filesystem.usage", unit: "By", kind: otelUpDownCounter, attrs: map[string]string{"system.filesystem.state": "used"}, labels: filesystemLabels},
+	"disk.free_bytes":         {name: "system.filesystem.usage", unit: "By", kind: otelUpDownCounter, attrs: map[string]string{"system.filesystem.state": "free"}, labels: filesystemLabels},
+	"disk.used_percent":       {name: "system.filesystem.utilization", unit: "1", scale: 0.01, labels: filesystemLabels},
+	"process.count":           {name: "system.process.count", unit: "{process}", kind: otelUpDownCounter},
+	"process.cpu_percent":     {name: "process.cpu.utilization", unit: "1", scale: 0.01, labels: processLabels},
+	"process.rss_bytes":       {name: "process.memory.usage", unit: "By", kind: otelUpDownCounter, labels: processLabels},
+	"process.runtime_seconds": {name: "process.uptime", unit: "s", labels: processLabels},
+}
+
+// Descriptions of the metrics fed by several syspulse ones
+var otelDescriptions = map[string]string{
+	"system.memory.usage":     "Physical memory in use, by state.",
+	"system.paging.usage":     "Swap space in use, by state.",
+	"system.filesystem.usage": "Filesystem space in use, by state.",
+}
+
+// Semantic convention units for the syspulse ones
+var otelUnits = map[string]string{"percent": "%", "bytes": "By", "seconds": "s", "bytes_per_second": "By/s"}
+
+// Returns how a metric is exported, falling back to "syspulse.<name>"
+func otelMetricFor(name string) otelMetric {
+	if m, ok := otelMetrics[name]; ok {
+		return m
+	}
+	info := systeminfo.DescribeMetric(name)
+	m := otelMetric{name: "syspulse." + name, unit: otelUnits[info.Unit]}
+	if info.Type == systeminfo.Counter {
+		m.kind = otelCounter
+	}
+	return m
+}
+
+// Builds the export request of a sample
+// start is the start time of cumulative sums
+func newOTLPRequest(t, start time.Time, metrics []systeminfo.Metric, resource []otlpKeyValue) *otlpRequest {
+	var out []otlpMetric
+	index := map[string]int{}
+	ts := uint64(t.UnixNano())
+
+	for _, m := range metrics {
+		if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+			continue
+		}
+		om := otelMetricFor(m.Name)
+
+		i, ok := index[om.name]
+		if !ok {
+			i = len(out)
+			index[om.name] = i
+			desc, ok := otelDescriptions[om.name]
+			if !ok {
+				desc = systeminfo.DescribeMetric(m.Name).Help
+			}
+			metric := otlpMetric{Name: om.name, Unit: om.unit, Description: desc}
+			switch om.kind {
+			case otelGauge:
+				metric.Gauge = &otlpGauge{}
+			default:
+				metric.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: om.kind == otelCounter}
+			}
+			out = append(out, metric)
+		}
+
+		value := m.Value
+		if om.scale != 0 {
+			value *= om.scale
+		}
+		dp := otlpDataPoint{TimeUnixNano: ts, AsDouble: value, Attributes: otelAttributes(om, m.Labels)}
+
+		if out[i].Gauge != nil {
+			out[i].Gauge.DataPoints = append(out[i].Gauge.DataPoints, dp)
+		} else {
+			dp.StartTimeUnixNano = uint64(start.UnixNano())
+			out[i].Sum.DataPoints = append(out[i].Sum.DataPoints, dp)
+		}
+	}
+
+	return &otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResourceAttrs{Attributes: resource},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "syspulse"},
+			Metrics: out,
+		}},
+	}}}
+}
+
+// Attributes of a data point, renaming labels to their
+// semantic convention names (unknown ones are kept as they are)
+func otelAttributes(om otelMetric, labels map[string]string) []otlpKeyValue {
+	attrs := make(map[string]string, len(om.attrs)+len(labels))
+	for k, v := range om.attrs {
+		attrs[k] = v
+	}
+	for k, v := range labels {
+		if name, ok := om.labels[k]; ok {
+			k = name
+		}
+		attrs[k] = v
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		// process.pid is an int attribute
+		if k == "process.pid" {
+			if pid, err := strconv.ParseInt(attrs[k], 10, 64); err == nil {
+				kvs = append(kvs, otlpInt(k, pid))
+				continue
+			}
+		}
+		kvs = append(kvs, otlpString(k, attrs[k]))
+	}
+	return kvs
+}
@@ -0,0 +1,194 @@
+package export
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// OTLP metrics data model (opentelemetry/proto/metrics/v1)
+// The json tags follow the OTLP/JSON mapping, the marshal methods
+// write the protobuf wire format by hand
+
+// AggregationTemporality of cumulative sums
+const otlpCumulative = 2
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResourceAttrs  `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResourceAttrs struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,string,omitempty"`
+	TimeUnixNano      uint64         `json:"timeUnixNano,string"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *int64  `json:"intValue,string,omitempty"`
+}
+
+func otlpString(k, v string) otlpKeyValue {
+	return otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: &v}}
+}
+
+func otlpInt(k string, v int64) otlpKeyValue {
+	return otlpKeyValue{Key: k, Value: otlpAnyValue{IntValue: &v}}
+}
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	return binary.AppendUvarint(appendTag(b, field, wireVarint), v)
+}
+
+func appendFixed64Field(b []byte, field int, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(appendTag(b, field, wireFixed64), v)
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendStringField(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return appendBytesField(b, field, []byte(v))
+}
+
+// ExportMetricsServiceRequest
+func (r *otlpRequest) marshal() []byte {
+	var b []byte
+	for i := range r.ResourceMetrics {
+		b = appendBytesField(b, 1, r.ResourceMetrics[i].marshal())
+	}
+	return b
+}
+
+func (r *otlpResourceMetrics) marshal() []byte {
+	var res []byte
+	for _, kv := range r.Resource.Attributes {
+		res = appendBytesField(res, 1, kv.marshal())
+	}
+	b := appendBytesField(nil, 1, res)
+	for i := range r.ScopeMetrics {
+		b = appendBytesField(b, 2, r.ScopeMetrics[i].marshal())
+	}
+	return b
+}
+
+func (s *otlpScopeMetrics) marshal() []byte {
+	scope := appendStringField(nil, 1, s.Scope.Name)
+	scope = appendStringField(scope, 2, s.Scope.Version)
+	b := appendBytesField(nil, 1, scope)
+	for i := range s.Metrics {
+		b = appendBytesField(b, 2, s.Metrics[i].marshal())
+	}
+	return b
+}
+
+func (m *otlpMetric) marshal() []byte {
+	b := appendStringField(nil, 1, m.Name)
+	b = appendStringField(b, 2, m.Description)
+	b = appendStringField(b, 3, m.Unit)
+
+	switch {
+	case m.Gauge != nil:
+		var g []byte
+		for i := range m.Gauge.DataPoints {
+			g = appendBytesField(g, 1, m.Gauge.DataPoints[i].marshal())
+		}
+		b = appendBytesField(b, 5, g)
+	case m.Sum != nil:
+		var s []byte
+		for i := range m.Sum.DataPoints {
+			s = appendBytesField(s, 1, m.Sum.DataPoints[i].marshal())
+		}
+		s = appendVarintField(s, 2, uint64(m.Sum.AggregationTemporality))
+		if m.Sum.IsMonotonic {
+			s = appendVarintField(s, 3, 1)
+		}
+		b = appendBytesField(b, 7, s)
+	}
+	return b
+}
+
+// NumberDataPoint
+func (d *otlpDataPoint) marshal() []byte {
+	var b []byte
+	if d.StartTimeUnixNano != 0 {
+		b = appendFixed64Field(b, 2, d.StartTimeUnixNano)
+	}
+	b = appendFixed64Field(b, 3, d.TimeUnixNano)
+	b = appendFixed64Field(b, 4, math.Float64bits(d.AsDouble))
+	for _, kv := range d.Attributes {
+		b = appendBytesField(b, 7, kv.marshal())
+	}
+	return b
+}
+
+// KeyValue holding an AnyValue
+func (kv *otlpKeyValue) marshal() []byte {
+	var v []byte
+	switch {
+	case kv.Value.StringValue != nil:
+		v = appendBytesField(v, 1, []byte(*kv.Value.StringValue))
+	case kv.Value.IntValue != nil:
+		v = appendVarintField(v, 3, uint64(*kv.Value.IntValue))
+	}
+	b := appendStringField(nil, 1, kv.Key)
+	return appendBytesField(b, 2, v)
+}
@@ -0,0 +1,111 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Prefix of every exported Prometheus metric
+const promPrefix = "syspulse_"
+
+const (
+	promContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Writes metrics in the Prometheus text exposition format,
+// or in OpenMetrics when openMetrics is set
+func WritePrometheus(w io.Writer, metrics []systeminfo.Metric, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range groupFamilies(metrics) {
+		name := promPrefix + sanitizeName(f.name)
+		sampleName := name
+
+		// OpenMetrics names counter families without their _total suffix
+		if openMetrics && f.info.Type == systeminfo.Counter {
+			name = strings.TrimSuffix(name, "_total")
+			sampleName = name + "_total"
+		}
+
+		help := escapeHelp(f.info.Help)
+		if openMetrics {
+			help = escapeLabel(f.info.Help) // OpenMetrics also escapes quotes
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.info.Type)
+		if openMetrics && f.info.Unit != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", name, f.info.Unit)
+		}
+
+		for _, m := range f.metrics {
+			bw.WriteString(sampleName)
+			if len(m.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, k := range labelKeys(m.Labels) {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", sanitizeName(k), escapeLabel(m.Labels[k]))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatFloat(m.Value))
+			bw.WriteByte('\n')
+		}
+	}
+
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// Handler serving the latest metrics of the store on /metrics
+// maxProcesses bounds the per-process series besides the watched ones (-1 for no limit)
+func PrometheusHandler(store *Store, maxProcesses int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collected, metrics, pinned := store.Get()
+		if collected.IsZero() {
+			http.Error(w, "no metrics collected yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", openMetricsContentType)
+		} else {
+			w.Header().Set("Content-Type", promContentType)
+		}
+
+		WritePrometheus(w, LimitProcesses(metrics, maxProcesses, pinned), openMetrics)
+	})
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,110 @@
+package export
+
+import (
+	"errors"
+	"github/iegpeppino/syspulse/systeminfo"
+	"sync"
+	"time"
+)
+
+// Push based destination receiving every collected sample
+type Exporter interface {
+	Name() string
+	Export(t time.Time, metrics []systeminfo.Metric) error
+	Close() error
+}
+
+// Exporter holding samples back until a batch fills up
+// FlushDue is called on a timer to send the ones that waited long enough
+type Flusher interface {
+	FlushDue() error
+}
+
+// How often exporters get a chance to flush between samples
+var flushCheck = time.Second
+
+// Sample handed to the exporters
+type sample struct {
+	time    time.Time
+	metrics []systeminfo.Metric
+}
+
+// Feeds samples to the exporters from a background goroutine
+// so a slow destination never stalls collection or the TUI
+type Runner struct {
+	exporters []Exporter
+	samples   chan sample
+	onError   func(name string, err error)
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Starts a runner, onError is called from the runner goroutine
+// whenever an exporter fails
+func NewRunner(exporters []Exporter, onError func(name string, err error)) *Runner {
+	r := &Runner{
+		exporters: exporters,
+		samples:   make(chan sample, 16),
+		onError:   onError,
+		done:      make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *Runner) run() {
+	defer close(r.done)
+	tick := time.NewTicker(flushCheck)
+	defer tick.Stop()
+
+	for {
+		select {
+		case s, ok := <-r.samples:
+			if !ok {
+				return
+			}
+			for _, e := range r.exporters {
+				if err := e.Export(s.time, s.metrics); err != nil && r.onError != nil {
+					r.onError(e.Name(), err)
+				}
+			}
+		case <-tick.C:
+			for _, e := range r.exporters {
+				f, ok := e.(Flusher)
+				if !ok {
+					continue
+				}
+				if err := f.FlushDue(); err != nil && r.onError != nil {
+					r.onError(e.Name(), err)
+				}
+			}
+		}
+	}
+}
+
+// Queues a sample, dropping it when the exporters are too far behind
+func (r *Runner) Submit(t time.Time, metrics []systeminfo.Metric) {
+	select {
+	case r.samples <- sample{time: t, metrics: metrics}:
+	default:
+		if r.onError != nil {
+			r.onError("export", errors.New("exporters are falling behind, sample dropped"))
+		}
+	}
+}
+
+// Waits for queued samples and closes every exporter,
+// flushing what they still hold
+func (r *Runner) Close() error {
+	var errs []error
+	r.closeOnce.Do(func() {
+		close(r.samples)
+		<-r.done
+		for _, e := range r.exporters {
+			if err := e.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,187 @@
+package export
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packet size keeping datagrams unfragmented on a 1500 bytes MTU
+const statsdPacketSize = 1432
+
+// Pushes every metric to a StatsD or DogStatsD daemon over UDP
+// Gauges are sent as gauges and counters as the increase since the
+// previous sample
+type StatsD struct {
+	mu         sync.Mutex
+	prefix     string
+	dogstatsd  bool
+	tags       map[string]string
+	sampleRate float64
+	pusher     *linePusher
+	conn       *netConn
+	counters   map[string]float64 // Last value of each counter series
+}
+
+// StatsD exporter settings
+type StatsDOptions struct {
+	Address    string            // host:port of the daemon, 127.0.0.1:8125 by default
+	Flavor     string            // "statsd" (default) or "dogstatsd"
+	Prefix     string            // Prepended to metric names
+	Tags       map[string]string // DogStatsD tags added to every metric
+	SampleRate float64           // Share of metrics sent, between 0 and 1 (default 1)
+	PacketSize int               // Max datagram size
+}
+
+func NewStatsD(opts StatsDOptions) (*StatsD, error) {
+	address := opts.Address
+	if address == "" {
+		address = "127.0.0.1:8125"
+	}
+
+	var dogstatsd bool
+	switch opts.Flavor {
+	case "", "statsd":
+	case "dogstatsd":
+		dogstatsd = true
+	default:
+		return nil, fmt.Errorf("statsd: unknown flavor %q (expected statsd or dogstatsd)", opts.Flavor)
+	}
+
+	rate := opts.SampleRate
+	if rate == 0 {
+		rate = 1
+	}
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("statsd: sample rate must be between 0 and 1, got %v", opts.SampleRate)
+	}
+
+	size := opts.PacketSize
+	if size <= 0 {
+		size = statsdPacketSize
+	}
+
+	e := &StatsD{
+		prefix:     strings.TrimSuffix(opts.Prefix, "."),
+		dogstatsd:  dogstatsd,
+		tags:       opts.Tags,
+		sampleRate: rate,
+		conn:       &netConn{network: "udp", address: address},
+		counters:   map[string]float64{},
+	}
+	e.pusher = newLinePusher(e.conn.write, 0, 0, nil)
+	e.pusher.maxBatchBytes = size
+	return e, nil
+}
+
+func (e *StatsD) Name() string { return "statsd" }
+
+func (e *StatsD) Export(t time.Time, metrics []systeminfo.Metric) error {
+	e.mu.Lock()
+	lines := e.lines(metrics)
+	e.mu.Unlock()
+	return e.pusher.push(lines)
+}
+
+func (e *StatsD) Close() error {
+	err := e.pusher.flush()
+	e.conn.close()
+	return err
+}
+
+// Formats metrics as "name:value|type[|@rate][|#tags]" lines
+func (e *StatsD) lines(metrics []systeminfo.Metric) [][]byte {
+	lines := make([][]byte, 0, len(metrics))
+
+	for _, m := range metrics {
+		name := e.name(m)
+		value, kind := m.Value, "g"
+
+		if systeminfo.DescribeMetric(m.Name).Type == systeminfo.Counter {
+			key := m.Name + "," + tagSet(m.Labels)
+			prev, seen := e.counters[key]
+			e.counters[key] = m.Value
+			if !seen {
+				continue // Nothing to compare against yet
+			}
+			value, kind = m.Value-prev, "c"
+			if value < 0 {
+				value = m.Value // Counter reset
+			}
+		}
+
+		// Counters are tracked even when sampled out,
+		// the daemon scales sampled increases by 1/rate
+		if e.sampleRate < 1 && rand.Float64() >= e.sampleRate {
+			continue
+		}
+
+		suffix := "|" + kind
+		if e.sampleRate < 1 {
+			suffix += "|@" + strconv.FormatFloat(e.sampleRate, 'f', -1, 64)
+		}
+		if e.dogstatsd {
+			if tags := e.tagList(m.Labels); tags != "" {
+				suffix += "|#" + tags
+			}
+		}
+
+		// A signed gauge value is a relative change, so negative
+		// values are sent as a reset to zero followed by a decrement
+		v := strconv.FormatFloat(value, 'f', -1, 64)
+		if kind == "g" && value < 0 {
+			lines = append(lines, []byte(name+":0"+suffix))
+		}
+		lines = append(lines, []byte(name+":"+v+suffix))
+	}
+	return lines
+}
+
+// Metric name with the prefix, plain StatsD has no tags so labels
+// become name segments (disk.used_percent.mountpoint._)
+func (e *StatsD) name(m systeminfo.Metric) string {
+	var b strings.Builder
+	if e.prefix != "" {
+		b.WriteString(e.prefix)
+		b.WriteByte('.')
+	}
+	b.WriteString(graphiteSegment(m.Name, true))
+	if !e.dogstatsd {
+		for _, k := range labelKeys(m.Labels) {
+			fmt.Fprintf(&b, ".%s.%s", graphiteSegment(k, false), graphiteSegment(m.Labels[k], false))
+		}
+	}
+	return b.String()
+}
+
+// DogStatsD "k:v" tags from the global tags and the labels
+func (e *StatsD) tagList(labels map[string]string) string {
+	all := make(map[string]string, len(e.tags)+len(labels))
+	for k, v := range e.tags {
+		all[k] = v
+	}
+	for k, v := range labels {
+		all[k] = v
+	}
+
+	tags := make([]string, 0, len(all))
+	for _, k := range labelKeys(all) {
+		tags = append(tags, statsdSafe(k)+":"+statsdSafe(all[k]))
+	}
+	return strings.Join(tags, ",")
+}
+
+// Replaces the characters delimiting StatsD fields
+func statsdSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', ',', '#', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,157 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How often repeated errors are summarized
+// and how long an error must stay quiet to be forgotten
+const (
+	summaryInterval = time.Minute
+	forgetAfter     = 10 * time.Minute
+)
+
+// Errors carrying their own cause class and log attributes
+// (see systeminfo.CollectError)
+type structuredError interface {
+	error
+	Cause() string
+	Attrs() []slog.Attr
+}
+
+// Occurrences of one kind of collector error
+type errorEntry struct {
+	source     string
+	op         string
+	cause      string
+	msg        string
+	lastSeen   time.Time
+	lastReport time.Time
+	suppressed int
+}
+
+// Keeps track of the collector errors already logged
+type errorTracker struct {
+	mu      sync.Mutex
+	entries map[string]*errorEntry
+}
+
+var collectorErrors = &errorTracker{entries: map[string]*errorEntry{}}
+
+// Logs a collector error once per source and cause
+// Joined errors are split and classified one by one, repeats are
+// counted and summarized every summaryInterval as "N more occurrences"
+func CollectorError(source, msg string, err error) {
+	if err == nil {
+		collectorErrors.summarize(time.Now(), false)
+		return
+	}
+
+	now := time.Now()
+	for _, e := range systeminfo.SplitErrors(err) {
+		collectorErrors.report(now, source, msg, e)
+	}
+	collectorErrors.summarize(now, false)
+}
+
+// Logs the pending summaries of repeated collector errors
+func FlushCollectorErrors() {
+	collectorErrors.summarize(time.Now(), true)
+}
+
+func (t *errorTracker) report(now time.Time, source, msg string, err error) {
+	op, cause, attrs := describeError(err)
+	key := source + "|" + op + "|" + cause
+
+	t.mu.Lock()
+	entry, seen := t.entries[key]
+	if seen {
+		entry.suppressed++
+		entry.lastSeen = now
+		t.mu.Unlock()
+		return
+	}
+	t.entries[key] = &errorEntry{
+		source:     source,
+		op:         op,
+		cause:      cause,
+		msg:        msg,
+		lastSeen:   now,
+		lastReport: now,
+	}
+	t.mu.Unlock()
+
+	// First occurrence, logged with all its attributes
+	args := []any{slog.String("source", source), slog.String("cause", cause)}
+	for _, a := range attrs {
+		args = append(args, a)
+	}
+	Logger.Error(msg, args...)
+}
+
+// Logs how many times each error repeated since it was last reported
+// Unless force is set only entries older than summaryInterval are logged
+func (t *errorTracker) summarize(now time.Time, force bool) {
+	t.mu.Lock()
+	var due []errorEntry
+	for key, e := range t.entries {
+		if now.Sub(e.lastSeen) > forgetAfter && e.suppressed == 0 {
+			delete(t.entries, key) // Log it again if it ever comes back
+			continue
+		}
+		if e.suppressed == 0 || (!force && now.Sub(e.lastReport) < summaryInterval) {
+			continue
+		}
+		due = append(due, *e)
+		e.suppressed = 0
+		e.lastReport = now
+	}
+	t.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].source+due[i].op+due[i].cause < due[j].source+due[j].op+due[j].cause
+	})
+	for _, e := range due {
+		Logger.Error(fmt.Sprintf("%s (%d more occurrences)", e.msg, e.suppressed),
+			slog.String("source", e.source),
+			slog.String("op", e.op),
+			slog.String("cause", e.cause),
+			slog.Int("more_occurrences", e.suppressed),
+			slog.Time("since", e.lastReport))
+	}
+}
+
+// Returns the operation, cause class and attributes of an error
+func describeError(err error) (op, cause string, attrs []slog.Attr) {
+	var se structuredError
+	if errors.As(err, &se) {
+		attrs = se.Attrs()
+		for _, a := range attrs {
+			if a.Key == "op" {
+				op = a.Value.String()
+			}
+		}
+		return op, se.Cause(), attrs
+	}
+
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		cause = "permission"
+	case errors.Is(err, fs.ErrNotExist):
+		cause = "not_found"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		cause = "timeout"
+	default:
+		cause = "other"
+	}
+	return "", cause, []slog.Attr{slog.String("error", err.Error())}
+}
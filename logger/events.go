@@ -0,0 +1,190 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry of the in-memory event log shown by the LOG tab
+type Event struct {
+	Seq     uint64 // Increasing sequence number, unique per event
+	Time    time.Time
+	Level   slog.Level
+	Source  string // "source" attribute: collector name, "alert", "user"...
+	Message string
+	Details string // Remaining attributes as key=value pairs
+}
+
+// Fixed size ring buffer of the most recent events
+type EventBuffer struct {
+	mu     sync.Mutex
+	events []Event
+	next   int // Position the next event is written to
+	full   bool
+	seq    uint64
+}
+
+func NewEventBuffer(size int) *EventBuffer {
+	return &EventBuffer{events: make([]Event, size)}
+}
+
+// Recent events logged through Logger (info level and above)
+var Events = NewEventBuffer(500)
+
+// Minimum level recorded in the event buffer
+const eventLevel = slog.LevelInfo
+
+// Adds an event, overwriting the oldest one when full
+func (b *EventBuffer) Add(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e.Seq = b.seq
+	b.events[b.next] = e
+	b.next = (b.next + 1) % len(b.events)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Returns a copy of the buffered events, oldest first
+func (b *EventBuffer) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]Event(nil), b.events[:b.next]...)
+	}
+	out := make([]Event, 0, len(b.events))
+	out = append(out, b.events[b.next:]...)
+	return append(out, b.events[:b.next]...)
+}
+
+// Returns the sequence number of the latest event
+func (b *EventBuffer) LastSeq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// Counts the buffered events at or above level newer than seq
+func (b *EventBuffer) CountSince(seq uint64, level slog.Level) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _, e := range b.events {
+		if e.Seq > seq && e.Level >= level {
+			n++
+		}
+	}
+	return n
+}
+
+// slog handler recording every record into an EventBuffer
+type eventHandler struct {
+	buf    *EventBuffer
+	attrs  []groupedAttr
+	prefix string // Group prefix for attribute keys
+}
+
+// Attribute added by WithAttrs, with the groups open at the time
+type groupedAttr struct {
+	prefix string
+	attr   slog.Attr
+}
+
+func (h *eventHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= eventLevel
+}
+
+func (h *eventHandler) Handle(_ context.Context, r slog.Record) error {
+	e := Event{
+		Time:    r.Time,
+		Level:   r.Level,
+		Source:  "app",
+		Message: r.Message,
+	}
+
+	var details []string
+	add := func(prefix string, a slog.Attr) {
+		if a.Key == "source" && prefix == "" {
+			e.Source = a.Value.String()
+			return
+		}
+		details = append(details, fmt.Sprintf("%s%s=%v", prefix, a.Key, a.Value))
+	}
+	for _, ga := range h.attrs {
+		add(ga.prefix, ga.attr)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(h.prefix, a)
+		return true
+	})
+	e.Details = strings.Join(details, " ")
+
+	h.buf.Add(e)
+	return nil
+}
+
+func (h *eventHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	all := append([]groupedAttr(nil), h.attrs...)
+	for _, a := range attrs {
+		all = append(all, groupedAttr{prefix: h.prefix, attr: a})
+	}
+	return &eventHandler{buf: h.buf, attrs: all, prefix: h.prefix}
+}
+
+func (h *eventHandler) WithGroup(name string) slog.Handler {
+	return &eventHandler{buf: h.buf, attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// slog handler forwarding records to several handlers
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			if e := h.Handle(ctx, r.Clone()); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// Creates a logger writing to h and to the Events buffer
+func newLogger(h slog.Handler) *slog.Logger {
+	return slog.New(teeHandler{h, &eventHandler{buf: Events}})
+}
@@ -1,33 +1,101 @@
 package logger
 
 import (
+	"fmt"
+	"github/iegpeppino/syspulse/config"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
-var Logger *slog.Logger
+// Defaults to stderr until SysDataLogger is called
+var Logger = newLogger(slog.NewJSONHandler(os.Stderr, nil))
+
+// Log file kept open for the whole life of the program
+var logFile io.Closer
 
 // This logger specifically logs errors occurring while getting system stats
-func SysDataLogger() {
+// It writes to the configured file (rotating it as needed). When the file
+// can't be opened the error is returned and logs go to stderr, or only
+// to the Events buffer when tui is set so they don't garble the screen
+func SysDataLogger(cfg config.Log, tui bool) error {
+	if err := setupLogger(cfg); err != nil {
+		if !tui {
+			Logger = newLogger(slog.NewJSONHandler(os.Stderr, nil))
+			return err
+		}
+		// Shown in the LOG tab, stderr is hidden behind the TUI
+		Logger = slog.New(&eventHandler{buf: Events})
+		Logger.Error("Unable to open the log file", slog.String("source", "logger"), slog.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+func setupLogger(cfg config.Log) error {
+	// Level and format were checked by config.Load
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q", cfg.Level)
+	}
+
+	path, err := LogPath(cfg)
+	if err != nil {
+		return err
+	}
 
 	// Configure logger to write to file
-	logFile, err := os.OpenFile("../logs/errors/systemstats.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	file, err := openRotatingFile(
+		path,
+		int64(cfg.MaxSizeMB)*1024*1024,
+		time.Duration(cfg.MaxAgeDays)*24*time.Hour,
+		cfg.MaxBackups)
 	if err != nil {
-		slog.Error("Failed to open log file", "error", err)
-		// Return stderr of file loggin fails
-		Logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
-		return
+		return err
 	}
-	// Close logfile
-	defer logFile.Close()
 
 	// Create handler with settings
-	handler := slog.NewJSONHandler(
-		logFile,
-		&slog.HandlerOptions{
-			Level: slog.LevelError, // Only log errors and fatal errors
-		})
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(file, opts)
+	case "text":
+		handler = slog.NewTextHandler(file, opts)
+	default:
+		file.Close()
+		return fmt.Errorf("invalid log format %q", cfg.Format)
+	}
 
-	Logger = slog.New(handler)
+	logFile = file
+	Logger = newLogger(handler)
+	return nil
+}
+
+// Returns where logs are written: the configured path or
+// $XDG_STATE_HOME/syspulse/syspulse.log (~/.local/state if unset)
+func LogPath(cfg config.Log) (string, error) {
+	if cfg.Path != "" {
+		return filepath.Abs(cfg.Path)
+	}
+
+	stateDir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "syspulse.log"), nil
+}
 
+// Flushes and closes the log file, call it before exiting
+func Close() error {
+	if logFile == nil {
+		return nil
+	}
+	FlushCollectorErrors()
+	err := logFile.Close()
+	logFile = nil
+	return err
 }
@@ -0,0 +1,235 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File writer rotating the log once it grows past maxSize bytes
+// or gets older than maxAge, keeping at most maxBackups old files
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	file    *os.File
+	size    int64
+	created time.Time
+	retryAt time.Time // No rotation is tried before, after one failed
+}
+
+// Layout of the timestamp in backup names: syspulse-20250102-150405.000.log
+const backupLayout = "20060102-150405.000"
+
+// How long to keep appending to the current file after a failed rotation
+const rotateRetry = time.Minute
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create log directory: %w", err)
+	}
+
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Opens (or creates) the log file, appending to its current content
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to stat log file: %w", err)
+	}
+
+	r.file = f
+	r.size = info.Size()
+	r.created = time.Now()
+	if r.size > 0 {
+		r.created = r.startedAt()
+	}
+	return nil
+}
+
+// When the existing log file was started: the time of its first record,
+// or else the rotation that created it (the newest backup timestamp)
+// The mtime can't tell, it moves with every write
+func (r *rotatingFile) startedAt() time.Time {
+	if t, ok := firstRecordTime(r.path); ok {
+		return t
+	}
+	if backups := r.backups(); len(backups) > 0 {
+		return backupTime(r.path, backups[len(backups)-1])
+	}
+	return time.Now()
+}
+
+// Time of the first record of a JSON or text slog file
+func firstRecordTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	line, _, _ := strings.Cut(string(buf[:n]), "\n")
+
+	var stamp string
+	if rest, ok := strings.CutPrefix(line, `{"time":"`); ok {
+		stamp, _, _ = strings.Cut(rest, `"`)
+	} else if rest, ok := strings.CutPrefix(line, "time="); ok {
+		stamp, _, _ = strings.Cut(rest, " ")
+	}
+	t, err := time.Parse(time.RFC3339Nano, stamp)
+	return t, err == nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if r.size > 0 && r.needsRotation(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			if r.file == nil {
+				return 0, err
+			}
+			// Still logging to the current file, the LOG tab tells about it
+			// (going through Logger would write to this very file)
+			r.retryAt = time.Now().Add(rotateRetry)
+			Events.Add(Event{
+				Time:    time.Now(),
+				Level:   slog.LevelWarn,
+				Source:  "logger",
+				Message: "Log rotation failed",
+				Details: "error=" + err.Error(),
+			})
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) needsRotation(incoming int64) bool {
+	if time.Now().Before(r.retryAt) {
+		return false
+	}
+	if r.maxSize > 0 && r.size+incoming > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && time.Since(r.created) > r.maxAge
+}
+
+// Renames the current file to a timestamped backup,
+// starts a new one and removes backups beyond retention
+// The current file is reopened when the rename fails, so logging goes on
+func (r *rotatingFile) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return errors.Join(fmt.Errorf("unable to close log file: %w", err), r.open())
+	}
+
+	ext := filepath.Ext(r.path)
+	backup := fmt.Sprintf("%s-%s%s",
+		strings.TrimSuffix(r.path, ext),
+		time.Now().Format(backupLayout),
+		ext)
+	if err := os.Rename(r.path, backup); err != nil {
+		return errors.Join(fmt.Errorf("unable to rotate log file: %w", err), r.open())
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.prune()
+	return nil
+}
+
+// Deletes the oldest backups when there are more than maxBackups
+func (r *rotatingFile) prune() {
+	if r.maxBackups <= 0 {
+		return
+	}
+
+	backups := r.backups()
+	if len(backups) <= r.maxBackups {
+		return
+	}
+	for _, b := range backups[:len(backups)-r.maxBackups] {
+		os.Remove(b)
+	}
+}
+
+// Backups of the log file, oldest first
+// Only files named like backups are listed, not others sharing the prefix
+func (r *rotatingFile) backups() []string {
+	ext := filepath.Ext(r.path)
+	matches, err := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-*" + ext)
+	if err != nil {
+		return nil
+	}
+	var backups []string
+	for _, b := range matches {
+		if !backupTime(r.path, b).IsZero() {
+			backups = append(backups, b)
+		}
+	}
+
+	// Timestamps sort chronologically as strings
+	sort.Strings(backups)
+	return backups
+}
+
+// Time a backup was rotated out, zero when the name doesn't hold one
+func backupTime(path, backup string) time.Time {
+	ext := filepath.Ext(path)
+	stamp := strings.TrimSuffix(strings.TrimPrefix(backup, strings.TrimSuffix(path, ext)+"-"), ext)
+	t, err := time.ParseInLocation(backupLayout, stamp, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,137 @@
+package recording
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Recording settings
+type Options struct {
+	Path        string        // First file of the session, later parts are named <name>-2.spr, <name>-3.spr...
+	Interval    time.Duration // Collection interval, stored in the header, 0 when it isn't fixed
+	MaxSize     int64         // Roll over to a new part past this size, 0 for no limit
+	MaxDuration time.Duration // Roll over to a new part after this long, 0 for no limit
+	Keep        int           // Parts kept, older ones are deleted (0 keeps all of them)
+}
+
+// Writes a session, rolling over to a new file when a part
+// reaches its size or duration cap
+type Recorder struct {
+	opts    Options
+	w       *Writer
+	part    int
+	started time.Time // Start of the current part
+	parts   []string  // Files written, oldest first
+	samples int
+}
+
+func NewRecorder(opts Options) (*Recorder, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("no recording path given")
+	}
+	if dir := filepath.Dir(opts.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("unable to create recording directory: %w", err)
+		}
+	}
+	return &Recorder{opts: opts}, nil
+}
+
+// Writes a sample, opening the first part or
+// rolling over to the next one when needed
+func (r *Recorder) Record(s systeminfo.Snapshot) error {
+	if r.w != nil && r.full(s.Time) {
+		if err := r.w.Close(); err != nil {
+			return err
+		}
+		r.w = nil
+	}
+
+	if r.w == nil {
+		if err := r.next(s); err != nil {
+			return err
+		}
+	}
+
+	if err := r.w.Write(s); err != nil {
+		return err
+	}
+	r.samples++
+	return nil
+}
+
+// Reports whether the current part reached one of its caps
+func (r *Recorder) full(now time.Time) bool {
+	return (r.opts.MaxSize > 0 && r.w.Size() >= r.opts.MaxSize) ||
+		(r.opts.MaxDuration > 0 && now.Sub(r.started) >= r.opts.MaxDuration)
+}
+
+// Opens the next part and prunes the old ones
+func (r *Recorder) next(s systeminfo.Snapshot) error {
+	r.part++
+	path := partPath(r.opts.Path, r.part)
+
+	h := Header{
+		Host:     s.Host,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Started:  s.Time,
+		Sections: s.Sections,
+		Part:     r.part,
+	}
+	if r.opts.Interval > 0 {
+		h.Interval = r.opts.Interval.String()
+	}
+	w, err := Create(path, h)
+	if err != nil {
+		return fmt.Errorf("unable to create recording: %w", err)
+	}
+
+	r.w = w
+	r.started = s.Time
+	r.parts = append(r.parts, path)
+
+	if r.opts.Keep > 0 {
+		for len(r.parts) > r.opts.Keep {
+			os.Remove(r.parts[0])
+			r.parts = r.parts[1:]
+		}
+	}
+	return nil
+}
+
+// File name of a session part, the first one keeps the given path
+func partPath(path string, part int) string {
+	if part == 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), part, ext)
+}
+
+// File being written, "" before the first sample
+func (r *Recorder) Current() string {
+	if r.w == nil {
+		return ""
+	}
+	return r.w.Name()
+}
+
+// Samples recorded so far
+func (r *Recorder) Samples() int {
+	return r.samples
+}
+
+func (r *Recorder) Close() error {
+	if r.w == nil {
+		return nil
+	}
+	err := r.w.Close()
+	r.w = nil
+	return err
+}
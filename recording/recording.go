@@ -0,0 +1,313 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// Session files (.spr) are a header followed by one frame per sample:
+//
+//	magic "SPR1" | header length (uint32) | header JSON | header CRC32
+//	frame length (uint32) | frame CRC32 | deflate compressed JSON record
+//
+// Integers are big endian. Frames are self contained, so a file cut
+// short by a crash is readable up to its last complete frame
+
+const (
+	Magic   = "SPR1"
+	Version = 1
+
+	// File extension of session recordings
+	Ext = ".spr"
+
+	// Upper bound of a frame, anything bigger is corruption
+	maxFrameSize = 64 << 20
+)
+
+// Returned by Reader.Next when the file ends in an incomplete or
+// corrupt frame, every sample before it was read fine
+var ErrTruncated = errors.New("recording ends with a truncated or corrupt record")
+
+// Describes the recorded host and collectors
+type Header struct {
+	Version  int       `json:"version"`
+	Host     string    `json:"host"`
+	OS       string    `json:"os"`
+	Arch     string    `json:"arch"`
+	Started  time.Time `json:"started"`
+	Interval string    `json:"interval"` // Collection interval, empty when it isn't fixed
+	Sections []string  `json:"sections"` // Collector groups recorded
+	Part     int       `json:"part"`     // Position in a rolled over session, from 1
+}
+
+// A recorded sample
+// Collector errors are kept as their message and location
+type record struct {
+	Snapshot systeminfo.Snapshot        `json:"snapshot"`
+	Errors   map[string][]recordedError `json:"errors,omitempty"`
+}
+
+type recordedError struct {
+	Source     string `json:"source,omitempty"`
+	Op         string `json:"op,omitempty"`
+	PID        int32  `json:"pid,omitempty"`
+	Mountpoint string `json:"mountpoint,omitempty"`
+	Message    string `json:"message"`
+}
+
+// Appends samples to a session file
+type Writer struct {
+	f        *os.File
+	buf      bytes.Buffer
+	zw       *flate.Writer
+	size     int64
+	lastSync time.Time
+}
+
+// How often written frames are flushed to disk
+const syncInterval = 10 * time.Second
+
+// Creates a session file and writes its header
+// An existing file is never overwritten
+func Create(path string, h Header) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	h.Version = Version
+	data, err := json.Marshal(h)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var head []byte
+	head = append(head, Magic...)
+	head = binary.BigEndian.AppendUint32(head, uint32(len(data)))
+	head = append(head, data...)
+	head = binary.BigEndian.AppendUint32(head, crc32.ChecksumIEEE(data))
+	if _, err := f.Write(head); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	zw, _ := flate.NewWriter(nil, flate.BestCompression)
+	return &Writer{f: f, zw: zw, size: int64(len(head)), lastSync: time.Now()}, nil
+}
+
+// Appends a sample
+// Each frame goes out in a single write so a crash can only cut the last one
+func (w *Writer) Write(s systeminfo.Snapshot) error {
+	data, err := json.Marshal(record{Snapshot: s, Errors: recordErrors(s.Errors)})
+	if err != nil {
+		return err
+	}
+
+	w.buf.Reset()
+	w.buf.Write(make([]byte, 8)) // Length and CRC, filled below
+	w.zw.Reset(&w.buf)
+	w.zw.Write(data)
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+
+	frame := w.buf.Bytes()
+	payload := frame[8:]
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+
+	n, err := w.f.Write(frame)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if time.Since(w.lastSync) >= syncInterval {
+		w.lastSync = time.Now()
+		return w.f.Sync()
+	}
+	return nil
+}
+
+// Bytes written so far, header included
+func (w *Writer) Size() int64 {
+	return w.size
+}
+
+func (w *Writer) Name() string {
+	return w.f.Name()
+}
+
+func (w *Writer) Close() error {
+	err := w.f.Sync()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Flattens collector errors (joined ones included) into recordable ones
+func recordErrors(errs map[string]error) map[string][]recordedError {
+	if len(errs) == 0 {
+		return nil
+	}
+	out := make(map[string][]recordedError, len(errs))
+	for key, err := range errs {
+		for _, e := range systeminfo.SplitErrors(err) {
+			r := recordedError{Message: e.Error()}
+			var ce *systeminfo.CollectError
+			if errors.As(e, &ce) {
+				r = recordedError{Source: ce.Source, Op: ce.Op, PID: ce.PID, Mountpoint: ce.Mountpoint, Message: ce.Err.Error()}
+			}
+			out[key] = append(out[key], r)
+		}
+	}
+	return out
+}
+
+// Rebuilds the collector errors of a recorded sample
+func restoreErrors(recorded map[string][]recordedError) map[string]error {
+	out := map[string]error{}
+	for key, list := range recorded {
+		errs := make([]error, 0, len(list))
+		for _, r := range list {
+			if r.Source == "" {
+				errs = append(errs, errors.New(r.Message))
+				continue
+			}
+			errs = append(errs, &systeminfo.CollectError{Source: r.Source, Op: r.Op, PID: r.PID, Mountpoint: r.Mountpoint, Err: errors.New(r.Message)})
+		}
+		if len(errs) == 1 {
+			out[key] = errs[0]
+		} else {
+			out[key] = errors.Join(errs...)
+		}
+	}
+	return out
+}
+
+// Reads samples back from a session file
+type Reader struct {
+	f      *os.File
+	r      *bufio.Reader
+	header Header
+}
+
+// Opens a session file and reads its header
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{f: f, r: bufio.NewReader(f)}
+	if err := r.readHeader(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *Reader) readHeader() error {
+	var fixed [8]byte
+	if _, err := io.ReadFull(r.r, fixed[:]); err != nil || string(fixed[:4]) != Magic {
+		return errors.New("not a syspulse recording")
+	}
+
+	n := binary.BigEndian.Uint32(fixed[4:])
+	if n > maxFrameSize {
+		return errors.New("corrupt recording header")
+	}
+	data := make([]byte, n+4)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return errors.New("corrupt recording header")
+	}
+	if crc32.ChecksumIEEE(data[:n]) != binary.BigEndian.Uint32(data[n:]) {
+		return errors.New("corrupt recording header")
+	}
+
+	if err := json.Unmarshal(data[:n], &r.header); err != nil {
+		return fmt.Errorf("corrupt recording header: %w", err)
+	}
+	if r.header.Version > Version {
+		return fmt.Errorf("recording version %d is newer than the supported one (%d)", r.header.Version, Version)
+	}
+	return nil
+}
+
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Returns the next sample, io.EOF at the end of the file
+// or ErrTruncated when the last frame is incomplete
+func (r *Reader) Next() (systeminfo.Snapshot, error) {
+	var fixed [8]byte
+	if _, err := io.ReadFull(r.r, fixed[:]); err != nil {
+		if err == io.EOF {
+			return systeminfo.Snapshot{}, io.EOF
+		}
+		return systeminfo.Snapshot{}, ErrTruncated
+	}
+
+	n := binary.BigEndian.Uint32(fixed[:4])
+	if n > maxFrameSize {
+		return systeminfo.Snapshot{}, ErrTruncated
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return systeminfo.Snapshot{}, ErrTruncated
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(fixed[4:]) {
+		return systeminfo.Snapshot{}, ErrTruncated
+	}
+
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(payload)))
+	if err != nil {
+		return systeminfo.Snapshot{}, ErrTruncated
+	}
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return systeminfo.Snapshot{}, ErrTruncated
+	}
+
+	s := rec.Snapshot
+	s.Errors = restoreErrors(rec.Errors)
+	return s, nil
+}
+
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+// Reads every sample of a session file
+// A truncated tail returns the samples read along with ErrTruncated
+func ReadAll(path string) (Header, []systeminfo.Snapshot, error) {
+	r, err := Open(path)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	defer r.Close()
+
+	var samples []systeminfo.Snapshot
+	for {
+		s, err := r.Next()
+		if err == io.EOF {
+			return r.header, samples, nil
+		}
+		if err != nil {
+			return r.header, samples, err
+		}
+		samples = append(samples, s)
+	}
+}
@@ -0,0 +1,266 @@
+package recording
+
+import (
+	"encoding/binary"
+	"errors"
+	"github/iegpeppino/syspulse/systeminfo"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Sample i of a test session, taken a second after the previous one
+func sample(i int) systeminfo.Snapshot {
+	return systeminfo.Snapshot{
+		Time:       t0.Add(time.Duration(i) * time.Second),
+		Host:       "web1",
+		CPUPercent: float64(i),
+		Processes: []systeminfo.ProcessInfo{
+			{PID: 42, Name: "postgres", CPU: 1.5, Memory: 1 << 20, Started: t0.Add(-time.Hour), Status: []string{"sleep"}},
+		},
+		ProcessCount: 1,
+		Sections:     []string{systeminfo.SectionCPU, systeminfo.SectionProcesses},
+	}
+}
+
+// Writes n samples to a new session file
+func writeSession(t *testing.T, path string, n int) {
+	t.Helper()
+	w, err := Create(path, Header{Host: "web1", Started: t0, Interval: "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := w.Write(sample(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.spr")
+	w, err := Create(path, Header{Host: "web1", Started: t0, Interval: "1s", Sections: []string{"cpu"}, Part: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withErrors := sample(1)
+	withErrors.Errors = map[string]error{
+		"disk": errors.Join(
+			&systeminfo.CollectError{Source: "disk", Op: "usage", Mountpoint: "/mnt", Err: errors.New("permission denied")},
+			&systeminfo.CollectError{Source: "disk", Op: "usage", Mountpoint: "/media", Err: errors.New("timeout")},
+		),
+		"process": &systeminfo.CollectError{Source: "process", Op: "name", PID: 7, Err: errors.New("gone")},
+	}
+	for _, s := range []systeminfo.Snapshot{sample(0), withErrors} {
+		if err := w.Write(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, samples, err := ReadAll(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHeader := Header{Version: Version, Host: "web1", Started: t0, Interval: "1s", Sections: []string{"cpu"}, Part: 1}
+	if !reflect.DeepEqual(h, wantHeader) {
+		t.Errorf("header = %+v, want %+v", h, wantHeader)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("read %d samples, want 2", len(samples))
+	}
+
+	got := samples[0]
+	want := sample(0)
+	if !got.Time.Equal(want.Time) || got.Host != want.Host || got.CPUPercent != want.CPUPercent || got.ProcessCount != want.ProcessCount {
+		t.Errorf("sample = %+v, want %+v", got, want)
+	}
+	if len(got.Processes) != 1 || got.Processes[0].Name != "postgres" || got.Processes[0].Memory != 1<<20 || !got.Processes[0].Started.Equal(want.Processes[0].Started) {
+		t.Errorf("processes = %+v, want %+v", got.Processes, want.Processes)
+	}
+	if len(got.Errors) != 0 {
+		t.Errorf("errors = %v, want none", got.Errors)
+	}
+
+	errs := samples[1].Errors
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v, want disk and process ones", errs)
+	}
+	if got, want := errs["disk"].Error(), withErrors.Errors["disk"].Error(); got != want {
+		t.Errorf("disk error = %q, want %q", got, want)
+	}
+	var ce *systeminfo.CollectError
+	if !errors.As(errs["process"], &ce) || ce.PID != 7 || ce.Op != "name" {
+		t.Errorf("process error = %#v, want a CollectError for pid 7", errs["process"])
+	}
+}
+
+func TestTruncatedTail(t *testing.T) {
+	tests := []struct {
+		name string
+		cut  func(data []byte) []byte
+	}{
+		{"partial frame", func(data []byte) []byte { return data[:len(data)-5] }},
+		{"partial frame header", func(data []byte) []byte { return data[:len(data)-lastFrameSize(t, data)+3] }},
+		{"corrupt frame", func(data []byte) []byte {
+			data[len(data)-1] ^= 0xff // Fails the CRC of the last frame
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.spr")
+			writeSession(t, path, 3)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.cut(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, samples, err := ReadAll(path)
+			if !errors.Is(err, ErrTruncated) {
+				t.Errorf("ReadAll() error = %v, want ErrTruncated", err)
+			}
+			if len(samples) != 2 || samples[1].CPUPercent != 1 {
+				t.Errorf("read %d samples, want the 2 before the cut", len(samples))
+			}
+		})
+	}
+}
+
+// Size of the last frame of a session file, read by walking its frames
+func lastFrameSize(t *testing.T, data []byte) int {
+	t.Helper()
+	pos, last := 8+int(binary.BigEndian.Uint32(data[4:]))+4, 0
+	for pos < len(data) {
+		last = 8 + int(binary.BigEndian.Uint32(data[pos:]))
+		pos += last
+	}
+	return last
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data func() []byte
+	}{
+		{"empty file", func() []byte { return nil }},
+		{"not a recording", func() []byte { return []byte("SPT1 something else entirely") }},
+		{"corrupt header", func() []byte {
+			path := filepath.Join(dir, "header.spr")
+			writeSession(t, path, 0)
+			data, _ := os.ReadFile(path)
+			data[10] ^= 0xff
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "bad.spr")
+			if err := os.WriteFile(path, tt.data(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if r, err := Open(path); err == nil {
+				r.Close()
+				t.Error("Open() returned no error")
+			}
+		})
+	}
+}
+
+func TestCreateDoesNotOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.spr")
+	writeSession(t, path, 2)
+	if w, err := Create(path, Header{}); err == nil {
+		w.Close()
+		t.Fatal("Create() over an existing recording returned no error")
+	}
+	if _, samples, err := ReadAll(path); err != nil || len(samples) != 2 {
+		t.Errorf("existing recording = %d samples, %v, want 2 samples", len(samples), err)
+	}
+}
+
+func TestRecorderRollover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.spr")
+	r, err := NewRecorder(Options{Path: path, Interval: time.Second, MaxDuration: 2 * time.Second, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if err := r.Record(sample(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Samples() != 6 {
+		t.Errorf("Samples() = %d, want 6", r.Samples())
+	}
+
+	// Parts of 2 seconds each, only the last 2 are kept
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("first part still exists (%v), want it pruned", err)
+	}
+	for part, want := range map[string][]float64{"session-2.spr": {2, 3}, "session-3.spr": {4, 5}} {
+		h, samples, err := ReadAll(filepath.Join(dir, part))
+		if err != nil {
+			t.Fatalf("%s: %v", part, err)
+		}
+		var got []float64
+		for _, s := range samples {
+			got = append(got, s.CPUPercent)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s samples = %v, want %v", part, got, want)
+		}
+		if !h.Started.Equal(samples[0].Time) {
+			t.Errorf("%s started at %v, want %v", part, h.Started, samples[0].Time)
+		}
+	}
+}
+
+func TestRecorderInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     string
+	}{
+		{"fixed", 2 * time.Second, "2s"},
+		// TUI sessions sample as fast as the collectors go
+		{"not fixed", 0, ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "session.spr")
+		r, err := NewRecorder(Options{Path: path, Interval: tt.interval})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Record(sample(0)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		h, _, err := ReadAll(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if h.Interval != tt.want {
+			t.Errorf("%s: header interval %q, want %q", tt.name, h.Interval, tt.want)
+		}
+	}
+}
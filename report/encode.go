@@ -0,0 +1,260 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats supported by Write
+var Formats = []string{"json", "yaml", "table"}
+
+// Writes the document in the given format
+func Write(w io.Writer, doc Document, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	case "yaml":
+		return writeYAML(w, doc)
+	case "table":
+		return writeTable(w, doc)
+	default:
+		return fmt.Errorf("unknown format %q (expected one of %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// Node of a decoded JSON document keeping the key order
+type node struct {
+	keys   []string
+	fields map[string]*node // Objects
+	items  []*node          // Arrays
+	scalar any              // Strings, numbers, booleans and null
+	kind   byte             // 'o'bject, 'a'rray or 's'calar
+}
+
+// Encodes v as YAML by way of its JSON encoding
+// so both formats always share field names and order
+func writeYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	root, err := decodeNode(dec)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	writeYAMLNode(&b, root, 0)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func decodeNode(dec *json.Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			n := &node{kind: 'o', fields: map[string]*node{}}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key := keyTok.(string)
+				child, err := decodeNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key)
+				n.fields[key] = child
+			}
+			_, err := dec.Token() // Closing brace
+			return n, err
+		}
+		n := &node{kind: 'a'}
+		for dec.More() {
+			child, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, child)
+		}
+		_, err := dec.Token() // Closing bracket
+		return n, err
+	default:
+		return &node{kind: 's', scalar: t}, nil
+	}
+}
+
+func writeYAMLNode(b *strings.Builder, n *node, indent int) {
+	pad := strings.Repeat("  ", indent)
+
+	switch n.kind {
+	case 'o':
+		for _, k := range n.keys {
+			child := n.fields[k]
+			if child.isEmpty() {
+				fmt.Fprintf(b, "%s%s: %s\n", pad, k, child.emptyValue())
+				continue
+			}
+			if child.kind == 's' {
+				fmt.Fprintf(b, "%s%s: %s\n", pad, k, yamlScalar(child.scalar))
+				continue
+			}
+			fmt.Fprintf(b, "%s%s:\n", pad, k)
+			writeYAMLNode(b, child, indent+1)
+		}
+	case 'a':
+		for _, item := range n.items {
+			if item.kind == 's' || item.isEmpty() {
+				value := item.emptyValue()
+				if item.kind == 's' {
+					value = yamlScalar(item.scalar)
+				}
+				fmt.Fprintf(b, "%s- %s\n", pad, value)
+				continue
+			}
+			// Render the first line of the item right after the dash
+			var sub strings.Builder
+			writeYAMLNode(&sub, item, indent+1)
+			lines := strings.SplitAfter(sub.String(), "\n")
+			fmt.Fprintf(b, "%s- %s", pad, strings.TrimPrefix(lines[0], pad+"  "))
+			for _, l := range lines[1:] {
+				b.WriteString(l)
+			}
+		}
+	default:
+		fmt.Fprintf(b, "%s%s\n", pad, yamlScalar(n.scalar))
+	}
+}
+
+func (n *node) isEmpty() bool {
+	return (n.kind == 'o' && len(n.keys) == 0) || (n.kind == 'a' && len(n.items) == 0)
+}
+
+func (n *node) emptyValue() string {
+	if n.kind == 'a' {
+		return "[]"
+	}
+	return "{}"
+}
+
+// Formats a scalar, quoting strings YAML would read as something else
+func yamlScalar(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return t.String()
+	case string:
+		if needsQuotes(t) {
+			return strconv.Quote(t)
+		}
+		return t
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func needsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	return strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.ContainsAny(s, "\n\t\\")
+}
+
+// Writes the document as aligned plain text tables
+func writeTable(w io.Writer, doc Document) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "HOST\t%s\n", doc.Host)
+	fmt.Fprintf(tw, "TIME\t%s\n", doc.Time.Format(time.RFC3339))
+	fmt.Fprintf(tw, "STATUS\t%s\n", doc.Status.Result)
+
+	if doc.CPU != nil {
+		t := doc.CPU.Times
+		fmt.Fprintln(tw, "\nCPU\tPERCENT")
+		fmt.Fprintf(tw, "total\t%.2f\n", doc.CPU.Percent)
+		for _, r := range []struct {
+			name  string
+			value float64
+		}{
+			{"user", t.User}, {"system", t.System}, {"idle", t.Idle}, {"nice", t.Nice}, {"iowait", t.Iowait},
+			{"irq", t.Irq}, {"softirq", t.Softirq}, {"steal", t.Steal}, {"guest", t.Guest},
+		} {
+			fmt.Fprintf(tw, "%s\t%.2f\n", r.name, r.value)
+		}
+	}
+
+	if doc.Memory != nil {
+		v := doc.Memory
+		fmt.Fprintln(tw, "\nMEMORY\tBYTES")
+		fmt.Fprintf(tw, "total\t%d\n", v.TotalBytes)
+		fmt.Fprintf(tw, "used\t%d\n", v.UsedBytes)
+		fmt.Fprintf(tw, "available\t%d\n", v.AvailableBytes)
+		fmt.Fprintf(tw, "free\t%d\n", v.FreeBytes)
+		fmt.Fprintf(tw, "buffers\t%d\n", v.BuffersBytes)
+		fmt.Fprintf(tw, "cached\t%d\n", v.CachedBytes)
+		fmt.Fprintf(tw, "used_percent\t%.2f\n", v.UsedPercent)
+		fmt.Fprintf(tw, "swap_total\t%d\n", v.SwapTotalBytes)
+		fmt.Fprintf(tw, "swap_used\t%d\n", v.SwapUsedBytes)
+		fmt.Fprintf(tw, "swap_free\t%d\n", v.SwapFreeBytes)
+		fmt.Fprintf(tw, "swap_used_percent\t%.2f\n", v.SwapUsedPercent)
+	}
+
+	if doc.Processes != nil {
+		fmt.Fprintf(tw, "\nPROCESSES\t%d\n", doc.ProcessCount)
+		fmt.Fprintln(tw, "\nPID\tNAME\tSTATUS\tCPU%\tRSS_BYTES\tRUNTIME_S")
+		for _, p := range doc.Processes {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%.2f\t%d\t%d\n", p.PID, p.Name, strings.Join(p.Status, ","), p.CPUPercent, p.RSSBytes, p.RuntimeSeconds)
+		}
+	}
+
+	if doc.Disks != nil {
+		fmt.Fprintln(tw, "\nMOUNTPOINT\tDEVICE\tFSTYPE\tTOTAL_BYTES\tUSED_BYTES\tFREE_BYTES\tUSED%")
+		for _, d := range doc.Disks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%.2f\n", d.Mountpoint, d.Device, d.Fstype, d.TotalBytes, d.UsedBytes, d.FreeBytes, d.UsedPercent)
+		}
+	}
+
+	if len(doc.Errors) > 0 {
+		fmt.Fprintln(tw, "\nSECTION\tOP\tTARGET\tCAUSE\tERROR")
+		for _, e := range doc.Errors {
+			target := e.Mountpoint
+			if e.PID != 0 {
+				target = fmt.Sprintf("pid %d", e.PID)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Section, e.Op, target, e.Cause, e.Message)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,231 @@
+package report
+
+import (
+	"errors"
+	"github/iegpeppino/syspulse/systeminfo"
+	"sort"
+	"time"
+)
+
+// Version of the document layout, increased on breaking changes
+const SchemaVersion = 1
+
+// Machine readable view of a snapshot
+// Sections that weren't collected are left out
+type Document struct {
+	SchemaVersion int        `json:"schema_version"`
+	Time          time.Time  `json:"time"`
+	Host          string     `json:"host"`
+	CPU           *CPU       `json:"cpu,omitempty"`
+	Memory        *Memory    `json:"memory,omitempty"`
+	ProcessCount  int        `json:"process_count,omitempty"`
+	Processes     []Process  `json:"processes,omitempty"`
+	Disks         []Disk     `json:"disks,omitempty"`
+	Errors        []Error    `json:"errors,omitempty"`
+	Status        StatusInfo `json:"status"`
+}
+
+type CPU struct {
+	Percent float64  `json:"percent"`
+	Times   CPUTimes `json:"times_percent"`
+}
+
+// Share of time spent on each mode, in percent
+type CPUTimes struct {
+	User    float64 `json:"user"`
+	System  float64 `json:"system"`
+	Idle    float64 `json:"idle"`
+	Nice    float64 `json:"nice"`
+	Iowait  float64 `json:"iowait"`
+	Irq     float64 `json:"irq"`
+	Softirq float64 `json:"softirq"`
+	Steal   float64 `json:"steal"`
+	Guest   float64 `json:"guest"`
+}
+
+type Memory struct {
+	TotalBytes     uint64  `json:"total_bytes"`
+	UsedBytes      uint64  `json:"used_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	FreeBytes      uint64  `json:"free_bytes"`
+	BuffersBytes   uint64  `json:"buffers_bytes"`
+	CachedBytes    uint64  `json:"cached_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+
+	SwapTotalBytes  uint64  `json:"swap_total_bytes"`
+	SwapUsedBytes   uint64  `json:"swap_used_bytes"`
+	SwapFreeBytes   uint64  `json:"swap_free_bytes"`
+	SwapUsedPercent float64 `json:"swap_used_percent"`
+}
+
+type Process struct {
+	PID            int32    `json:"pid"`
+	Name           string   `json:"name"`
+	Status         []string `json:"status"`
+	CPUPercent     float64  `json:"cpu_percent"`
+	RSSBytes       uint64   `json:"rss_bytes"`
+	RuntimeSeconds int64    `json:"runtime_seconds"`
+}
+
+type Disk struct {
+	Mountpoint  string  `json:"mountpoint"`
+	Device      string  `json:"device"`
+	Fstype      string  `json:"fstype"`
+	TotalBytes  uint64  `json:"total_bytes"`
+	UsedBytes   uint64  `json:"used_bytes"`
+	FreeBytes   uint64  `json:"free_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// Collector error, with the process or partition it concerns
+type Error struct {
+	Section    string `json:"section"`
+	Op         string `json:"op,omitempty"`
+	PID        int32  `json:"pid,omitempty"`
+	Mountpoint string `json:"mountpoint,omitempty"`
+	Cause      string `json:"cause,omitempty"`
+	Message    string `json:"message"`
+}
+
+// Outcome of the collection
+type Status string
+
+const (
+	StatusOK      Status = "ok"      // Every section collected without errors
+	StatusPartial Status = "partial" // Some errors or failed sections, but some data
+	StatusFailed  Status = "failed"  // No section could be collected
+)
+
+type StatusInfo struct {
+	Result         Status   `json:"result"`
+	FailedSections []string `json:"failed_sections,omitempty"`
+}
+
+// Builds the document for the given sections of a snapshot
+func FromSnapshot(s systeminfo.Snapshot, sections []string) Document {
+	doc := Document{
+		SchemaVersion: SchemaVersion,
+		Time:          s.Time,
+		Host:          s.Host,
+	}
+
+	for _, section := range sections {
+		switch section {
+		case systeminfo.SectionCPU:
+			t := s.CPUTimes
+			doc.CPU = &CPU{
+				Percent: s.CPUPercent,
+				Times: CPUTimes{
+					User: t.User, System: t.System, Idle: t.Idle, Nice: t.Nice, Iowait: t.Iowait,
+					Irq: t.Irq, Softirq: t.Softirq, Steal: t.Steal, Guest: t.Guest,
+				},
+			}
+		case systeminfo.SectionMemory:
+			v := s.Memory
+			doc.Memory = &Memory{
+				TotalBytes:     v.Total,
+				UsedBytes:      v.Used,
+				AvailableBytes: v.Available,
+				FreeBytes:      v.Free,
+				BuffersBytes:   v.Buffers,
+				CachedBytes:    v.Cached,
+				UsedPercent:    v.UsedPercent,
+
+				SwapTotalBytes:  s.Swap.Total,
+				SwapUsedBytes:   s.Swap.Used,
+				SwapFreeBytes:   s.Swap.Free,
+				SwapUsedPercent: s.Swap.UsedPercent,
+			}
+		case systeminfo.SectionProcesses:
+			doc.ProcessCount = s.ProcessCount
+			for _, p := range s.Processes {
+				proc := Process{
+					PID:        p.PID,
+					Name:       p.Name,
+					Status:     p.Status,
+					CPUPercent: p.CPU,
+					RSSBytes:   p.Memory,
+				}
+				if !p.Started.IsZero() {
+					proc.RuntimeSeconds = int64(s.Time.Sub(p.Started).Seconds())
+				}
+				doc.Processes = append(doc.Processes, proc)
+			}
+		case systeminfo.SectionDisks:
+			for _, d := range s.Disks {
+				disk := Disk{
+					Mountpoint: d.Partition.Mountpoint,
+					Device:     d.Partition.Device,
+					Fstype:     d.Partition.Fstype,
+					TotalBytes: d.Total,
+					UsedBytes:  d.Used,
+					FreeBytes:  d.Free,
+				}
+				if d.Total > 0 {
+					disk.UsedPercent = float64(d.Used) / float64(d.Total) * 100
+				}
+				doc.Disks = append(doc.Disks, disk)
+			}
+		}
+	}
+
+	doc.Errors, doc.Status = collectErrors(s, doc, sections)
+	return doc
+}
+
+// Lists the snapshot errors and works out the collection status
+func collectErrors(s systeminfo.Snapshot, doc Document, sections []string) ([]Error, StatusInfo) {
+	var errs []Error
+	failed := map[string]bool{}
+
+	keys := make([]string, 0, len(s.Errors))
+	for k := range s.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		section := systeminfo.ErrorSections[k]
+		for _, err := range systeminfo.SplitErrors(s.Errors[k]) {
+			e := Error{Section: section, Message: err.Error()}
+			var ce *systeminfo.CollectError
+			if errors.As(err, &ce) {
+				e.Op, e.PID, e.Mountpoint, e.Cause = ce.Op, ce.PID, ce.Mountpoint, ce.Cause()
+				e.Message = ce.Err.Error()
+			}
+			errs = append(errs, e)
+		}
+		if !hasData(section, doc) {
+			failed[section] = true
+		}
+	}
+
+	status := StatusInfo{Result: StatusOK}
+	if len(errs) > 0 {
+		status.Result = StatusPartial
+	}
+	for _, section := range sections {
+		if failed[section] {
+			status.FailedSections = append(status.FailedSections, section)
+		}
+	}
+	if len(sections) > 0 && len(status.FailedSections) == len(sections) {
+		status.Result = StatusFailed
+	}
+	return errs, status
+}
+
+// Reports whether a failing section still produced some data
+func hasData(section string, doc Document) bool {
+	switch section {
+	case systeminfo.SectionCPU:
+		return doc.CPU != nil && (doc.CPU.Percent > 0 || doc.CPU.Times != CPUTimes{})
+	case systeminfo.SectionMemory:
+		return doc.Memory != nil && doc.Memory.TotalBytes > 0
+	case systeminfo.SectionProcesses:
+		return len(doc.Processes) > 0
+	case systeminfo.SectionDisks:
+		return len(doc.Disks) > 0
+	}
+	return false
+}
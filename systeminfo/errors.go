@@ -0,0 +1,83 @@
+package systeminfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"syscall"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// Error raised while collecting a single stat
+// It keeps what was being read so errors can be
+// grouped and logged with structured attributes
+type CollectError struct {
+	Source     string // Collector: "cpu", "memory", "disk" or "process"
+	Op         string // Stat being read, e.g. "name" or "usage"
+	PID        int32  // Process ID, for process errors
+	Mountpoint string // Partition mountpoint, for disk errors
+	Err        error
+}
+
+func (e *CollectError) Error() string {
+	switch {
+	case e.PID != 0:
+		return fmt.Sprintf("%s %s (pid %d): %v", e.Source, e.Op, e.PID, e.Err)
+	case e.Mountpoint != "":
+		return fmt.Sprintf("%s %s (%s): %v", e.Source, e.Op, e.Mountpoint, e.Err)
+	default:
+		return fmt.Sprintf("%s %s: %v", e.Source, e.Op, e.Err)
+	}
+}
+
+func (e *CollectError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the class of the underlying failure
+// (permission, not_found, timeout or other)
+func (e *CollectError) Cause() string {
+	switch {
+	case errors.Is(e.Err, os.ErrPermission), errors.Is(e.Err, syscall.EACCES), errors.Is(e.Err, syscall.EPERM):
+		return "permission"
+	case errors.Is(e.Err, fs.ErrNotExist), errors.Is(e.Err, process.ErrorProcessNotRunning):
+		return "not_found"
+	case errors.Is(e.Err, context.DeadlineExceeded), errors.Is(e.Err, os.ErrDeadlineExceeded):
+		return "timeout"
+	default:
+		return "other"
+	}
+}
+
+// Returns the error details as log attributes
+func (e *CollectError) Attrs() []slog.Attr {
+	attrs := []slog.Attr{slog.String("op", e.Op)}
+	if e.PID != 0 {
+		attrs = append(attrs, slog.Int("pid", int(e.PID)))
+	}
+	if e.Mountpoint != "" {
+		attrs = append(attrs, slog.String("mountpoint", e.Mountpoint))
+	}
+	return append(attrs, slog.String("error", e.Err.Error()))
+}
+
+// Flattens errors joined with errors.Join, nested ones included
+// so a collector error holding many failures can be counted or
+// logged one by one
+func SplitErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, SplitErrors(e)...)
+		}
+		return errs
+	}
+	return []error{err}
+}
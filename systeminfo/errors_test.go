@@ -0,0 +1,35 @@
+package systeminfo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSplitErrors(t *testing.T) {
+	a, b, c := errors.New("a"), errors.New("b"), errors.New("c")
+	wrapped := fmt.Errorf("disk: %w", errors.Join(a, b))
+	tests := []struct {
+		name string
+		err  error
+		want []error
+	}{
+		{"nil", nil, nil},
+		{"single", a, []error{a}},
+		{"joined", errors.Join(a, b), []error{a, b}},
+		{"nested", errors.Join(a, errors.Join(b, c)), []error{a, b, c}},
+		{"wrapped join stays whole", wrapped, []error{wrapped}},
+	}
+	for _, tt := range tests {
+		got := SplitErrors(tt.err)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: SplitErrors() = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: SplitErrors()[%d] = %v, want %v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
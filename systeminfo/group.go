@@ -0,0 +1,41 @@
+package systeminfo
+
+import "sort"
+
+// Processes sharing a name, a user or a group rule, with their combined usage
+type ProcessGroup struct {
+	Name      string
+	Members   []ProcessSample
+	CPU       float64
+	RSS       uint64
+	ReadRate  float64 // Bytes per second
+	WriteRate float64 // Bytes per second
+}
+
+// Aggregates processes by the group key returns for each one, current
+// returns the latest CPU and I/O rates of a process, like the ones of
+// ProcessHistory.Latest. Groups come sorted by name
+func GroupProcesses(procs []ProcessSample, key func(ProcessSample) string, current func(ProcessSample) ProcessPoint) []ProcessGroup {
+	byName := map[string]*ProcessGroup{}
+	for _, p := range procs {
+		name := key(p)
+		g := byName[name]
+		if g == nil {
+			g = &ProcessGroup{Name: name}
+			byName[name] = g
+		}
+		pt := current(p)
+		g.Members = append(g.Members, p)
+		g.CPU += pt.CPU
+		g.RSS += p.RSS
+		g.ReadRate += pt.ReadRate
+		g.WriteRate += pt.WriteRate
+	}
+
+	groups := make([]ProcessGroup, 0, len(byName))
+	for _, g := range byName {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
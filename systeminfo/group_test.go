@@ -0,0 +1,94 @@
+package systeminfo
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestGroupProcesses(t *testing.T) {
+	procs := []ProcessSample{
+		{PID: 1, Name: "nginx", User: "www", Cmdline: "nginx: master", RSS: 10, CPU: 1},
+		{PID: 2, Name: "nginx", User: "www", Cmdline: "nginx: worker", RSS: 20, CPU: 1},
+		{PID: 3, Name: "postgres", User: "postgres", Cmdline: "postgres -D /data", RSS: 300, CPU: 1},
+		{PID: 4, Name: "nginx", User: "root", Cmdline: "nginx -t", RSS: 5, CPU: 1},
+		{PID: 5, Name: "bash", Cmdline: "-bash", RSS: 1, CPU: 4},
+	}
+	// Latest readings from the history, PID 5 isn't tracked yet
+	latest := map[int32]ProcessPoint{
+		1: {CPU: 2, ReadRate: 100},
+		2: {CPU: 10, ReadRate: 50, WriteRate: 10},
+		3: {CPU: 30, WriteRate: 1000},
+		4: {CPU: 0},
+	}
+	current := func(p ProcessSample) ProcessPoint {
+		if pt, ok := latest[p.PID]; ok {
+			return pt
+		}
+		return ProcessPoint{CPU: p.CPU}
+	}
+
+	rules := []Watch{
+		{Name: "web", Cmdline: regexp.MustCompile(`^nginx: `)},
+		{Name: "db", User: "postgres"},
+		{Name: "nginx", Process: "nginx"}, // Only gets what "web" left
+	}
+	byRule := func(p ProcessSample) string {
+		for _, r := range rules {
+			if r.Matches(p.PID, p.Name, p.Cmdline, p.User) {
+				return r.Name
+			}
+		}
+		return "other"
+	}
+
+	// Name, member PIDs, CPU, RSS, read and write rates of each group
+	type group struct {
+		name        string
+		pids        []int32
+		cpu         float64
+		rss         uint64
+		read, write float64
+	}
+	tests := []struct {
+		name  string
+		procs []ProcessSample
+		key   func(ProcessSample) string
+		want  []group
+	}{
+		{"by name", procs, func(p ProcessSample) string { return p.Name }, []group{
+			{"bash", []int32{5}, 4, 1, 0, 0},
+			{"nginx", []int32{1, 2, 4}, 12, 35, 150, 10},
+			{"postgres", []int32{3}, 30, 300, 0, 1000},
+		}},
+		{"by user", procs, func(p ProcessSample) string { return p.User }, []group{
+			{"", []int32{5}, 4, 1, 0, 0},
+			{"postgres", []int32{3}, 30, 300, 0, 1000},
+			{"root", []int32{4}, 0, 5, 0, 0},
+			{"www", []int32{1, 2}, 12, 30, 150, 10},
+		}},
+		{"by rule, first match wins", procs, byRule, []group{
+			{"db", []int32{3}, 30, 300, 0, 1000},
+			{"nginx", []int32{4}, 0, 5, 0, 0},
+			{"other", []int32{5}, 4, 1, 0, 0},
+			{"web", []int32{1, 2}, 12, 30, 150, 10},
+		}},
+		{"everything in one group", procs, func(ProcessSample) string { return "all" }, []group{
+			{"all", []int32{1, 2, 3, 4, 5}, 46, 336, 150, 1010},
+		}},
+		{"no processes", nil, func(p ProcessSample) string { return p.Name }, nil},
+	}
+	for _, tt := range tests {
+		var got []group
+		for _, g := range GroupProcesses(tt.procs, tt.key, current) {
+			var pids []int32
+			for _, p := range g.Members {
+				pids = append(pids, p.PID)
+			}
+			got = append(got, group{g.Name, pids, g.CPU, g.RSS, g.ReadRate, g.WriteRate})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: groups %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
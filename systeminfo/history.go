@@ -0,0 +1,181 @@
+package systeminfo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Value of a series at a point in time
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Bounded in-memory history of every metric series
+// Each series keeps its latest points in a ring buffer, so memory
+// use only grows with the points held
+type History struct {
+	mu       sync.RWMutex
+	capacity int           // Points kept per series
+	maxAge   time.Duration // Series not updated for this long are dropped
+	series   map[string]*ring
+	adds     int
+}
+
+// Bounded buffer of the latest points of a series, it grows up to
+// capacity and then overwrites its oldest point
+type ring struct {
+	points   []Point
+	capacity int
+	next     int // Slot written next once full
+	full     bool
+	last     time.Time
+}
+
+// How many samples go by between sweeps of stale series
+const historySweepEvery = 100
+
+// Creates a history keeping up to capacity points per series
+// A zero maxAge keeps series that stop being collected forever
+func NewHistory(capacity int, maxAge time.Duration) *History {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &History{capacity: capacity, maxAge: maxAge, series: map[string]*ring{}}
+}
+
+// Appends the metrics of a sample
+func (h *History) Add(t time.Time, metrics []Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, m := range metrics {
+		key := SeriesKey(m.Name, m.Labels)
+		r, ok := h.series[key]
+		if !ok {
+			r = &ring{capacity: h.capacity}
+			h.series[key] = r
+		}
+		r.add(Point{Time: t, Value: m.Value})
+	}
+
+	// Processes and filesystems come and go, drop their series once stale
+	h.adds++
+	if h.maxAge > 0 && h.adds%historySweepEvery == 0 {
+		for key, r := range h.series {
+			if t.Sub(r.last) > h.maxAge {
+				delete(h.series, key)
+			}
+		}
+	}
+}
+
+func (r *ring) add(p Point) {
+	r.last = p.Time
+	if !r.full {
+		// Series that come and go only hold the points they got
+		r.points = append(r.points, p)
+		r.full = len(r.points) == r.capacity
+		return
+	}
+	r.points[r.next] = p
+	r.next = (r.next + 1) % len(r.points)
+}
+
+// Points of a series between from and to (both included), oldest first
+func (h *History) Range(name string, labels map[string]string, from, to time.Time) []Point {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r, ok := h.series[SeriesKey(name, labels)]
+	if !ok {
+		return nil
+	}
+
+	var out []Point
+	start := 0
+	if r.full {
+		start = r.next
+	}
+	for i := range r.points {
+		p := r.points[(start+i)%len(r.points)]
+		if !p.Time.Before(from) && !p.Time.After(to) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Drops every point, used when the samples stop being consecutive
+func (h *History) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.series = map[string]*ring{}
+}
+
+// Number of series held
+func (h *History) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.series)
+}
+
+// Identifies a series: its name followed by its sorted labels,
+// like disk.used_percent{mountpoint="/"}
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
+
+// Minimum, average, maximum and percentiles of a set of points
+type Stats struct {
+	Min, Avg, Max float64
+	P95, P99      float64
+	Count         int
+}
+
+func Summarize(points []Point) Stats {
+	if len(points) == 0 {
+		return Stats{}
+	}
+	s := Stats{Min: math.Inf(1), Max: math.Inf(-1), Count: len(points)}
+	var sum float64
+	values := make([]float64, len(points))
+	for i, p := range points {
+		s.Min = math.Min(s.Min, p.Value)
+		s.Max = math.Max(s.Max, p.Value)
+		sum += p.Value
+		values[i] = p.Value
+	}
+	s.Avg = sum / float64(len(points))
+	s.P95 = Percentile(values, 95)
+	s.P99 = Percentile(values, 99) // Already sorted
+	return s
+}
+
+// Value below which a share p (0-100) of the values fall, using the
+// nearest rank method; values are sorted in place
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	return values[min(max(rank, 1), len(values))-1]
+}
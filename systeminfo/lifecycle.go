@@ -0,0 +1,214 @@
+package systeminfo
+
+import (
+	"sort"
+	"time"
+)
+
+// Kinds of process lifecycle event
+const (
+	ProcessStarted = "start"
+	ProcessExited  = "exit"
+)
+
+// Limits of the lifecycle tracking
+const (
+	maxProcessEvents = 2000             // Events kept, older ones are dropped first
+	restartGap       = time.Minute      // Longest time between an exit and the start taken as its restart
+	minRestarts      = 3                // Restarts within the window making a loop
+	processEventsAge = 60 * time.Minute // Events older than this are dropped
+)
+
+// Process seen starting or exiting between two samples
+// Processes living shorter than the collection interval go unseen
+type ProcessEvent struct {
+	Time    time.Time
+	Kind    string // ProcessStarted or ProcessExited
+	PID     int32
+	PPID    int32
+	Name    string
+	Cmdline string
+	Started time.Time
+
+	// Time from its start to the last sample it was seen in, 0 when unknown
+	Lifetime time.Duration
+
+	// Highest usage seen while it ran, its first reading on starts
+	PeakCPU float64
+	PeakRSS uint64
+}
+
+// Name whose processes keep exiting and starting again
+type RestartLoop struct {
+	Name     string
+	Restarts int       // Within the last RestartWindow
+	Last     time.Time // Latest restart
+}
+
+// Span restarts are counted over
+const RestartWindow = 5 * time.Minute
+
+// Identity of a process, the start time tells apart reused PIDs
+type processID struct {
+	pid     int32
+	started int64
+}
+
+// Process followed between samples
+type trackedProcess struct {
+	sample   ProcessSample
+	lastSeen time.Time
+	peakCPU  float64 // Highest CPU percent used between two samples
+	peakRSS  uint64
+}
+
+// Diffs consecutive process samples into start and exit events
+type ProcessTracker struct {
+	procs  map[processID]*trackedProcess
+	primed bool           // The first sample only sets what is running
+	events []ProcessEvent // Recent events, oldest first
+}
+
+func NewProcessTracker() *ProcessTracker {
+	return &ProcessTracker{procs: map[processID]*trackedProcess{}}
+}
+
+// Compares the processes of a sample with the previous one and
+// returns the processes that started and exited in between
+func (t *ProcessTracker) Diff(now time.Time, procs []ProcessSample) []ProcessEvent {
+	var events []ProcessEvent
+	seen := make(map[processID]bool, len(procs))
+	for _, p := range procs {
+		id := processID{p.PID, p.Started.Unix()}
+		seen[id] = true
+		tp := t.procs[id]
+		if tp == nil {
+			tp = &trackedProcess{}
+			t.procs[id] = tp
+			if t.primed {
+				events = append(events, ProcessEvent{
+					Time: now, Kind: ProcessStarted, PID: p.PID, PPID: p.PPID, Name: p.Name, Cmdline: p.Cmdline,
+					Started: p.Started, Lifetime: lifetime(p.Started, now), PeakCPU: p.CPU, PeakRSS: p.RSS,
+				})
+			}
+		}
+		// CPU since the previous sample, the lifetime average on the first one
+		cpu := Rated(tp.lastSeen, tp.sample, now, p).CPU
+		tp.sample, tp.lastSeen = p, now
+		tp.peakCPU = max(tp.peakCPU, cpu)
+		tp.peakRSS = max(tp.peakRSS, p.RSS)
+	}
+
+	for id, tp := range t.procs {
+		if seen[id] {
+			continue
+		}
+		p := tp.sample
+		events = append(events, ProcessEvent{
+			Time: now, Kind: ProcessExited, PID: p.PID, PPID: p.PPID, Name: p.Name, Cmdline: p.Cmdline,
+			Started: p.Started, Lifetime: lifetime(p.Started, tp.lastSeen), PeakCPU: tp.peakCPU, PeakRSS: tp.peakRSS,
+		})
+		delete(t.procs, id)
+	}
+	t.primed = true
+
+	// Exits first so a restart reads in order, then by PID
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Kind != events[j].Kind {
+			return events[i].Kind == ProcessExited
+		}
+		return events[i].PID < events[j].PID
+	})
+	t.events = append(t.events, events...)
+	cut := max(len(t.events)-maxProcessEvents, 0)
+	for cut < len(t.events) && now.Sub(t.events[cut].Time) > processEventsAge {
+		cut++
+	}
+	t.events = t.events[cut:]
+	return events
+}
+
+// Forgets every process and event
+func (t *ProcessTracker) Reset() {
+	t.procs = map[processID]*trackedProcess{}
+	t.primed = false
+	t.events = nil
+}
+
+// Recent events, oldest first
+func (t *ProcessTracker) Events() []ProcessEvent {
+	return t.events
+}
+
+// Number of processes started and exited in the span before now
+func (t *ProcessTracker) Counts(now time.Time, span time.Duration) (starts, exits int) {
+	for i := len(t.events) - 1; i >= 0 && now.Sub(t.events[i].Time) < span; i-- {
+		if t.events[i].Kind == ProcessStarted {
+			starts++
+		} else {
+			exits++
+		}
+	}
+	return starts, exits
+}
+
+// Names restarted at least 3 times within the RestartWindow before now,
+// most restarted first. A restart is a start following an exit of
+// the same name within a minute
+func (t *ProcessTracker) RestartLoops(now time.Time) []RestartLoop {
+	lastExit := map[string]time.Time{}
+	loops := map[string]*RestartLoop{}
+	for _, e := range t.events {
+		if now.Sub(e.Time) > RestartWindow {
+			continue
+		}
+		if e.Kind == ProcessExited {
+			lastExit[e.Name] = e.Time
+			continue
+		}
+		exited, ok := lastExit[e.Name]
+		if !ok || e.Time.Sub(exited) > restartGap {
+			continue
+		}
+		delete(lastExit, e.Name) // One restart per exit
+		l := loops[e.Name]
+		if l == nil {
+			l = &RestartLoop{Name: e.Name}
+			loops[e.Name] = l
+		}
+		l.Restarts++
+		l.Last = e.Time
+	}
+
+	var out []RestartLoop
+	for _, l := range loops {
+		if l.Restarts >= minRestarts {
+			out = append(out, *l)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Restarts != out[j].Restarts {
+			return out[i].Restarts > out[j].Restarts
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Start and exit rates over the last minute and the number of restart loops
+func (t *ProcessTracker) Metrics(now time.Time) []Metric {
+	starts, exits := t.Counts(now, time.Minute)
+	return []Metric{
+		{Name: "process.starts_per_minute", Value: float64(starts)},
+		{Name: "process.exits_per_minute", Value: float64(exits)},
+		{Name: "process.restart_loops", Value: float64(len(t.RestartLoops(now)))},
+	}
+}
+
+// How long a process lived until t, 0 when its start time is unknown
+func lifetime(started, t time.Time) time.Duration {
+	if started.IsZero() {
+		return 0
+	}
+	return max(t.Sub(started), 0)
+}
@@ -0,0 +1,127 @@
+package systeminfo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Process started an hour before t0
+func proc(pid int32, name string) ProcessSample {
+	return ProcessSample{PID: pid, Name: name, Started: t0.Add(-time.Hour)}
+}
+
+func TestProcessTrackerDiff(t *testing.T) {
+	restarted := proc(2, "worker")
+	restarted.Started = t0.Add(5 * time.Second)
+	unknown := proc(3, "zombie")
+	unknown.Started = time.Time{}
+
+	// Samples 10 seconds apart, the first one only primes the tracker
+	tests := []struct {
+		name    string
+		samples [][]ProcessSample
+		want    []string // Kind and name of the events of the last sample
+	}{
+		{"first sample", [][]ProcessSample{{proc(1, "init"), proc(2, "worker")}}, nil},
+		{"nothing changed", [][]ProcessSample{{proc(1, "init")}, {proc(1, "init")}}, nil},
+		{"start", [][]ProcessSample{{proc(1, "init")}, {proc(1, "init"), proc(2, "worker")}}, []string{"start worker"}},
+		{"exit", [][]ProcessSample{{proc(1, "init"), proc(2, "worker")}, {proc(1, "init")}}, []string{"exit worker"}},
+		// Same PID, new start time: exits come first
+		{"pid reused", [][]ProcessSample{{proc(2, "worker")}, {proc(1, "init"), restarted}}, []string{"exit worker", "start init", "start worker"}},
+		{"unknown start time", [][]ProcessSample{{unknown}, {unknown}}, nil},
+	}
+	for _, tt := range tests {
+		tr := NewProcessTracker()
+		var events []ProcessEvent
+		for i, s := range tt.samples {
+			events = tr.Diff(t0.Add(time.Duration(i)*10*time.Second), s)
+		}
+		var got []string
+		for _, e := range events {
+			got = append(got, e.Kind+" "+e.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessTrackerPeaks(t *testing.T) {
+	tr := NewProcessTracker()
+	worker := proc(2, "worker")
+	for i, usage := range []struct {
+		cpuTime float64
+		rss     uint64
+	}{{100, 10}, {105, 40}, {106, 20}} { // 50% then 10% over 10 seconds
+		worker.CPUTime, worker.RSS = usage.cpuTime, usage.rss
+		tr.Diff(t0.Add(time.Duration(i)*10*time.Second), []ProcessSample{worker})
+	}
+	events := tr.Diff(t0.Add(30*time.Second), nil)
+	if len(events) != 1 {
+		t.Fatalf("events %+v, want the worker exit", events)
+	}
+	e := events[0]
+	if e.PeakCPU != 50 || e.PeakRSS != 40 || e.Lifetime != time.Hour+20*time.Second {
+		t.Errorf("exit = peak CPU %v, peak RSS %v, lifetime %v, want 50, 40 and 1h0m20s", e.PeakCPU, e.PeakRSS, e.Lifetime)
+	}
+
+	// Unknown start times don't make up a lifetime
+	zombie := proc(3, "zombie")
+	zombie.Started = time.Time{}
+	tr.Diff(t0.Add(40*time.Second), []ProcessSample{zombie})
+	if events := tr.Diff(t0.Add(50*time.Second), nil); len(events) != 1 || events[0].Lifetime != 0 {
+		t.Errorf("exit of a process with no start time = %+v, want a zero lifetime", events)
+	}
+}
+
+func TestRestartLoops(t *testing.T) {
+	now := t0.Add(time.Hour)
+
+	// Restarts of name, each an exit followed by a start gap later,
+	// the last one ending at end
+	restarts := func(name string, n int, every, gap time.Duration, end time.Time) []ProcessEvent {
+		var events []ProcessEvent
+		for i := n - 1; i >= 0; i-- {
+			start := end.Add(-time.Duration(i) * every)
+			events = append(events,
+				ProcessEvent{Time: start.Add(-gap), Kind: ProcessExited, Name: name},
+				ProcessEvent{Time: start, Kind: ProcessStarted, Name: name})
+		}
+		return events
+	}
+
+	tests := []struct {
+		name   string
+		events []ProcessEvent
+		want   []RestartLoop
+	}{
+		{"loop", restarts("app", 3, time.Minute, 5*time.Second, now), []RestartLoop{{Name: "app", Restarts: 3, Last: now}}},
+		{"too few restarts", restarts("app", 2, time.Minute, 5*time.Second, now), nil},
+		{"slow restarts", restarts("app", 3, time.Minute, 2*time.Minute, now), nil},
+		{"outside the window", restarts("app", 3, time.Minute, 5*time.Second, now.Add(-10*time.Minute)), nil},
+		{"starts without exits", []ProcessEvent{
+			{Time: now.Add(-3 * time.Second), Kind: ProcessStarted, Name: "app"},
+			{Time: now.Add(-2 * time.Second), Kind: ProcessStarted, Name: "app"},
+			{Time: now.Add(-time.Second), Kind: ProcessStarted, Name: "app"},
+		}, nil},
+		// Ties are sorted by name
+		{"ties", append(restarts("b", 3, time.Minute, time.Second, now), restarts("a", 3, time.Minute, time.Second, now)...), []RestartLoop{
+			{Name: "a", Restarts: 3, Last: now},
+			{Name: "b", Restarts: 3, Last: now},
+		}},
+		{"most restarted first", append(restarts("a", 3, time.Minute, time.Second, now), restarts("b", 4, time.Minute, time.Second, now)...), []RestartLoop{
+			{Name: "b", Restarts: 4, Last: now},
+			{Name: "a", Restarts: 3, Last: now},
+		}},
+	}
+	for _, tt := range tests {
+		tr := NewProcessTracker()
+		tr.events = tt.events
+		if got := tr.RestartLoops(now); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: RestartLoops() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package systeminfo
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+)
+
+// Single numeric value of a snapshot identified by name and labels
+type Metric struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Kinds of metric
+const (
+	Gauge   = "gauge"   // Value that can go up and down
+	Counter = "counter" // Monotonically increasing total
+)
+
+// Description of a metric family
+type MetricInfo struct {
+	Type string // Gauge or Counter
+	Unit string // bytes, percent, seconds... or empty
+	Help string
+}
+
+// Description of every metric produced by Snapshot.Metrics
+var metricInfo = map[string]MetricInfo{
+	"cpu.percent":             {Gauge, "percent", "Total CPU usage."},
+	"cpu.time_percent":        {Gauge, "percent", "Share of CPU time spent in each mode since boot."},
+	"cpu.mode_percent":        {Gauge, "percent", "Share of CPU time spent in each mode since the previous sample."},
+	"memory.total_bytes":      {Gauge, "bytes", "Total physical memory."},
+	"memory.used_bytes":       {Gauge, "bytes", "Used physical memory."},
+	"memory.available_bytes":  {Gauge, "bytes", "Memory available for new processes without swapping."},
+	"memory.free_bytes":       {Gauge, "bytes", "Unused physical memory."},
+	"memory.buffers_bytes":    {Gauge, "bytes", "Memory used by kernel buffers."},
+	"memory.cached_bytes":     {Gauge, "bytes", "Memory used by the page cache."},
+	"memory.used_percent":     {Gauge, "percent", "Share of physical memory in use."},
+	"swap.total_bytes":        {Gauge, "bytes", "Total swap space."},
+	"swap.used_bytes":         {Gauge, "bytes", "Used swap space."},
+	"swap.free_bytes":         {Gauge, "bytes", "Free swap space."},
+	"swap.used_percent":       {Gauge, "percent", "Share of swap space in use."},
+	"swap.in_bytes_total":     {Counter, "bytes", "Bytes swapped in from disk since boot."},
+	"swap.out_bytes_total":    {Counter, "bytes", "Bytes swapped out to disk since boot."},
+	"disk.total_bytes":        {Gauge, "bytes", "Total size of the filesystem."},
+	"disk.used_bytes":         {Gauge, "bytes", "Used space of the filesystem."},
+	"disk.free_bytes":         {Gauge, "bytes", "Free space of the filesystem."},
+	"disk.used_percent":       {Gauge, "percent", "Share of the filesystem in use."},
+	"process.count":           {Gauge, "", "Number of running processes."},
+	"process.cpu_percent":     {Gauge, "percent", "CPU usage of the process."},
+	"process.rss_bytes":       {Gauge, "bytes", "Resident memory of the process."},
+	"process.runtime_seconds": {Gauge, "seconds", "Time since the process started."},
+	"collector.errors":        {Gauge, "", "Errors returned by each collector during the last collection."},
+
+	// Produced by ProcessTracker.Metrics
+	"process.starts_per_minute": {Gauge, "", "Processes started during the last minute."},
+	"process.exits_per_minute":  {Gauge, "", "Processes exited during the last minute."},
+	"process.restart_loops":     {Gauge, "", "Process names restarted at least 3 times within 5 minutes."},
+
+	// Produced by WatchMetrics
+	"watch.processes": {Gauge, "", "Running processes matching each watch list entry."},
+	"watch.missing":   {Gauge, "", "1 when no running process matches the watch list entry, 0 otherwise."},
+}
+
+// Returns the description of a metric family
+func DescribeMetric(name string) MetricInfo {
+	if info, ok := metricInfo[name]; ok {
+		return info
+	}
+	return MetricInfo{Type: Gauge}
+}
+
+// Registers the description of a metric produced outside of Snapshot.Metrics
+func RegisterMetric(name string, info MetricInfo) {
+	metricInfo[name] = info
+}
+
+// One metric per CPU mode, labeled with it
+func cpuModeMetrics(name string, t cpu.TimesStat) []Metric {
+	cpuModes := []struct {
+		mode  string
+		value float64
+	}{
+		{"user", t.User},
+		{"system", t.System},
+		{"idle", t.Idle},
+		{"nice", t.Nice},
+		{"iowait", t.Iowait},
+		{"irq", t.Irq},
+		{"softirq", t.Softirq},
+		{"steal", t.Steal},
+		{"guest", t.Guest},
+	}
+	metrics := make([]Metric, 0, len(cpuModes))
+	for _, c := range cpuModes {
+		metrics = append(metrics, Metric{Name: name, Labels: map[string]string{"mode": c.mode}, Value: c.value})
+	}
+	return metrics
+}
+
+// Reports whether the snapshot holds the given section
+func (s Snapshot) Has(section string) bool {
+	return s.Sections == nil || slices.Contains(s.Sections, section)
+}
+
+// Flattens the snapshot into named metrics
+// used by alert rules and exporters
+func (s Snapshot) Metrics() []Metric {
+	var metrics []Metric
+
+	if s.Has(SectionCPU) {
+		metrics = append(metrics, Metric{Name: "cpu.percent", Value: s.CPUPercent})
+
+		metrics = append(metrics, cpuModeMetrics("cpu.time_percent", s.CPUTimes)...)
+		// Missing from recordings made before it was collected
+		if s.CPUModes != (cpu.TimesStat{}) {
+			metrics = append(metrics, cpuModeMetrics("cpu.mode_percent", s.CPUModes)...)
+		}
+	}
+
+	if s.Has(SectionMemory) {
+		metrics = append(metrics,
+			Metric{Name: "memory.total_bytes", Value: float64(s.Memory.Total)},
+			Metric{Name: "memory.used_bytes", Value: float64(s.Memory.Used)},
+			Metric{Name: "memory.available_bytes", Value: float64(s.Memory.Available)},
+			Metric{Name: "memory.free_bytes", Value: float64(s.Memory.Free)},
+			Metric{Name: "memory.buffers_bytes", Value: float64(s.Memory.Buffers)},
+			Metric{Name: "memory.cached_bytes", Value: float64(s.Memory.Cached)},
+			Metric{Name: "memory.used_percent", Value: s.Memory.UsedPercent},
+			Metric{Name: "swap.total_bytes", Value: float64(s.Swap.Total)},
+			Metric{Name: "swap.used_bytes", Value: float64(s.Swap.Used)},
+			Metric{Name: "swap.free_bytes", Value: float64(s.Swap.Free)},
+			Metric{Name: "swap.used_percent", Value: s.Swap.UsedPercent},
+			Metric{Name: "swap.in_bytes_total", Value: float64(s.Swap.Sin)},
+			Metric{Name: "swap.out_bytes_total", Value: float64(s.Swap.Sout)},
+		)
+	}
+
+	// Recordings made before disks were deduplicated may repeat mountpoints
+	for _, d := range uniqueDisks(s.Disks) {
+		labels := map[string]string{
+			"mountpoint": d.Partition.Mountpoint,
+			"fstype":     d.Partition.Fstype,
+		}
+		metrics = append(metrics,
+			Metric{Name: "disk.total_bytes", Labels: labels, Value: float64(d.Total)},
+			Metric{Name: "disk.used_bytes", Labels: labels, Value: float64(d.Used)},
+			Metric{Name: "disk.free_bytes", Labels: labels, Value: float64(d.Free)},
+		)
+		if d.Total > 0 {
+			metrics = append(metrics, Metric{Name: "disk.used_percent", Labels: labels, Value: float64(d.Used) / float64(d.Total) * 100})
+		}
+	}
+
+	if s.Has(SectionProcesses) {
+		metrics = append(metrics, Metric{Name: "process.count", Value: float64(s.ProcessCount)})
+	}
+	for _, p := range s.Processes {
+		labels := map[string]string{
+			"pid":  strconv.Itoa(int(p.PID)),
+			"name": p.Name,
+		}
+		metrics = append(metrics,
+			Metric{Name: "process.cpu_percent", Labels: labels, Value: p.CPU},
+			Metric{Name: "process.rss_bytes", Labels: labels, Value: float64(p.Memory)},
+		)
+		if !p.Started.IsZero() {
+			metrics = append(metrics, Metric{Name: "process.runtime_seconds", Labels: labels, Value: s.Time.Sub(p.Started).Seconds()})
+		}
+	}
+
+	// Error count per collected section, 0 when it went fine
+	errCount := map[string]int{}
+	for key, err := range s.Errors {
+		errCount[ErrorSections[key]] += len(SplitErrors(err))
+	}
+	for _, section := range Sections {
+		if s.Has(section) {
+			metrics = append(metrics, Metric{Name: "collector.errors", Labels: map[string]string{"section": section}, Value: float64(errCount[section])})
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,176 @@
+package systeminfo
+
+import (
+	"slices"
+	"time"
+)
+
+// Limits of the per-process history
+const (
+	maxProcessPoints = 300              // Readings kept per process
+	firstProcessStep = 2 * time.Second  // Spacing of the readings until the history fills up
+	exitedKept       = 10 * time.Minute // How long the history of an exited process is kept
+)
+
+// Reading of a process kept in its history
+type ProcessPoint struct {
+	Time      time.Time
+	CPU       float64 // Percent used since the previous reading
+	RSS       uint64
+	Threads   int32
+	ReadRate  float64 // Bytes per second read since the previous reading
+	WriteRate float64 // Bytes per second written since the previous reading
+}
+
+// History of a process since it was first seen
+// When it fills up every pair of readings is merged into one, so it
+// always spans the whole time observed at a coarser resolution
+type ProcessTrace struct {
+	PID       int32
+	PPID      int32
+	Name      string
+	Cmdline   string
+	Started   time.Time
+	FirstSeen time.Time
+	Exited    time.Time      // Zero while running
+	Points    []ProcessPoint // Oldest first
+	Peak      ProcessPoint   // Highest of each value read, Time unused
+	Latest    ProcessPoint   // Latest reading, rated since the one before, kept or not
+
+	step   time.Duration // Least time between readings
+	last   ProcessSample // Counters at the latest reading kept
+	latest ProcessSample // Counters at the latest reading
+}
+
+// Keeps a bounded history of every running process
+type ProcessHistory struct {
+	procs map[processID]*ProcessTrace
+}
+
+func NewProcessHistory() *ProcessHistory {
+	return &ProcessHistory{procs: map[processID]*ProcessTrace{}}
+}
+
+// Adds the processes of a sample
+// Processes missing from it are marked as exited and dropped later
+func (h *ProcessHistory) Observe(t time.Time, procs []ProcessSample) {
+	seen := make(map[processID]bool, len(procs))
+	for _, p := range procs {
+		id := processID{p.PID, p.Started.Unix()}
+		seen[id] = true
+		tr := h.procs[id]
+		if tr == nil {
+			tr = &ProcessTrace{PID: p.PID, Started: p.Started, FirstSeen: t, step: firstProcessStep}
+			h.procs[id] = tr
+		}
+		tr.Exited = time.Time{} // Back in the list, e.g. the top processes of a recording
+		tr.add(t, p)
+	}
+
+	for id, tr := range h.procs {
+		switch {
+		case seen[id]:
+		case tr.Exited.IsZero():
+			tr.Exited = t
+		case t.Sub(tr.Exited) > exitedKept:
+			delete(h.procs, id)
+		}
+	}
+}
+
+// Adds a reading, unless the previous one is too recent
+func (tr *ProcessTrace) add(t time.Time, p ProcessSample) {
+	tr.PPID, tr.Name, tr.Cmdline = p.PPID, p.Name, p.Cmdline
+
+	tr.Latest, tr.latest = Rated(tr.Latest.Time, tr.latest, t, p), p
+
+	var prev time.Time
+	if n := len(tr.Points); n > 0 {
+		prev = tr.Points[n-1].Time
+		if t.Sub(prev) < tr.step {
+			return
+		}
+	}
+	pt := Rated(prev, tr.last, t, p)
+	tr.last = p
+
+	tr.Peak.CPU = max(tr.Peak.CPU, pt.CPU)
+	tr.Peak.RSS = max(tr.Peak.RSS, pt.RSS)
+	tr.Peak.Threads = max(tr.Peak.Threads, pt.Threads)
+	tr.Peak.ReadRate = max(tr.Peak.ReadRate, pt.ReadRate)
+	tr.Peak.WriteRate = max(tr.Peak.WriteRate, pt.WriteRate)
+
+	tr.Points = append(tr.Points, pt)
+	if len(tr.Points) >= maxProcessPoints {
+		tr.compact()
+	}
+}
+
+// Reading of a process with its rates since a previous one, the first
+// reading (zero prevTime) has no I/O rates and its lifetime CPU average
+// Counters going back (or unreadable ones) leave I/O at 0 and the CPU
+// at its lifetime average
+func Rated(prevTime time.Time, prev ProcessSample, t time.Time, p ProcessSample) ProcessPoint {
+	pt := ProcessPoint{Time: t, CPU: p.CPU, RSS: p.RSS, Threads: p.Threads}
+	if prevTime.IsZero() || !t.After(prevTime) {
+		return pt
+	}
+	dt := t.Sub(prevTime).Seconds()
+	if p.CPUTime > 0 && p.CPUTime >= prev.CPUTime {
+		pt.CPU = 100 * (p.CPUTime - prev.CPUTime) / dt
+	}
+	if p.ReadBytes >= prev.ReadBytes && prev.ReadBytes > 0 {
+		pt.ReadRate = float64(p.ReadBytes-prev.ReadBytes) / dt
+	}
+	if p.WriteBytes >= prev.WriteBytes && prev.WriteBytes > 0 {
+		pt.WriteRate = float64(p.WriteBytes-prev.WriteBytes) / dt
+	}
+	return pt
+}
+
+// Merges every pair of readings into their average, halving the
+// resolution of the history
+func (tr *ProcessTrace) compact() {
+	merged := tr.Points[:0]
+	for i := 0; i+1 < len(tr.Points); i += 2 {
+		a, b := tr.Points[i], tr.Points[i+1]
+		merged = append(merged, ProcessPoint{
+			Time:      a.Time,
+			CPU:       (a.CPU + b.CPU) / 2,
+			RSS:       a.RSS/2 + b.RSS/2 + (a.RSS%2+b.RSS%2)/2, // No overflow, nor a byte lost per merge
+			Threads:   (a.Threads + b.Threads) / 2,
+			ReadRate:  (a.ReadRate + b.ReadRate) / 2,
+			WriteRate: (a.WriteRate + b.WriteRate) / 2,
+		})
+	}
+	if len(tr.Points)%2 == 1 {
+		merged = append(merged, tr.Points[len(tr.Points)-1])
+	}
+	tr.Points = merged
+	tr.step *= 2
+}
+
+// History of a process, false when it isn't tracked
+func (h *ProcessHistory) Trace(pid int32, started time.Time) (ProcessTrace, bool) {
+	tr, ok := h.procs[processID{pid, started.Unix()}]
+	if !ok {
+		return ProcessTrace{}, false
+	}
+	out := *tr
+	out.Points = slices.Clone(tr.Points)
+	return out, true
+}
+
+// Latest reading of a process, false when it isn't tracked
+func (h *ProcessHistory) Latest(pid int32, started time.Time) (ProcessPoint, bool) {
+	tr, ok := h.procs[processID{pid, started.Unix()}]
+	if !ok {
+		return ProcessPoint{}, false
+	}
+	return tr.Latest, true
+}
+
+// Forgets every process, e.g. when a replay seeks
+func (h *ProcessHistory) Reset() {
+	h.procs = map[processID]*ProcessTrace{}
+}
@@ -0,0 +1,120 @@
+package systeminfo
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Readings a second apart from t0 with the given CPU and RSS
+func points(values ...float64) []ProcessPoint {
+	pts := make([]ProcessPoint, len(values))
+	for i, v := range values {
+		pts[i] = ProcessPoint{Time: t0.Add(time.Duration(i) * time.Second), CPU: v, RSS: uint64(v)}
+	}
+	return pts
+}
+
+func TestProcessTraceCompact(t *testing.T) {
+	big := ProcessPoint{Time: t0, RSS: math.MaxUint64}
+	tests := []struct {
+		name   string
+		points []ProcessPoint
+		want   []ProcessPoint
+	}{
+		{"even", points(10, 20, 30, 50), []ProcessPoint{
+			{Time: t0, CPU: 15, RSS: 15},
+			{Time: t0.Add(2 * time.Second), CPU: 40, RSS: 40},
+		}},
+		// The last reading is kept as is
+		{"odd", points(10, 20, 30), []ProcessPoint{
+			{Time: t0, CPU: 15, RSS: 15},
+			{Time: t0.Add(2 * time.Second), CPU: 30, RSS: 30},
+		}},
+		{"single", points(10), points(10)},
+		{"flat", points(7, 7, 7, 7), []ProcessPoint{
+			{Time: t0, CPU: 7, RSS: 7},
+			{Time: t0.Add(2 * time.Second), CPU: 7, RSS: 7},
+		}},
+		// Huge values don't overflow
+		{"huge RSS", []ProcessPoint{big, big}, []ProcessPoint{{Time: t0, RSS: math.MaxUint64}}},
+		{"odd RSS", []ProcessPoint{{Time: t0, RSS: 3}, {Time: t0.Add(time.Second), RSS: 4}}, []ProcessPoint{{Time: t0, RSS: 3}}},
+		{"rates and threads", []ProcessPoint{
+			{Time: t0, Threads: 4, ReadRate: 100, WriteRate: 10},
+			{Time: t0.Add(time.Second), Threads: 6, ReadRate: 300, WriteRate: 0},
+		}, []ProcessPoint{{Time: t0, Threads: 5, ReadRate: 200, WriteRate: 5}}},
+	}
+	for _, tt := range tests {
+		tr := &ProcessTrace{Points: tt.points, step: time.Second}
+		tr.compact()
+		if !reflect.DeepEqual(tr.Points, tt.want) {
+			t.Errorf("%s: compacted to %+v, want %+v", tt.name, tr.Points, tt.want)
+		}
+		if tr.step != 2*time.Second {
+			t.Errorf("%s: step %v after compacting, want 2s", tt.name, tr.step)
+		}
+	}
+}
+
+func TestRated(t *testing.T) {
+	prev := ProcessSample{CPU: 3, CPUTime: 100, ReadBytes: 1000, WriteBytes: 500}
+	tests := []struct {
+		name     string
+		prevTime time.Time
+		p        ProcessSample
+		want     ProcessPoint
+	}{
+		{"first reading", time.Time{}, ProcessSample{CPU: 3, CPUTime: 100, ReadBytes: 1000}, ProcessPoint{CPU: 3}},
+		{"interval", t0, ProcessSample{CPU: 3, CPUTime: 105, ReadBytes: 3000, WriteBytes: 500}, ProcessPoint{CPU: 50, ReadRate: 200}},
+		{"idle", t0, ProcessSample{CPU: 3, CPUTime: 100, ReadBytes: 1000, WriteBytes: 500}, ProcessPoint{}},
+		// Counters going back fall back to the lifetime average and no I/O
+		{"counters reset", t0, ProcessSample{CPU: 3, CPUTime: 1, ReadBytes: 10, WriteBytes: 5}, ProcessPoint{CPU: 3}},
+		{"unreadable counters", t0, ProcessSample{CPU: 3}, ProcessPoint{CPU: 3}},
+		{"same time", t0.Add(10 * time.Second), ProcessSample{CPU: 3, CPUTime: 105}, ProcessPoint{CPU: 3}},
+	}
+	for _, tt := range tests {
+		got := Rated(tt.prevTime, prev, t0.Add(10*time.Second), tt.p)
+		tt.want.Time = t0.Add(10 * time.Second)
+		if got != tt.want {
+			t.Errorf("%s: Rated() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessHistoryBounded(t *testing.T) {
+	h := NewProcessHistory()
+	p := proc(1, "app")
+	const readings = 2000
+	for i := 0; i < readings; i++ {
+		p.CPUTime = float64(i)
+		h.Observe(t0.Add(time.Duration(i)*firstProcessStep), []ProcessSample{p})
+	}
+
+	tr, ok := h.Trace(1, p.Started)
+	if !ok {
+		t.Fatal("process isn't tracked")
+	}
+	if n := len(tr.Points); n == 0 || n >= maxProcessPoints {
+		t.Errorf("history holds %d readings, want fewer than %d", n, maxProcessPoints)
+	}
+	// Still spanning the whole time observed
+	last := t0.Add((readings - 1) * firstProcessStep)
+	if !tr.Points[0].Time.Equal(t0) || last.Sub(tr.Points[len(tr.Points)-1].Time) > tr.step {
+		t.Errorf("history spans %v to %v, want %v to about %v", tr.Points[0].Time, tr.Points[len(tr.Points)-1].Time, t0, last)
+	}
+	// 1 second of CPU every 2 seconds
+	if tr.Latest.CPU != 50 || tr.Peak.CPU != 50 {
+		t.Errorf("latest CPU %v, peak %v, want 50", tr.Latest.CPU, tr.Peak.CPU)
+	}
+
+	// Exited processes are kept for a while, then forgotten
+	h.Observe(last.Add(time.Second), nil)
+	if tr, ok := h.Trace(1, p.Started); !ok || tr.Exited.IsZero() {
+		t.Errorf("exited process = %+v, %v, want it kept and marked as exited", tr.Exited, ok)
+	}
+	h.Observe(last.Add(exitedKept+time.Minute), nil)
+	if _, ok := h.Trace(1, p.Started); ok {
+		t.Error("exited process still tracked after exitedKept")
+	}
+}
@@ -0,0 +1,165 @@
+package systeminfo
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/mem"
+)
+
+// Every stat gathered in one pass of the collectors
+type Snapshot struct {
+	Time         time.Time
+	Host         string
+	CPUPercent   float64
+	CPUTimes     cpu.TimesStat // Share of CPU time in each mode since boot
+	CPUModes     cpu.TimesStat // Same, since the previous sample
+	Memory       mem.VirtualMemoryStat
+	Swap         mem.SwapMemoryStat
+	Disks        []DiskInfo
+	Processes    []ProcessInfo
+	Pinned       int      // Watched processes listed first in Processes, whatever their usage
+	ProcessCount int      // Running processes, including the ones left out of Processes
+	Sections     []string // Sections collected
+
+	// Every running process, used to spot leaks and processes
+	// starting and exiting. Left out of recordings to keep them small
+	AllProcesses []ProcessSample `json:"-"`
+
+	// Errors returned by the collectors, as *CollectError
+	// or joined CollectErrors (see CollectError.Source)
+	Errors map[string]error `json:"-"`
+}
+
+// Names of the collector groups that can be selected
+const (
+	SectionCPU       = "cpu"
+	SectionMemory    = "memory"
+	SectionProcesses = "processes"
+	SectionDisks     = "disks"
+)
+
+// Every section, in display order
+var Sections = []string{SectionCPU, SectionMemory, SectionProcesses, SectionDisks}
+
+// Section each Snapshot.Errors key belongs to
+var ErrorSections = map[string]string{
+	"cpu_percent": SectionCPU,
+	"cpu_times":   SectionCPU,
+	"memory":      SectionMemory,
+	"swap":        SectionMemory,
+	"process":     SectionProcesses,
+	"disk":        SectionDisks,
+}
+
+// Collection settings
+type CollectOptions struct {
+	TopProcesses int             // Number of processes kept
+	SortBy       string          // Usage the top processes are picked by, SortCPU when empty
+	Pinned       []Watch         // Processes kept ahead of the top ones
+	Sections     map[string]bool // Sections to collect, all of them when nil
+}
+
+// Usages the top processes can be picked by
+const (
+	SortCPU    = "cpu"
+	SortMemory = "memory"
+)
+
+// Reports whether the section has to be collected
+func (o CollectOptions) Wants(section string) bool {
+	return o.Sections == nil || o.Sections[section]
+}
+
+// Runs every collector once
+// Failing collectors leave their fields empty and record their error
+func Collect(opts CollectOptions) Snapshot {
+	s := Snapshot{
+		Time:   time.Now(),
+		Errors: map[string]error{},
+	}
+	s.Host, _ = os.Hostname()
+
+	record := func(source string, err error) {
+		if err != nil {
+			s.Errors[source] = err
+		}
+	}
+
+	for _, section := range Sections {
+		if opts.Wants(section) {
+			s.Sections = append(s.Sections, section)
+		}
+	}
+
+	var err error
+	if opts.Wants(SectionCPU) {
+		s.CPUPercent, err = GetCPUPercent()
+		record("cpu_percent", err)
+
+		s.CPUModes, s.CPUTimes, err = GetCPUModes()
+		record("cpu_times", err)
+	}
+
+	if opts.Wants(SectionMemory) {
+		memory, err := GetMEMLoad()
+		record("memory", err)
+		s.Memory = *memory
+
+		swap, err := GetSWAPUse()
+		record("swap", err)
+		s.Swap = *swap
+	}
+
+	if opts.Wants(SectionProcesses) {
+		all, err := GetProcessInfo(0)
+		record("process", err)
+		s.ProcessCount = len(all)
+		s.AllProcesses = make([]ProcessSample, len(all))
+		for i, p := range all {
+			s.AllProcesses[i] = p.Sample()
+		}
+		SortProcesses(all, opts.SortBy)
+		s.Processes, s.Pinned = pinProcesses(all, opts.Pinned, opts.TopProcesses)
+	}
+
+	if opts.Wants(SectionDisks) {
+		s.Disks, err = GetDISKUse()
+		record("disk", err)
+	}
+
+	return s
+}
+
+// Sorts processes by CPU (the order GetProcessInfo returns) or resident memory, highest first
+func SortProcesses(procs []ProcessInfo, by string) {
+	if by == SortMemory {
+		sort.SliceStable(procs, func(i, j int) bool { return procs[i].Memory > procs[j].Memory })
+		return
+	}
+	sort.SliceStable(procs, func(i, j int) bool { return procs[i].CPU > procs[j].CPU })
+}
+
+// Lists the watched processes first, followed by the top ones
+func pinProcesses(all []ProcessInfo, watches []Watch, top int) ([]ProcessInfo, int) {
+	if len(watches) == 0 {
+		if top > 0 && len(all) > top {
+			all = all[:top]
+		}
+		return all, 0
+	}
+	var pinned, rest []ProcessInfo
+	for _, p := range all {
+		if Watched(watches, p) {
+			pinned = append(pinned, p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	if top > 0 && len(rest) > top {
+		rest = rest[:top]
+	}
+	return append(pinned, rest...), len(pinned)
+}
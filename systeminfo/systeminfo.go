@@ -3,7 +3,10 @@ package systeminfo
 import (
 	"errors"
 	"fmt"
+	"os/user"
 	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/cpu"
@@ -28,40 +31,80 @@ func GetCPUinfo() (cpu.InfoStat, error) {
 func GetCPUPercent() (float64, error) {
 	cpuPercentage, err := cpu.Percent(1*time.Second, false)
 	if err != nil {
-		return 0.0, err
+		return 0.0, &CollectError{Source: "cpu", Op: "percent", Err: err}
 	}
 
 	return cpuPercentage[0], nil
 }
 
 // Return Cpu Loads
+// as the share of CPU time spent in each mode since boot
 func GetCPULoad() ([]cpu.TimesStat, error) {
 
 	cpuLoad, err := cpu.Times(false)
 	if err != nil {
-		return []cpu.TimesStat{}, err
+		return []cpu.TimesStat{}, &CollectError{Source: "cpu", Op: "times", Err: err}
 	}
 
-	currLoad := cpuLoad[0]
+	cpuLoad[0] = CPUShares(cpuLoad[0], cpu.TimesStat{})
+	return cpuLoad, nil
 
-	// Calculate total CPU load
-	totalLoad := currLoad.Guest + currLoad.Idle + currLoad.Iowait + currLoad.Irq +
-		currLoad.Nice + currLoad.Softirq + currLoad.Steal + currLoad.System + currLoad.User
+}
 
-	// Convert loads to percentual values using totalLoad
-	currLoad.Guest = (currLoad.Guest / totalLoad) * 100
-	currLoad.Idle = (currLoad.Idle / totalLoad) * 100
-	currLoad.Iowait = (currLoad.Iowait / totalLoad) * 100
-	currLoad.Irq = (currLoad.Irq / totalLoad) * 100
-	currLoad.Nice = (currLoad.Nice / totalLoad) * 100
-	currLoad.Softirq = (currLoad.Softirq / totalLoad) * 100
-	currLoad.Steal = (currLoad.Steal / totalLoad) * 100
-	currLoad.System = (currLoad.System / totalLoad) * 100
-	currLoad.User = (currLoad.User / totalLoad) * 100
+// CPU times read by the previous GetCPUModes call
+var (
+	lastCPUTimes   cpu.TimesStat
+	lastCPUTimesMu sync.Mutex
+)
 
-	cpuLoad[0] = currLoad
-	return cpuLoad, nil
+// Returns the share of CPU time spent in each mode since the previous
+// call (since boot on the first one), along with the share since boot
+func GetCPUModes() (interval, sinceBoot cpu.TimesStat, err error) {
+	times, err := cpu.Times(false)
+	if err != nil {
+		return interval, sinceBoot, &CollectError{Source: "cpu", Op: "times", Err: err}
+	}
+
+	lastCPUTimesMu.Lock()
+	prev := lastCPUTimes
+	lastCPUTimes = times[0]
+	lastCPUTimesMu.Unlock()
 
+	return CPUShares(times[0], prev), CPUShares(times[0], cpu.TimesStat{}), nil
+}
+
+// Converts the CPU time spent in each mode between prev and now into
+// percentages of the total. Counters going backwards (e.g. a prev from
+// another boot) are read from zero
+func CPUShares(now, prev cpu.TimesStat) cpu.TimesStat {
+	if cpuTotal(now) < cpuTotal(prev) {
+		prev = cpu.TimesStat{}
+	}
+	d := cpu.TimesStat{
+		CPU:     now.CPU,
+		User:    max(now.User-prev.User, 0),
+		System:  max(now.System-prev.System, 0),
+		Idle:    max(now.Idle-prev.Idle, 0),
+		Nice:    max(now.Nice-prev.Nice, 0),
+		Iowait:  max(now.Iowait-prev.Iowait, 0),
+		Irq:     max(now.Irq-prev.Irq, 0),
+		Softirq: max(now.Softirq-prev.Softirq, 0),
+		Steal:   max(now.Steal-prev.Steal, 0),
+		Guest:   max(now.Guest-prev.Guest, 0),
+	}
+
+	total := cpuTotal(d)
+	if total <= 0 {
+		return cpu.TimesStat{CPU: now.CPU}
+	}
+	for _, v := range []*float64{&d.User, &d.System, &d.Idle, &d.Nice, &d.Iowait, &d.Irq, &d.Softirq, &d.Steal, &d.Guest} {
+		*v = *v / total * 100
+	}
+	return d
+}
+
+func cpuTotal(t cpu.TimesStat) float64 {
+	return t.Guest + t.Idle + t.Iowait + t.Irq + t.Nice + t.Softirq + t.Steal + t.System + t.User
 }
 
 // Returns Memory usage statistics
@@ -69,7 +112,7 @@ func GetMEMLoad() (*mem.VirtualMemoryStat, error) {
 
 	v, err := mem.VirtualMemory()
 	if err != nil {
-		return &mem.VirtualMemoryStat{}, err
+		return &mem.VirtualMemoryStat{}, &CollectError{Source: "memory", Op: "virtual_memory", Err: err}
 	}
 
 	return &mem.VirtualMemoryStat{
@@ -84,6 +127,17 @@ func GetMEMLoad() (*mem.VirtualMemoryStat, error) {
 
 }
 
+// Returns Swap usage statistics
+func GetSWAPUse() (*mem.SwapMemoryStat, error) {
+
+	s, err := mem.SwapMemory()
+	if err != nil {
+		return &mem.SwapMemoryStat{}, &CollectError{Source: "memory", Op: "swap_memory", Err: err}
+	}
+
+	return s, nil
+}
+
 // Disk partition stats struct
 type DiskInfo struct {
 	Partition disk.PartitionStat
@@ -98,9 +152,11 @@ func GetDISKUse() ([]DiskInfo, error) {
 	partitions, err := disk.Partitions(true)
 	var disks []DiskInfo
 	if err != nil {
-		return disks, fmt.Errorf("unable to get disk info: %w", err)
+		return disks, &CollectError{Source: "disk", Op: "partitions", Err: err}
 	}
 
+	var diskErr error
+
 	for _, p := range partitions {
 		diskInfo := DiskInfo{}
 		diskInfo.Partition = p
@@ -108,7 +164,9 @@ func GetDISKUse() ([]DiskInfo, error) {
 		// Virtual memory returns filepaths
 		usageStat, err := disk.Usage(p.Mountpoint)
 		if err != nil {
-			return disks, fmt.Errorf("unable to get disk stats: %w", err)
+			// Skip unreadable partitions but keep the rest
+			diskErr = errors.Join(diskErr, &CollectError{Source: "disk", Op: "usage", Mountpoint: p.Mountpoint, Err: err})
+			continue
 		}
 		diskInfo.Free = usageStat.Free
 		diskInfo.Fstype = usageStat.Fstype
@@ -119,32 +177,108 @@ func GetDISKUse() ([]DiskInfo, error) {
 	}
 
 	if len(disks) == 0 {
-		return disks, errors.New("disks couldn't be found")
+		return disks, errors.Join(diskErr, &CollectError{Source: "disk", Op: "partitions", Err: errors.New("disks couldn't be found")})
 	}
 
+	disks = uniqueDisks(disks)
+
 	// Sort Disk by total capacity
 	sort.Slice(disks, func(i, j int) bool {
 		return disks[i].Total > disks[j].Total
 	})
 
-	return disks, nil
+	return disks, diskErr
+}
+
+// Drops disks mounted again on the same mountpoint, keeping the last
+// mount like findmnt does, as it's the one visible there
+func uniqueDisks(disks []DiskInfo) []DiskInfo {
+	last := make(map[string]int, len(disks))
+	for i, d := range disks {
+		last[d.Partition.Mountpoint] = i
+	}
+	if len(last) == len(disks) {
+		return disks
+	}
+	unique := make([]DiskInfo, 0, len(last))
+	for i, d := range disks {
+		if last[d.Partition.Mountpoint] == i {
+			unique = append(unique, d)
+		}
+	}
+	return unique
 }
 
 // Running process stats struct
 type ProcessInfo struct {
-	PID     int32
-	Name    string
-	CPU     float64
-	Memory  uint64
-	Runtime string
-	Status  []string
+	PID        int32
+	PPID       int32
+	Name       string
+	Cmdline    string
+	User       string
+	CPU        float64 // Average since the process started
+	CPUTime    float64 // Seconds of CPU used since the process started
+	Memory     uint64
+	Threads    int32
+	ReadBytes  uint64 // Read from storage since the process started, 0 when unknown
+	WriteBytes uint64 // Written to storage since the process started, 0 when unknown
+	Runtime    string
+	Started    time.Time
+	Status     []string
+}
+
+// Identity and usage of a process, listed for every process of a snapshot
+type ProcessSample struct {
+	PID        int32
+	PPID       int32
+	Name       string
+	Cmdline    string
+	User       string
+	Started    time.Time
+	CPU        float64
+	CPUTime    float64
+	RSS        uint64
+	Threads    int32
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// Sample of the process as listed in Snapshot.AllProcesses
+func (p ProcessInfo) Sample() ProcessSample {
+	return ProcessSample{
+		PID: p.PID, PPID: p.PPID, Name: p.Name, Cmdline: p.Cmdline, User: p.User, Started: p.Started,
+		CPU: p.CPU, CPUTime: p.CPUTime, RSS: p.Memory, Threads: p.Threads,
+		ReadBytes: p.ReadBytes, WriteBytes: p.WriteBytes,
+	}
+}
+
+// User names by uid, looked up once since reading the user
+// database for every process each collection is slow
+var (
+	usernames   = map[uint32]string{}
+	usernamesMu sync.Mutex
+)
+
+// Name of a user, its uid when it has none
+func username(uid uint32) string {
+	usernamesMu.Lock()
+	defer usernamesMu.Unlock()
+	name, ok := usernames[uid]
+	if !ok {
+		name = strconv.FormatUint(uint64(uid), 10)
+		if u, err := user.LookupId(name); err == nil {
+			name = u.Username
+		}
+		usernames[uid] = name
+	}
+	return name
 }
 
 func GetProcessInfo(n int) ([]ProcessInfo, error) {
 
 	processes, err := process.Processes()
 	if err != nil {
-		return []ProcessInfo{}, err
+		return []ProcessInfo{}, &CollectError{Source: "process", Op: "list", Err: err}
 	}
 
 	var processesInfo []ProcessInfo
@@ -156,46 +290,72 @@ func GetProcessInfo(n int) ([]ProcessInfo, error) {
 
 		proc.Name, err = p.Name()
 		if err != nil {
-			procErr = errors.Join(procErr, err)
+			procErr = errors.Join(procErr, &CollectError{Source: "process", Op: "name", PID: p.Pid, Err: err})
 			proc.Name = "N/A"
 		}
 
+		// Best effort, kernel threads have no command line, the parent
+		// may be gone already and I/O counters of processes of other
+		// users can't be read without privileges
+		proc.PPID, _ = p.Ppid()
+		proc.Cmdline, _ = p.Cmdline()
+		proc.Threads, _ = p.NumThreads()
+		if uids, err := p.Uids(); err == nil && len(uids) > 0 {
+			proc.User = username(uids[0])
+		}
+		if io, err := p.IOCounters(); err == nil {
+			proc.ReadBytes, proc.WriteBytes = io.ReadBytes, io.WriteBytes
+		}
+
 		proc.Status, err = p.Status()
 		if err != nil {
-			procErr = errors.Join(procErr, err)
+			procErr = errors.Join(procErr, &CollectError{Source: "process", Op: "status", PID: p.Pid, Err: err})
 			proc.Status = []string{"Unknown"}
 		}
 
+		// Started stays zero when unknown
 		started, err := p.CreateTime()
 		if err != nil {
-			procErr = errors.Join(procErr, err)
+			procErr = errors.Join(procErr, &CollectError{Source: "process", Op: "create_time", PID: p.Pid, Err: err})
 			proc.Runtime = "N/A"
+		} else {
+			// Divide by 1000 since CreateTime() returns uint time in milliseconds
+			proc.Started = time.Unix(started/1000, 0)
+			runtime := time.Since(proc.Started).Truncate(time.Second)
+			proc.Runtime = runtime.String()
 		}
 
-		// Divide by 1000 since CreateTime() returns uint time in milliseconds
-		runtime := time.Since(time.Unix(started/1000, 0)).Truncate(time.Second)
-		proc.Runtime = runtime.String()
-
-		cpuInfo, err := p.CPUPercent()
+		// CPU time used so far, averaged over the process lifetime
+		// (what CPUPercent() does, keeping the total along)
+		times, err := p.Times()
 		if err != nil {
-			procErr = errors.Join(procErr, err)
-			proc.CPU = 0.0
+			procErr = errors.Join(procErr, &CollectError{Source: "process", Op: "cpu_percent", PID: p.Pid, Err: err})
+		} else {
+			proc.CPUTime = times.Total()
+			if lifetime := time.Since(time.UnixMilli(started)).Seconds(); !proc.Started.IsZero() && lifetime > 0 {
+				proc.CPU = 100 * proc.CPUTime / lifetime
+			}
 		}
 
-		proc.CPU = cpuInfo
-
 		memoryInfo, err := p.MemoryInfo()
 		// If for loop is not broken after a memoryInfo error
 		// a runtime error occurs
 		if err != nil {
-			procErr = errors.Join(procErr, err)
+			procErr = errors.Join(procErr, &CollectError{Source: "process", Op: "memory_info", PID: p.Pid, Err: err})
 			processesInfo = append(processesInfo, ProcessInfo{
-				PID:     proc.PID,
-				Name:    proc.Name,
-				Status:  proc.Status,
-				Runtime: proc.Runtime,
-				Memory:  0.0,
-				CPU:     0.0,
+				PID:        proc.PID,
+				PPID:       proc.PPID,
+				Name:       proc.Name,
+				Cmdline:    proc.Cmdline,
+				User:       proc.User,
+				Status:     proc.Status,
+				Runtime:    proc.Runtime,
+				Started:    proc.Started,
+				Memory:     0.0,
+				CPU:        0.0,
+				Threads:    proc.Threads,
+				ReadBytes:  proc.ReadBytes,
+				WriteBytes: proc.WriteBytes,
 			})
 			continue
 		}
@@ -205,15 +365,15 @@ func GetProcessInfo(n int) ([]ProcessInfo, error) {
 		processesInfo = append(processesInfo, proc)
 	}
 
-	// Getting only "n" number of processes
-	if len(processesInfo) > n {
-		processesInfo = processesInfo[:n]
-	}
-
 	// Sorting processes by CPU usage
 	sort.Slice(processesInfo, func(i, j int) bool {
 		return processesInfo[i].CPU > processesInfo[j].CPU
 	})
 
+	// Getting only the "n" most demanding processes (all of them if n <= 0)
+	if n > 0 && len(processesInfo) > n {
+		processesInfo = processesInfo[:n]
+	}
+
 	return processesInfo, procErr
 }
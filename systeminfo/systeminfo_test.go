@@ -0,0 +1,55 @@
+package systeminfo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+)
+
+func TestCPUShares(t *testing.T) {
+	tests := []struct {
+		name      string
+		now, prev cpu.TimesStat
+		want      cpu.TimesStat
+	}{
+		{
+			name: "since boot",
+			now:  cpu.TimesStat{User: 30, System: 10, Idle: 60},
+			want: cpu.TimesStat{User: 30, System: 10, Idle: 60},
+		},
+		{
+			name: "between samples",
+			now:  cpu.TimesStat{User: 1030, System: 210, Idle: 5760},
+			prev: cpu.TimesStat{User: 1000, System: 200, Idle: 5700},
+			want: cpu.TimesStat{User: 30, System: 10, Idle: 60},
+		},
+		{
+			name: "nothing elapsed",
+			now:  cpu.TimesStat{User: 10, Idle: 90},
+			prev: cpu.TimesStat{User: 10, Idle: 90},
+			want: cpu.TimesStat{},
+		},
+		{
+			name: "counters reset",
+			now:  cpu.TimesStat{User: 1, Idle: 3},
+			prev: cpu.TimesStat{User: 500, Idle: 9000},
+			want: cpu.TimesStat{User: 25, Idle: 75},
+		},
+	}
+	for _, tt := range tests {
+		got := CPUShares(tt.now, tt.prev)
+		for _, f := range []struct {
+			mode      string
+			got, want float64
+		}{
+			{"user", got.User, tt.want.User},
+			{"system", got.System, tt.want.System},
+			{"idle", got.Idle, tt.want.Idle},
+		} {
+			if math.Abs(f.got-f.want) > 1e-9 {
+				t.Errorf("%s: %s = %v, want %v", tt.name, f.mode, f.got, f.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package systeminfo
+
+import "regexp"
+
+// Watch list entry, a process matches when it meets every criterion set
+type Watch struct {
+	Name    string         // Label of the entry
+	PID     int32          // Exact PID, 0 for any
+	Process string         // Exact executable name, "" for any
+	Cmdline *regexp.Regexp // Matched against the command line, nil for any
+	User    string         // Owner of the process, "" for any
+}
+
+// Reports whether a process meets every criterion of the entry
+func (w Watch) Matches(pid int32, name, cmdline, user string) bool {
+	return (w.PID == 0 || w.PID == pid) &&
+		(w.Process == "" || w.Process == name) &&
+		(w.Cmdline == nil || w.Cmdline.MatchString(cmdline)) &&
+		(w.User == "" || w.User == user)
+}
+
+// Reports whether a process matches any watch list entry
+func Watched(watches []Watch, p ProcessInfo) bool {
+	for _, w := range watches {
+		if w.Matches(p.PID, p.Name, p.Cmdline, p.User) {
+			return true
+		}
+	}
+	return false
+}
+
+// Number of processes matching each entry and whether it's missing
+func WatchMetrics(watches []Watch, procs []ProcessSample) []Metric {
+	metrics := make([]Metric, 0, 2*len(watches))
+	for _, w := range watches {
+		n := 0
+		for _, p := range procs {
+			if w.Matches(p.PID, p.Name, p.Cmdline, p.User) {
+				n++
+			}
+		}
+		missing := 0.0
+		if n == 0 {
+			missing = 1
+		}
+		labels := map[string]string{"watch": w.Name}
+		metrics = append(metrics,
+			Metric{Name: "watch.processes", Labels: labels, Value: float64(n)},
+			Metric{Name: "watch.missing", Labels: labels, Value: missing},
+		)
+	}
+	return metrics
+}
@@ -0,0 +1,205 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Samples are collected before being appended, so the newest raw
+// data is only rolled up once it is this old
+const rollupDelay = 10 * time.Second
+
+// Runs the compaction periodically until the store is closed
+func (db *DB) run(every time.Duration) {
+	defer close(db.done)
+
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		if err := db.Compact(time.Now()); err != nil && db.onError != nil {
+			db.onError(err)
+		}
+		select {
+		case <-db.stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Rolls every complete bucket up into the coarser tiers and deletes
+// the segments past their tier's retention
+func (db *DB) Compact(now time.Time) error {
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	var errs []error
+	for i := 1; i < len(Tiers); i++ {
+		if err := db.rollup(i, now); err != nil {
+			errs = append(errs, fmt.Errorf("tsdb: rolling up %s: %w", Tiers[i].Name, err))
+			break // Coarser tiers are built from this one
+		}
+	}
+	for i := range Tiers {
+		if err := db.expire(i, now); err != nil {
+			errs = append(errs, fmt.Errorf("tsdb: expiring %s: %w", Tiers[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Summary of a series over a bucket being rolled up
+type bucket struct {
+	series *seriesInfo
+	sample Sample
+}
+
+// Aggregates the data of the previous tier into complete buckets of
+// this one, a source segment span at a time to bound memory use
+func (db *DB) rollup(tier int, now time.Time) error {
+	step := Tiers[tier].Step
+	src := tier - 1
+
+	db.mu.Lock()
+	mark := db.marks[tier]
+	limit := now.Add(-rollupDelay)
+	if src > 0 && db.marks[src].Before(limit) {
+		limit = db.marks[src] // Only buckets the source tier completed
+	}
+	db.mu.Unlock()
+
+	end := limit.Truncate(step)
+	if mark.IsZero() {
+		starts, err := listSegments(db.tierDir(src))
+		if err != nil || len(starts) == 0 {
+			return err
+		}
+		mark = starts[0].Truncate(step)
+	}
+
+	chunk := max(Tiers[src].Span, step)
+	for mark.Before(end) {
+		chunkEnd := mark.Add(chunk)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+
+		series, err := db.read(src, mark, chunkEnd, nil)
+		if err != nil {
+			return err
+		}
+		if err := db.appendRollups(tier, aggregate(series, step)); err != nil {
+			return err
+		}
+
+		db.mu.Lock()
+		db.marks[tier] = chunkEnd
+		db.mu.Unlock()
+		mark = chunkEnd
+	}
+	return nil
+}
+
+// Groups samples into step long buckets, in time order
+func aggregate(series []Series, step time.Duration) [][]bucket {
+	byTime := map[int64][]bucket{}
+	var times []int64
+	for i := range series {
+		s := &series[i]
+		si := &seriesInfo{key: seriesKey(s.Name, s.Labels), name: s.Name, labels: s.Labels}
+		var cur *bucket
+		for _, v := range s.Samples {
+			t := v.Time.Truncate(step)
+			if cur == nil || !cur.sample.Time.Equal(t) {
+				key := t.UnixNano()
+				if _, ok := byTime[key]; !ok {
+					times = append(times, key)
+				}
+				byTime[key] = append(byTime[key], bucket{series: si, sample: Sample{Time: t, Min: v.Min, Max: v.Max}})
+				cur = &byTime[key][len(byTime[key])-1]
+			}
+			cur.sample.Min = min(cur.sample.Min, v.Min)
+			cur.sample.Max = max(cur.sample.Max, v.Max)
+			cur.sample.Sum += v.Sum
+			cur.sample.Count += v.Count
+		}
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	out := make([][]bucket, len(times))
+	for i, t := range times {
+		out[i] = byTime[t]
+	}
+	return out
+}
+
+// Writes one rollup record per bucket
+func (db *DB) appendRollups(tier int, buckets [][]bucket) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+
+	var seg *segment
+	for _, b := range buckets {
+		t := b[0].sample.Time
+		var err error
+		if seg, err = db.segmentFor(tier, t); err != nil {
+			return err
+		}
+
+		var buf, rec []byte
+		rec = append(rec, recRollup)
+		rec = binary.AppendVarint(rec, t.UnixNano())
+		rec = binary.AppendUvarint(rec, uint64(len(b)))
+		for _, p := range b {
+			var id uint64
+			buf, id = seg.seriesID(buf, p.series.name, p.series.labels, p.series.key)
+			rec = binary.AppendUvarint(rec, id)
+			rec = binary.AppendUvarint(rec, uint64(p.sample.Count))
+			rec = appendFloat(rec, p.sample.Min)
+			rec = appendFloat(rec, p.sample.Max)
+			rec = appendFloat(rec, p.sample.Sum)
+		}
+		if err := seg.write(appendFrame(buf, rec), t); err != nil {
+			return err
+		}
+	}
+	if seg != nil {
+		return seg.sync()
+	}
+	return nil
+}
+
+// Deletes the segments of a tier that ended before its retention
+// The one being appended to is always kept
+func (db *DB) expire(tier int, now time.Time) error {
+	starts, err := listSegments(db.tierDir(tier))
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	var active time.Time
+	if seg := db.active[tier]; seg != nil {
+		active = seg.start
+	}
+	db.mu.Unlock()
+
+	cutoff := now.Add(-db.retention[tier])
+	var errs []error
+	for _, start := range starts {
+		if start.Equal(active) || start.Add(Tiers[tier].Span).After(cutoff) {
+			continue
+		}
+		if err := os.Remove(segmentPath(db.tierDir(tier), start)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
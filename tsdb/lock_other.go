@@ -0,0 +1,19 @@
+//go:build !unix && !windows
+
+package tsdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// No file locking on this platform, the store is only
+// protected against concurrent use within the process
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, "LOCK"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: %w", err)
+	}
+	return f, nil
+}
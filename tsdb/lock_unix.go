@@ -0,0 +1,25 @@
+//go:build unix
+
+package tsdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Takes an exclusive lock on the store so two processes never append
+// to the same segments, released when the returned file is closed
+// (or the process dies)
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, "LOCK"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("tsdb: %s is in use by another syspulse process", dir)
+	}
+	return f, nil
+}
@@ -0,0 +1,28 @@
+//go:build windows
+
+package tsdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// Takes an exclusive lock on the store so two processes never append
+// to the same segments, released when the returned file is closed
+// (or the process dies)
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, "LOCK"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: %w", err)
+	}
+	var ol windows.Overlapped
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, &ol); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("tsdb: %s is in use by another syspulse process", dir)
+	}
+	return f, nil
+}
@@ -0,0 +1,392 @@
+package tsdb
+
+import (
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Aggregations a query can apply
+var Aggregations = []string{"avg", "min", "max", "p95", "rate"}
+
+// Label condition of a selector
+type LabelMatcher struct {
+	Label string
+	Op    string // =, !=, =~ or !~
+	Value string
+	re    *regexp.Regexp
+}
+
+func (lm LabelMatcher) match(labels map[string]string) bool {
+	v := labels[lm.Label]
+	switch lm.Op {
+	case "=":
+		return v == lm.Value
+	case "!=":
+		return v != lm.Value
+	case "=~":
+		return lm.re.MatchString(v)
+	default:
+		return !lm.re.MatchString(v)
+	}
+}
+
+// Series selector: a metric name, where * matches any run of
+// characters, and optional label matchers, as in
+// disk.used_percent{mountpoint="/"} or process.rss_bytes{name=~"post.*"}
+type Selector struct {
+	Name     string
+	Matchers []LabelMatcher
+}
+
+// Parses a selector, regexps are anchored to the whole label value
+func ParseSelector(s string) (Selector, error) {
+	s = strings.TrimSpace(s)
+	name, rest, hasLabels := strings.Cut(s, "{")
+	sel := Selector{Name: strings.TrimSpace(name)}
+	if sel.Name == "" {
+		return Selector{}, fmt.Errorf("selector %q has no metric name", s)
+	}
+	if _, err := path.Match(sel.Name, ""); err != nil {
+		return Selector{}, fmt.Errorf("selector %q: invalid metric name", s)
+	}
+	if !hasLabels {
+		return sel, nil
+	}
+	if !strings.HasSuffix(rest, "}") {
+		return Selector{}, fmt.Errorf("selector %q: missing closing brace", s)
+	}
+	rest = strings.TrimSuffix(rest, "}")
+
+	for strings.TrimSpace(rest) != "" {
+		rest = strings.TrimSpace(rest)
+		i := strings.IndexAny(rest, "=!")
+		if i <= 0 {
+			return Selector{}, fmt.Errorf("selector %q: expected label=\"value\"", s)
+		}
+		lm := LabelMatcher{Label: strings.TrimSpace(rest[:i])}
+		rest = rest[i:]
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(rest, op) {
+				lm.Op = op
+				break
+			}
+		}
+		if lm.Op == "" {
+			return Selector{}, fmt.Errorf("selector %q: unknown operator for label %q", s, lm.Label)
+		}
+		rest = strings.TrimSpace(rest[len(lm.Op):])
+
+		value, n, err := quoted(rest)
+		if err != nil {
+			return Selector{}, fmt.Errorf("selector %q: %w", s, err)
+		}
+		lm.Value = value
+		if lm.Op == "=~" || lm.Op == "!~" {
+			lm.re, err = regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return Selector{}, fmt.Errorf("selector %q: %w", s, err)
+			}
+		}
+		sel.Matchers = append(sel.Matchers, lm)
+
+		rest = strings.TrimSpace(rest[n:])
+		if rest != "" {
+			if rest[0] != ',' {
+				return Selector{}, fmt.Errorf("selector %q: expected a comma after label %q", s, lm.Label)
+			}
+			rest = rest[1:]
+		}
+	}
+	return sel, nil
+}
+
+// Reads a double quoted value at the start of s, returning it
+// unescaped along with the length it took in s
+func quoted(s string) (string, int, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", 0, fmt.Errorf("label values must be double quoted")
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated label value")
+}
+
+// Reports whether a series is selected
+func (s Selector) Match(name string, labels map[string]string) bool {
+	if ok, _ := path.Match(s.Name, name); !ok {
+		return false
+	}
+	for _, lm := range s.Matchers {
+		if !lm.match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// What to read and how to summarize it
+type Query struct {
+	Selector Selector
+	From, To time.Time
+	Agg      string
+	By       []string      // Labels the series are grouped by, "*" keeps every series apart
+	Step     time.Duration // Splits the range in buckets, 0 for a single value per group
+}
+
+// Aggregated value of a group over the range or a step of it
+type QueryPoint struct {
+	Time    time.Time // Start of the step, or of the range
+	Value   float64
+	Samples int // Raw samples behind the value
+}
+
+// Values of a group of series
+type QueryResult struct {
+	Labels map[string]string // Values of the grouping labels
+	Points []QueryPoint
+}
+
+// Longest range read from the raw tier, past it rollups are cheaper
+const maxRawRange = 24 * time.Hour
+
+// Most buckets a tier may return per series for a query
+const maxQueryBuckets = 20000
+
+// Picks the tier to answer a range from: the finest one still cheap to
+// read that holds data back to the start of the range, or if none
+// reaches that far the one reaching furthest back
+func (db *DB) ChooseTier(from, to time.Time) (string, error) {
+	best, bestStart := -1, time.Time{}
+	for i, t := range Tiers {
+		span := to.Sub(from)
+		if (t.Step == 0 && span > maxRawRange) || (t.Step > 0 && span/t.Step > maxQueryBuckets) {
+			continue
+		}
+		starts, err := listSegments(db.tierDir(i))
+		if err != nil {
+			return "", fmt.Errorf("tsdb: %w", err)
+		}
+		if len(starts) == 0 {
+			continue
+		}
+		if !starts[0].After(from) {
+			return t.Name, nil
+		}
+		if best < 0 || starts[0].Before(bestStart) {
+			best, bestStart = i, starts[0]
+		}
+	}
+	if best < 0 {
+		return Tiers[len(Tiers)-1].Name, nil
+	}
+	return Tiers[best].Name, nil
+}
+
+// Runs a query against a tier, "" lets ChooseTier pick it
+// Returns the results along with the tier read
+func (db *DB) Query(q Query, tier string) ([]QueryResult, string, error) {
+	if tier == "" {
+		var err error
+		if tier, err = db.ChooseTier(q.From, q.To); err != nil {
+			return nil, "", err
+		}
+	}
+	series, err := db.Read(tier, q.From, q.To, q.Selector.Match)
+	if err != nil {
+		return nil, "", err
+	}
+	results, err := Evaluate(series, q)
+	return results, tier, err
+}
+
+// Groups and aggregates series already read, so samples from other
+// sources (e.g. recordings) can be queried too
+// p95 uses bucket averages when the series hold rollups
+func Evaluate(series []Series, q Query) ([]QueryResult, error) {
+	agg, ok := aggregators[q.Agg]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregation %q (expected %s)", q.Agg, strings.Join(Aggregations, ", "))
+	}
+
+	// Groups in the order of their first series
+	var keys []string
+	groups := map[string]*QueryResult{}
+	members := map[string][]Series{}
+	for _, s := range series {
+		labels := groupLabels(s, q.By)
+		key := seriesKey("", labels)
+		if groups[key] == nil {
+			keys = append(keys, key)
+			groups[key] = &QueryResult{Labels: labels}
+		}
+		members[key] = append(members[key], s)
+	}
+
+	results := make([]QueryResult, 0, len(keys))
+	for _, key := range keys {
+		r := groups[key]
+		for _, b := range steps(q) {
+			var window []Series
+			samples := 0
+			for _, s := range members[key] {
+				in := s.samplesIn(b, b.Add(q.stepOr()))
+				if len(in) == 0 {
+					continue
+				}
+				window = append(window, Series{Name: s.Name, Labels: s.Labels, Samples: in})
+				for _, smp := range in {
+					samples += smp.Count
+				}
+			}
+			if len(window) == 0 {
+				continue
+			}
+			v := agg(window)
+			if math.IsNaN(v) {
+				continue
+			}
+			r.Points = append(r.Points, QueryPoint{Time: b, Value: v, Samples: samples})
+		}
+		if len(r.Points) > 0 {
+			results = append(results, *r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return seriesKey("", results[i].Labels) < seriesKey("", results[j].Labels)
+	})
+	return results, nil
+}
+
+// Labels a series is grouped under
+func groupLabels(s Series, by []string) map[string]string {
+	labels := map[string]string{}
+	for _, l := range by {
+		if l == "*" {
+			labels["metric"] = s.Name
+			for k, v := range s.Labels {
+				labels[k] = v
+			}
+			continue
+		}
+		if v, ok := s.Labels[l]; ok {
+			labels[l] = v
+		}
+	}
+	return labels
+}
+
+func (q Query) stepOr() time.Duration {
+	if q.Step > 0 {
+		return q.Step
+	}
+	return q.To.Sub(q.From)
+}
+
+// Start of every step of the range
+func steps(q Query) []time.Time {
+	if q.Step <= 0 {
+		return []time.Time{q.From}
+	}
+	var out []time.Time
+	for t := q.From; t.Before(q.To); t = t.Add(q.Step) {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Samples taken from from (included) to to (excluded)
+func (s Series) samplesIn(from, to time.Time) []Sample {
+	lo := sort.Search(len(s.Samples), func(i int) bool { return !s.Samples[i].Time.Before(from) })
+	hi := sort.Search(len(s.Samples), func(i int) bool { return !s.Samples[i].Time.Before(to) })
+	return s.Samples[lo:hi]
+}
+
+// Reduces the samples of a group to a value, NaN when there's none
+var aggregators = map[string]func([]Series) float64{
+	"avg": func(group []Series) float64 {
+		sum, count := 0.0, 0
+		for _, s := range group {
+			for _, smp := range s.Samples {
+				sum += smp.Sum
+				count += smp.Count
+			}
+		}
+		if count == 0 {
+			return math.NaN()
+		}
+		return sum / float64(count)
+	},
+	"min": func(group []Series) float64 {
+		v := math.Inf(1)
+		for _, s := range group {
+			for _, smp := range s.Samples {
+				v = math.Min(v, smp.Min)
+			}
+		}
+		return v
+	},
+	"max": func(group []Series) float64 {
+		v := math.Inf(-1)
+		for _, s := range group {
+			for _, smp := range s.Samples {
+				v = math.Max(v, smp.Max)
+			}
+		}
+		return v
+	},
+	"p95": func(group []Series) float64 {
+		var values []float64
+		for _, s := range group {
+			for _, smp := range s.Samples {
+				values = append(values, smp.Avg())
+			}
+		}
+		return systeminfo.Percentile(values, 95)
+	},
+	// Growth per second of counters, summed over the group
+	// A drop is taken as a counter reset, growing from zero
+	"rate": func(group []Series) float64 {
+		total, ok := 0.0, false
+		for _, s := range group {
+			if len(s.Samples) < 2 {
+				continue
+			}
+			growth := 0.0
+			for i := 1; i < len(s.Samples); i++ {
+				prev, cur := s.Samples[i-1].Avg(), s.Samples[i].Avg()
+				if cur >= prev {
+					growth += cur - prev
+				} else {
+					growth += cur
+				}
+			}
+			secs := s.Samples[len(s.Samples)-1].Time.Sub(s.Samples[0].Time).Seconds()
+			if secs > 0 {
+				total += growth / secs
+				ok = true
+			}
+		}
+		if !ok {
+			return math.NaN()
+		}
+		return total
+	},
+}
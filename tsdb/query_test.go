@@ -0,0 +1,222 @@
+package tsdb
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		in      string
+		name    string
+		labels  []string // label, op and value of each matcher
+		wantErr bool
+	}{
+		{in: "cpu.percent", name: "cpu.percent"},
+		{in: "  disk.*  ", name: "disk.*"},
+		{in: `disk.used_percent{mountpoint="/"}`, name: "disk.used_percent", labels: []string{"mountpoint", "=", "/"}},
+		{in: `process.rss_bytes{name=~"post.*", pid!="1"}`, name: "process.rss_bytes", labels: []string{"name", "=~", "post.*", "pid", "!=", "1"}},
+		{in: `x{a!~"b|c"}`, name: "x", labels: []string{"a", "!~", "b|c"}},
+		{in: `x{ a = "q\"uote" , }`, name: "x", labels: []string{"a", "=", `q"uote`}},
+		{in: `x{}`, name: "x"},
+		{in: "", wantErr: true},
+		{in: `{a="b"}`, wantErr: true},
+		{in: "x[", wantErr: true},
+		{in: `x{a="b"`, wantErr: true},
+		{in: `x{a=b}`, wantErr: true},
+		{in: `x{a~"b"}`, wantErr: true},
+		{in: `x{a="b`, wantErr: true},
+		{in: `x{a="b" c="d"}`, wantErr: true},
+		{in: `x{a=~"("}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSelector(%q) = %+v, want an error", tt.in, sel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", tt.in, err)
+			continue
+		}
+		var labels []string
+		for _, lm := range sel.Matchers {
+			labels = append(labels, lm.Label, lm.Op, lm.Value)
+		}
+		if sel.Name != tt.name || !reflect.DeepEqual(labels, tt.labels) {
+			t.Errorf("ParseSelector(%q) = %q %q, want %q %q", tt.in, sel.Name, labels, tt.name, tt.labels)
+		}
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	tests := []struct {
+		sel    string
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"disk.*", "disk.used_percent", nil, true},
+		{"disk.*", "cpu.percent", nil, false},
+		{"*", "cpu.percent", nil, true},
+		{`disk.used_percent{mountpoint="/"}`, "disk.used_percent", map[string]string{"mountpoint": "/"}, true},
+		{`disk.used_percent{mountpoint="/"}`, "disk.used_percent", map[string]string{"mountpoint": "/home"}, false},
+		{`process.cpu_percent{name=~"post.*"}`, "process.cpu_percent", map[string]string{"name": "postgres"}, true},
+		{`process.cpu_percent{name=~"post"}`, "process.cpu_percent", map[string]string{"name": "postgres"}, false}, // Anchored
+		{`process.cpu_percent{name!~"post.*"}`, "process.cpu_percent", map[string]string{"name": "nginx"}, true},
+		{`process.cpu_percent{pid!="1"}`, "process.cpu_percent", map[string]string{"pid": "1"}, false},
+		{`process.cpu_percent{user=""}`, "process.cpu_percent", map[string]string{"pid": "1"}, true}, // Missing labels are empty
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.sel)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tt.sel, err)
+		}
+		if got := sel.Match(tt.name, tt.labels); got != tt.want {
+			t.Errorf("%s matches %s%v = %v, want %v", tt.sel, tt.name, tt.labels, got, tt.want)
+		}
+	}
+}
+
+// Raw series with a sample every 10 seconds from t0
+func rawSeries(name string, labels map[string]string, values ...float64) Series {
+	s := Series{Name: name, Labels: labels}
+	for i, v := range values {
+		s.Samples = append(s.Samples, Sample{Time: t0.Add(time.Duration(i) * 10 * time.Second), Min: v, Max: v, Sum: v, Count: 1})
+	}
+	return s
+}
+
+func TestEvaluate(t *testing.T) {
+	root := map[string]string{"mountpoint": "/"}
+	home := map[string]string{"mountpoint": "/home"}
+	hundred := make([]float64, 100)
+	for i := range hundred {
+		hundred[i] = float64(i + 1)
+	}
+
+	tests := []struct {
+		name   string
+		series []Series
+		q      Query
+		want   []QueryResult
+	}{
+		{
+			name:   "avg of every series together",
+			series: []Series{rawSeries("disk.used_percent", root, 10, 20), rawSeries("disk.used_percent", home, 30, 40)},
+			q:      Query{Agg: "avg"},
+			want:   []QueryResult{{Labels: map[string]string{}, Points: []QueryPoint{{Time: t0, Value: 25, Samples: 4}}}},
+		},
+		{
+			name:   "min and max by label",
+			series: []Series{rawSeries("disk.used_percent", root, 10, 20), rawSeries("disk.used_percent", home, 30, 40)},
+			q:      Query{Agg: "max", By: []string{"mountpoint"}},
+			want: []QueryResult{
+				{Labels: root, Points: []QueryPoint{{Time: t0, Value: 20, Samples: 2}}},
+				{Labels: home, Points: []QueryPoint{{Time: t0, Value: 40, Samples: 2}}},
+			},
+		},
+		{
+			name:   "grouping by * keeps every series apart",
+			series: []Series{rawSeries("disk.used_percent", root, 1, 3), rawSeries("disk.free_bytes", root, 5, 7)},
+			q:      Query{Agg: "min", By: []string{"*"}},
+			want: []QueryResult{
+				{Labels: map[string]string{"metric": "disk.free_bytes", "mountpoint": "/"}, Points: []QueryPoint{{Time: t0, Value: 5, Samples: 2}}},
+				{Labels: map[string]string{"metric": "disk.used_percent", "mountpoint": "/"}, Points: []QueryPoint{{Time: t0, Value: 1, Samples: 2}}},
+			},
+		},
+		{
+			name:   "p95",
+			series: []Series{rawSeries("cpu.percent", nil, hundred...)},
+			q:      Query{Agg: "p95"},
+			want:   []QueryResult{{Labels: map[string]string{}, Points: []QueryPoint{{Time: t0, Value: 95, Samples: 100}}}},
+		},
+		{
+			name:   "rate of a steady counter",
+			series: []Series{rawSeries("swap.in_bytes_total", nil, 0, 100, 200, 300)},
+			q:      Query{Agg: "rate"},
+			want:   []QueryResult{{Labels: map[string]string{}, Points: []QueryPoint{{Time: t0, Value: 10, Samples: 4}}}},
+		},
+		{
+			name:   "rate across a counter reset",
+			series: []Series{rawSeries("swap.in_bytes_total", nil, 0, 10, 20, 5, 15)},
+			q:      Query{Agg: "rate"},
+			// 10 + 10 + 5 (from zero after the reset) + 10 over 40s
+			want: []QueryResult{{Labels: map[string]string{}, Points: []QueryPoint{{Time: t0, Value: 35.0 / 40, Samples: 5}}}},
+		},
+		{
+			name:   "rate sums the series of a group",
+			series: []Series{rawSeries("swap.in_bytes_total", root, 0, 100), rawSeries("swap.in_bytes_total", home, 0, 50)},
+			q:      Query{Agg: "rate"},
+			want:   []QueryResult{{Labels: map[string]string{}, Points: []QueryPoint{{Time: t0, Value: 15, Samples: 4}}}},
+		},
+		{
+			name:   "rate needs two samples",
+			series: []Series{rawSeries("swap.in_bytes_total", nil, 100)},
+			q:      Query{Agg: "rate"},
+			want:   []QueryResult{},
+		},
+		{
+			name:   "steps split the range",
+			series: []Series{rawSeries("cpu.percent", nil, 1, 2, 3, 4, 5, 6)},
+			q:      Query{Agg: "avg", Step: 30 * time.Second},
+			want: []QueryResult{{Labels: map[string]string{}, Points: []QueryPoint{
+				{Time: t0, Value: 2, Samples: 3},
+				{Time: t0.Add(30 * time.Second), Value: 5, Samples: 3},
+			}}},
+		},
+		{
+			name: "rollups are weighted by their count",
+			series: []Series{{Name: "cpu.percent", Samples: []Sample{
+				{Time: t0, Min: 1, Max: 3, Sum: 12, Count: 6},
+				{Time: t0.Add(time.Minute), Min: 0, Max: 10, Sum: 10, Count: 2},
+			}}},
+			q:    Query{Agg: "avg"},
+			want: []QueryResult{{Labels: map[string]string{}, Points: []QueryPoint{{Time: t0, Value: 22.0 / 8, Samples: 8}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.q
+			q.From, q.To = t0, t0.Add(time.Hour)
+			if q.Step > 0 {
+				q.To = t0.Add(time.Minute)
+			}
+			got, err := Evaluate(tt.series, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalResults(got, tt.want) {
+				t.Errorf("Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateUnknownAggregation(t *testing.T) {
+	if _, err := Evaluate(nil, Query{Agg: "median"}); err == nil {
+		t.Error("Evaluate() with an unknown aggregation returned no error")
+	}
+}
+
+func equalResults(a, b []QueryResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i].Labels, b[i].Labels) || len(a[i].Points) != len(b[i].Points) {
+			return false
+		}
+		for j, p := range a[i].Points {
+			q := b[i].Points[j]
+			if !p.Time.Equal(q.Time) || p.Samples != q.Samples || math.Abs(p.Value-q.Value) > 1e-9 {
+				return false
+			}
+		}
+	}
+	return true
+}
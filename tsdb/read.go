@@ -0,0 +1,117 @@
+package tsdb
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Value of a series over a bucket, or a single raw sample
+// (Count 1 and Min, Max and Sum all equal to the value)
+type Sample struct {
+	Time          time.Time
+	Min, Max, Sum float64
+	Count         int
+}
+
+func (s Sample) Avg() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// Samples of a series, oldest first
+type Series struct {
+	Name    string
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// Selects series by name and labels, nil matches everything
+type Matcher func(name string, labels map[string]string) bool
+
+// Reads the samples of a tier taken from from (included) to to
+// (excluded) of every series accepted by match, sorted by series
+func (db *DB) Read(tier string, from, to time.Time, match Matcher) ([]Series, error) {
+	i := TierIndex(tier)
+	if i < 0 {
+		return nil, fmt.Errorf("tsdb: unknown tier %q", tier)
+	}
+	return db.read(i, from, to, match)
+}
+
+func (db *DB) read(tier int, from, to time.Time, match Matcher) ([]Series, error) {
+	starts, err := listSegments(db.tierDir(tier))
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: %w", err)
+	}
+
+	found := map[string]*Series{}
+	accepted := map[*seriesInfo]bool{}
+	span := Tiers[tier].Span
+	for i, start := range starts {
+		// Segments end where the next one starts, the last may
+		// hold samples from a clock that went backwards
+		end := start.Add(span)
+		if i+1 < len(starts) && starts[i+1].After(end) {
+			end = starts[i+1]
+		}
+		if !end.After(from) || !start.Before(to) {
+			continue
+		}
+
+		err := readSegment(segmentPath(db.tierDir(tier), start), func(t time.Time, points []point) {
+			if t.Before(from) || !t.Before(to) {
+				return
+			}
+			for _, p := range points {
+				ok, seen := accepted[p.series]
+				if !seen {
+					ok = match == nil || match(p.series.name, p.series.labels)
+					accepted[p.series] = ok
+				}
+				if !ok {
+					continue
+				}
+				s := found[p.series.key]
+				if s == nil {
+					s = &Series{Name: p.series.name, Labels: p.series.labels}
+					found[p.series.key] = s
+				}
+				s.Samples = append(s.Samples, p.sample)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tsdb: %w", err)
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for k := range found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]Series, len(keys))
+	for i, k := range keys {
+		out[i] = *found[k]
+		sort.SliceStable(out[i].Samples, func(a, b int) bool { return out[i].Samples[a].Time.Before(out[i].Samples[b].Time) })
+	}
+	return out, nil
+}
+
+// Reads the records of a segment, a partial record at the end
+// (one being written, or left by a crash) is skipped
+func readSegment(path string, onRecord func(time.Time, []point)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil // Deleted by retention meanwhile
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = scanSegment(f, nil, onRecord)
+	return err
+}
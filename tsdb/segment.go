@@ -0,0 +1,383 @@
+package tsdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Segment files hold the samples of a tier over a fixed span of time,
+// named after the unix time of their start (1718000000.seg). They start
+// with a magic string followed by CRC checked frames:
+//
+//	magic "SPT1"
+//	frame length (uint32) | frame CRC32 | record
+//
+// A record is a type byte and its fields, integers as varints and
+// values as float64 bits (big endian):
+//
+//	series: id, name, label count, then key/value pairs
+//	raw:    time (unix ns), point count, then id/value pairs
+//	rollup: bucket start (unix ns), point count, then id, count, min, max, sum
+//
+// Series ids are local to a segment, so segments can be deleted on their
+// own. Frames are only ever appended, a crash can only cut the last one
+// and it is dropped when the segment is opened again
+
+const (
+	segMagic = "SPT1"
+	segExt   = ".seg"
+
+	recSeries = 1
+	recRaw    = 2
+	recRollup = 3
+
+	// Upper bound of a frame, anything bigger is corruption
+	maxFrameSize = 64 << 20
+
+	// How often appended frames are flushed to disk
+	syncInterval = 10 * time.Second
+)
+
+// Identity of a series stored in a segment
+type seriesInfo struct {
+	key    string
+	name   string
+	labels map[string]string
+}
+
+// Segment open for appending
+type segment struct {
+	f        *os.File
+	start    time.Time
+	ids      map[string]uint64 // Series key -> id
+	added    []string          // Keys given an id since the last write
+	last     time.Time         // Time of the last record
+	size     int64
+	lastSync time.Time
+	broken   bool // A failed write couldn't be undone, the file must be reopened
+}
+
+// Start times of the segments of a tier directory, oldest first
+func listSegments(dir string) ([]time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var starts []time.Time
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segExt) {
+			continue
+		}
+		sec, err := strconv.ParseInt(strings.TrimSuffix(name, segExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		starts = append(starts, time.Unix(sec, 0))
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts, nil
+}
+
+func segmentPath(dir string, start time.Time) string {
+	return filepath.Join(dir, strconv.FormatInt(start.Unix(), 10)+segExt)
+}
+
+// Opens a segment for appending, creating it when missing
+// An existing one is scanned to restore its series ids, and cut
+// back to its last complete frame if a crash left a partial one
+func openSegment(path string, start time.Time) (*segment, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &segment{f: f, start: start, ids: map[string]uint64{}, lastSync: time.Now()}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var valid int64
+	if info.Size() > 0 {
+		valid, err = scanSegment(f, func(id uint64, si seriesInfo) {
+			s.ids[si.key] = id
+		}, func(t time.Time, _ []point) {
+			s.last = t
+		})
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if valid < info.Size() {
+		if err := f.Truncate(valid); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// New file, or one cut before its magic was written
+	if valid == 0 {
+		if _, err := f.Write([]byte(segMagic)); err != nil {
+			f.Close()
+			return nil, err
+		}
+		valid = int64(len(segMagic))
+	}
+	s.size = valid
+	return s, nil
+}
+
+// Id of a series, appending its definition to buf when it's new
+func (s *segment) seriesID(buf []byte, name string, labels map[string]string, key string) ([]byte, uint64) {
+	if id, ok := s.ids[key]; ok {
+		return buf, id
+	}
+	id := uint64(len(s.ids) + 1)
+	s.ids[key] = id
+	s.added = append(s.added, key)
+
+	var rec []byte
+	rec = append(rec, recSeries)
+	rec = binary.AppendUvarint(rec, id)
+	rec = appendString(rec, name)
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rec = binary.AppendUvarint(rec, uint64(len(keys)))
+	for _, k := range keys {
+		rec = appendString(rec, k)
+		rec = appendString(rec, labels[k])
+	}
+	return appendFrame(buf, rec), id
+}
+
+// Writes frames in a single write so a crash can only cut the last one
+// A failed write is undone: the file is cut back and the series defined
+// by the frames forgotten, so later records never use an id the file lacks
+func (s *segment) write(buf []byte, t time.Time) error {
+	added := s.added
+	s.added = nil
+	n, err := s.f.Write(buf)
+	if err != nil {
+		for _, key := range added {
+			delete(s.ids, key)
+		}
+		if n > 0 {
+			if terr := s.f.Truncate(s.size); terr != nil {
+				s.broken = true
+			} else if _, serr := s.f.Seek(s.size, io.SeekStart); serr != nil {
+				s.broken = true
+			}
+		}
+		return err
+	}
+	s.size += int64(n)
+	s.last = t
+	if time.Since(s.lastSync) >= syncInterval {
+		return s.sync()
+	}
+	return nil
+}
+
+func (s *segment) sync() error {
+	s.lastSync = time.Now()
+	return s.f.Sync()
+}
+
+func (s *segment) close() error {
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Wraps a record in a length and CRC prefixed frame
+func appendFrame(buf, rec []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(rec)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(rec))
+	return append(buf, rec...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendFloat(buf []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+// Value of a series in a raw or rollup record
+type point struct {
+	series *seriesInfo
+	sample Sample
+}
+
+// Reads every frame of a segment from its start, calling onSeries for
+// each series definition and onRecord for each raw or rollup record
+// Returns the size of the valid part, anything after it is a partial
+// or corrupt frame (0 when even the magic is missing)
+func scanSegment(f *os.File, onSeries func(uint64, seriesInfo), onRecord func(time.Time, []point)) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return 0, nil // Cut before its magic was written, nothing in it
+	}
+	if string(magic[:]) != segMagic {
+		return 0, errors.New("not a syspulse tsdb segment")
+	}
+
+	valid := int64(len(segMagic))
+	series := map[uint64]*seriesInfo{}
+	var fixed [8]byte
+	for {
+		if _, err := io.ReadFull(r, fixed[:]); err != nil {
+			return valid, nil
+		}
+		n := binary.BigEndian.Uint32(fixed[:4])
+		if n == 0 || n > maxFrameSize {
+			return valid, nil
+		}
+		rec := make([]byte, n)
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return valid, nil
+		}
+		if crc32.ChecksumIEEE(rec) != binary.BigEndian.Uint32(fixed[4:]) {
+			return valid, nil
+		}
+		if !decodeRecord(rec, series, onSeries, onRecord) {
+			return valid, nil
+		}
+		valid += int64(len(fixed)) + int64(n)
+	}
+}
+
+// Decodes a record, reporting false when it's malformed
+func decodeRecord(rec []byte, series map[uint64]*seriesInfo, onSeries func(uint64, seriesInfo), onRecord func(time.Time, []point)) bool {
+	d := decoder{buf: rec[1:]}
+	switch rec[0] {
+	case recSeries:
+		id := d.uvarint()
+		si := seriesInfo{name: d.string(), labels: map[string]string{}}
+		for n := d.uvarint(); n > 0 && d.ok(); n-- {
+			k := d.string()
+			si.labels[k] = d.string()
+		}
+		if !d.ok() {
+			return false
+		}
+		si.key = seriesKey(si.name, si.labels)
+		series[id] = &si
+		if onSeries != nil {
+			onSeries(id, si)
+		}
+
+	case recRaw, recRollup:
+		t := time.Unix(0, d.varint())
+		n := d.uvarint()
+		if !d.ok() || n > uint64(len(rec)) {
+			return false
+		}
+		points := make([]point, 0, n)
+		for i := uint64(0); i < n; i++ {
+			si := series[d.uvarint()]
+			var s Sample
+			if rec[0] == recRaw {
+				v := d.float()
+				s = Sample{Time: t, Min: v, Max: v, Sum: v, Count: 1}
+			} else {
+				s = Sample{Time: t, Count: int(d.uvarint())}
+				s.Min, s.Max, s.Sum = d.float(), d.float(), d.float()
+			}
+			if !d.ok() || si == nil {
+				return false
+			}
+			points = append(points, point{series: si, sample: s})
+		}
+		if onRecord != nil {
+			onRecord(t, points)
+		}
+
+	default:
+		return false
+	}
+	return d.ok()
+}
+
+// Reads fields off a record, remembering the first failure
+type decoder struct {
+	buf []byte
+	err bool
+}
+
+func (d *decoder) ok() bool { return !d.err }
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = true
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = true
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err || n > uint64(len(d.buf)) {
+		d.err = true
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) float() float64 {
+	if len(d.buf) < 8 {
+		d.err = true
+		return 0
+	}
+	v := math.Float64frombits(binary.BigEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
@@ -0,0 +1,286 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github/iegpeppino/syspulse/systeminfo"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolution level of the stored data
+// Raw keeps every sample, the others keep the min/avg/max of each
+// Step long bucket, rolled up from the tier before them
+type Tier struct {
+	Name      string
+	Step      time.Duration // Bucket size, 0 for raw samples
+	Span      time.Duration // Time covered by each segment file
+	Retention time.Duration // Default retention
+}
+
+// Tiers from the finest to the coarsest
+var Tiers = []Tier{
+	{"raw", 0, time.Hour, 48 * time.Hour},
+	{"1m", time.Minute, 24 * time.Hour, 14 * 24 * time.Hour},
+	{"10m", 10 * time.Minute, 7 * 24 * time.Hour, 90 * 24 * time.Hour},
+	{"1h", time.Hour, 30 * 24 * time.Hour, 2 * 365 * 24 * time.Hour},
+}
+
+// Index of a tier by name, -1 when unknown
+func TierIndex(name string) int {
+	for i, t := range Tiers {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Store settings
+type Options struct {
+	Dir          string
+	Retention    map[string]time.Duration // By tier name, missing tiers keep their default
+	CompactEvery time.Duration            // How often rollups and retention run, 1m by default
+	OnError      func(error)              // Called with background compaction errors
+}
+
+// Embedded time series store
+// Samples are appended to raw segments and rolled up into the coarser
+// tiers in the background, which also deletes segments past retention
+type DB struct {
+	dir       string
+	retention []time.Duration // By tier index
+	onError   func(error)
+	lock      *os.File
+
+	compactMu sync.Mutex // Serializes compactions
+
+	mu     sync.Mutex
+	active []*segment  // Segment being appended to, by tier index
+	marks  []time.Time // End of the data already rolled up, by tier index
+	closed bool
+
+	readOnly bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Opens (or creates) the store in opts.Dir and starts the
+// background compaction
+// The last segment of each tier is checked and cut back to its last
+// complete record, so a store left behind by a crash opens fine
+func Open(opts Options) (*DB, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("tsdb: no directory given")
+	}
+	for name := range opts.Retention {
+		if TierIndex(name) < 0 {
+			return nil, fmt.Errorf("tsdb: unknown tier %q (expected raw, 1m, 10m or 1h)", name)
+		}
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("tsdb: %w", err)
+	}
+	lock, err := lockDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DB{
+		dir:       opts.Dir,
+		retention: make([]time.Duration, len(Tiers)),
+		onError:   opts.OnError,
+		lock:      lock,
+		active:    make([]*segment, len(Tiers)),
+		marks:     make([]time.Time, len(Tiers)),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for i, t := range Tiers {
+		db.retention[i] = t.Retention
+		if r, ok := opts.Retention[t.Name]; ok {
+			db.retention[i] = r
+		}
+	}
+
+	for i, t := range Tiers {
+		dir := db.tierDir(i)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			db.closeFiles()
+			return nil, fmt.Errorf("tsdb: %w", err)
+		}
+		starts, err := listSegments(dir)
+		if err != nil {
+			db.closeFiles()
+			return nil, fmt.Errorf("tsdb: %w", err)
+		}
+		if len(starts) == 0 {
+			continue
+		}
+		start := starts[len(starts)-1]
+		seg, err := openSegment(segmentPath(dir, start), start)
+		if err != nil {
+			db.closeFiles()
+			return nil, fmt.Errorf("tsdb: %w", err)
+		}
+		db.active[i] = seg
+		// Rollups resume after the last bucket written
+		if t.Step > 0 && !seg.last.IsZero() {
+			db.marks[i] = seg.last.Add(t.Step)
+		}
+	}
+
+	every := opts.CompactEvery
+	if every <= 0 {
+		every = time.Minute
+	}
+	go db.run(every)
+	return db, nil
+}
+
+// Opens a store for reading only, without locking it, so it can be
+// queried while another process appends to it
+func OpenReadOnly(dir string) (*DB, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("tsdb: %s is not a directory", dir)
+	}
+	return &DB{dir: dir, readOnly: true}, nil
+}
+
+func (db *DB) tierDir(i int) string {
+	return filepath.Join(db.dir, Tiers[i].Name)
+}
+
+// Appends the metrics of a sample to the raw tier
+func (db *DB) Append(t time.Time, metrics []systeminfo.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed || db.readOnly {
+		return fmt.Errorf("tsdb: store is closed or read only")
+	}
+
+	seg, err := db.segmentFor(0, t)
+	if err != nil {
+		return err
+	}
+
+	var buf, rec []byte
+	rec = append(rec, recRaw)
+	rec = binary.AppendVarint(rec, t.UnixNano())
+	rec = binary.AppendUvarint(rec, uint64(len(metrics)))
+	for _, m := range metrics {
+		var id uint64
+		buf, id = seg.seriesID(buf, m.Name, m.Labels, seriesKey(m.Name, m.Labels))
+		rec = binary.AppendUvarint(rec, id)
+		rec = appendFloat(rec, m.Value)
+	}
+	return seg.write(appendFrame(buf, rec), t)
+}
+
+// Segment of a tier covering t, rolling over to a new one when t
+// is past the end of the current segment
+func (db *DB) segmentFor(tier int, t time.Time) (*segment, error) {
+	span := Tiers[tier].Span
+	seg := db.active[tier]
+	if seg != nil && !seg.broken && t.Before(seg.start.Add(span)) {
+		return seg, nil // Samples from a clock going backwards stay in the current segment too
+	}
+
+	start := t.Truncate(span)
+	if seg != nil {
+		if seg.broken {
+			// Reopening scans the file and cuts off what the failed write left
+			seg.f.Close()
+			if t.Before(seg.start.Add(span)) {
+				start = seg.start
+			}
+		} else if err := seg.close(); err != nil {
+			return nil, fmt.Errorf("tsdb: %w", err)
+		}
+		db.active[tier] = nil
+	}
+	seg, err := openSegment(segmentPath(db.tierDir(tier), start), start)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: %w", err)
+	}
+	db.active[tier] = seg
+	return seg, nil
+}
+
+// Stops the background compaction and closes the segments
+func (db *DB) Close() error {
+	if db.readOnly {
+		return nil
+	}
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil
+	}
+	db.closed = true
+	db.mu.Unlock()
+
+	close(db.stop)
+	<-db.done
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.closeFiles()
+}
+
+func (db *DB) closeFiles() error {
+	var err error
+	for i, seg := range db.active {
+		if seg != nil {
+			if cerr := seg.close(); err == nil {
+				err = cerr
+			}
+			db.active[i] = nil
+		}
+	}
+	if db.lock != nil {
+		db.lock.Close()
+		db.lock = nil
+	}
+	return err
+}
+
+func seriesKey(name string, labels map[string]string) string {
+	return systeminfo.SeriesKey(name, labels)
+}
+
+// Parses a retention or range like "36h", "14d" or "2w"
+// (time.ParseDuration has no day or week units)
+func ParseDuration(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit > 0 {
+		n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,290 @@
+package tsdb
+
+import (
+	"github/iegpeppino/syspulse/systeminfo"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Opens a store in a temporary directory, without background compactions
+// getting in the way of the test
+func openTestDB(t *testing.T, dir string) *DB {
+	t.Helper()
+	db, err := Open(Options{Dir: dir, CompactEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// Appends n samples 10 seconds apart from t0: cpu.percent counts up
+// from 0 and disk.used_percent holds 50 for / and 70 for /home
+func appendSamples(t *testing.T, db *DB, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		err := db.Append(t0.Add(time.Duration(i)*10*time.Second), []systeminfo.Metric{
+			{Name: "cpu.percent", Value: float64(i)},
+			{Name: "disk.used_percent", Labels: map[string]string{"mountpoint": "/"}, Value: 50},
+			{Name: "disk.used_percent", Labels: map[string]string{"mountpoint": "/home"}, Value: 70},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func cpuValues(t *testing.T, db *DB) []float64 {
+	t.Helper()
+	series, err := db.Read("raw", t0, t0.Add(time.Hour), func(name string, _ map[string]string) bool { return name == "cpu.percent" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 {
+		t.Fatalf("read %d cpu.percent series, want 1", len(series))
+	}
+	var values []float64
+	for _, s := range series[0].Samples {
+		values = append(values, s.Avg())
+	}
+	return values
+}
+
+func TestSegmentRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+	appendSamples(t, db, 5)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, dir)
+	defer db.Close()
+	series, err := db.Read("raw", t0, t0.Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 3 {
+		t.Fatalf("read %d series, want 3", len(series))
+	}
+	for _, s := range series {
+		if len(s.Samples) != 5 {
+			t.Errorf("%s%v has %d samples, want 5", s.Name, s.Labels, len(s.Samples))
+		}
+	}
+	if got, want := series[1].Labels, map[string]string{"mountpoint": "/"}; series[1].Name != "disk.used_percent" || !reflect.DeepEqual(got, want) {
+		t.Errorf("second series is %s%v, want disk.used_percent%v", series[1].Name, got, want)
+	}
+	if got, want := cpuValues(t, db), []float64{0, 1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cpu.percent = %v, want %v", got, want)
+	}
+
+	// Reads are bounded by from (included) and to (excluded)
+	series, err = db.Read("raw", t0.Add(10*time.Second), t0.Add(30*time.Second), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(series[0].Samples); n != 2 {
+		t.Errorf("bounded read returned %d samples, want 2", n)
+	}
+}
+
+func TestSegmentTruncatedTail(t *testing.T) {
+	tests := []struct {
+		name string
+		cut  func(t *testing.T, path string)
+	}{
+		{"partial frame", func(t *testing.T, path string) {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(path, info.Size()-3); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"corrupt frame", func(t *testing.T, path string) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data[len(data)-1] ^= 0xff // Fails the CRC of the last frame
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := openTestDB(t, dir)
+			appendSamples(t, db, 5)
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			tt.cut(t, segmentPath(filepath.Join(dir, "raw"), t0))
+
+			// Opening cuts the bad tail off: the last sample is dropped, the
+			// ones before it are read fine and appending goes on after them
+			db = openTestDB(t, dir)
+			if got, want := cpuValues(t, db), []float64{0, 1, 2, 3}; !reflect.DeepEqual(got, want) {
+				t.Errorf("cpu.percent = %v, want %v", got, want)
+			}
+			if err := db.Append(t0.Add(time.Minute), []systeminfo.Metric{{Name: "cpu.percent", Value: 6}}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := cpuValues(t, db), []float64{0, 1, 2, 3, 6}; !reflect.DeepEqual(got, want) {
+				t.Errorf("cpu.percent after appending = %v, want %v", got, want)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCompactRollup(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	appendSamples(t, db, 18) // 3 minutes
+
+	if err := db.Compact(t0.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := db.Read("1m", t0, t0.Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 3 {
+		t.Fatalf("1m tier holds %d series, want 3", len(series))
+	}
+	cpu := series[0]
+	want := []Sample{
+		{Time: t0, Min: 0, Max: 5, Sum: 15, Count: 6},
+		{Time: t0.Add(time.Minute), Min: 6, Max: 11, Sum: 51, Count: 6},
+		{Time: t0.Add(2 * time.Minute), Min: 12, Max: 17, Sum: 87, Count: 6},
+	}
+	if cpu.Name != "cpu.percent" || len(cpu.Samples) != len(want) {
+		t.Fatalf("1m %s = %+v, want cpu.percent %+v", cpu.Name, cpu.Samples, want)
+	}
+	for i, s := range cpu.Samples {
+		if !s.Time.Equal(want[i].Time) || s.Min != want[i].Min || s.Max != want[i].Max || s.Sum != want[i].Sum || s.Count != want[i].Count {
+			t.Errorf("1m bucket %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+
+	// The 10m tier is rolled up from the 1m one
+	series, err = db.Read("10m", t0, t0.Add(time.Hour), func(name string, _ map[string]string) bool { return name == "cpu.percent" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Samples) != 1 {
+		t.Fatalf("10m tier = %+v, want a single cpu.percent bucket", series)
+	}
+	if s := series[0].Samples[0]; s.Min != 0 || s.Max != 17 || s.Sum != 153 || s.Count != 18 {
+		t.Errorf("10m bucket = %+v, want min 0, max 17, sum 153 over 18 samples", s)
+	}
+
+	// Compacting again doesn't roll the same buckets up twice
+	if err := db.Compact(t0.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	series, err = db.Read("1m", t0, t0.Add(time.Hour), func(name string, _ map[string]string) bool { return name == "cpu.percent" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(series[0].Samples); n != 3 {
+		t.Errorf("1m tier holds %d buckets after a second compaction, want 3", n)
+	}
+}
+
+func TestCompactExpire(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(Options{Dir: dir, CompactEvery: time.Hour, Retention: map[string]time.Duration{"raw": time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	appendSamples(t, db, 1)
+	// A later segment becomes the one appended to
+	if err := db.Append(t0.Add(3*time.Hour), []systeminfo.Metric{{Name: "cpu.percent", Value: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Compact(t0.Add(3 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	starts, err := listSegments(filepath.Join(dir, "raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(starts) != 1 || !starts[0].Equal(t0.Add(3*time.Hour)) {
+		t.Errorf("raw segments left = %v, want only the one starting at %v", starts, t0.Add(3*time.Hour))
+	}
+}
+
+func TestFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+	defer db.Close()
+	appendSamples(t, db, 1)
+
+	// Writes fail on a read only handle
+	seg := db.active[0]
+	path := seg.f.Name()
+	seg.f.Close()
+	ro, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seg.f = ro
+	mem := []systeminfo.Metric{{Name: "cpu.percent", Value: 1}, {Name: "mem.percent", Value: 40}}
+	if err := db.Append(t0.Add(10*time.Second), mem); err == nil {
+		t.Fatal("Append() on a read only segment returned no error")
+	}
+	if _, ok := seg.ids[seriesKey("mem.percent", nil)]; ok {
+		t.Error("mem.percent kept the id of its failed definition")
+	}
+
+	// Once writable again the series is defined along with the next record
+	ro.Close()
+	if seg.f, err = os.OpenFile(path, os.O_RDWR, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seg.f.Seek(seg.size, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Append(t0.Add(20*time.Second), mem); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write that couldn't be undone gets the segment reopened, cutting
+	// off the partial frame it left
+	if _, err := seg.f.Write([]byte{0, 0, 0, 9, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	seg.broken = true
+	if err := db.Append(t0.Add(30*time.Second), []systeminfo.Metric{{Name: "cpu.percent", Value: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if db.active[0] == seg {
+		t.Error("broken segment is still the one appended to")
+	}
+
+	if got, want := cpuValues(t, db), []float64{0, 1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cpu.percent = %v, want %v", got, want)
+	}
+	series, err := db.Read("raw", t0, t0.Add(time.Hour), func(name string, _ map[string]string) bool { return name == "mem.percent" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Samples) != 1 || series[0].Samples[0].Avg() != 40 {
+		t.Errorf("mem.percent = %+v, want the one sample written after the failure", series)
+	}
+}